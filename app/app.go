@@ -0,0 +1,173 @@
+// Package app wires together everything the services need: configuration,
+// the database and the repositories on top of it, the mailer, blob storage
+// and the clock.
+package app
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cheeszy/journaling/config"
+	"github.com/cheeszy/journaling/encryption"
+	"github.com/cheeszy/journaling/mailer"
+	"github.com/cheeszy/journaling/repositories"
+	"github.com/cheeszy/journaling/storage"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Clock tells the time. Tests replace it to control what "now" is.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock returns the wall clock.
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+type App struct {
+	Config    *config.Config
+	DB        *gorm.DB
+	Mailer    mailer.Mailer
+	BlobStore storage.BlobStore
+	Clock     Clock
+
+	// ContentMasterKey encrypts each user's content key at rest.
+	ContentMasterKey []byte
+
+	repositories.Repositories
+}
+
+// New connects to the database, mailer and blob store described by cfg.
+func New(cfg *config.Config) (*App, error) {
+	db, err := OpenDB(cfg.DatabaseURL.Value())
+	if err != nil {
+		return nil, err
+	}
+	m, err := NewMailer(cfg.Mailer)
+	if err != nil {
+		return nil, err
+	}
+	store, err := NewBlobStore(cfg.Storage)
+	if err != nil {
+		return nil, err
+	}
+	key, err := DecodeContentKey(cfg.ContentEncryptionKey.Value())
+	if err != nil {
+		return nil, err
+	}
+
+	return &App{
+		Config:           cfg,
+		DB:               db,
+		Mailer:           m,
+		BlobStore:        store,
+		Clock:            SystemClock(),
+		ContentMasterKey: key,
+		Repositories:     repositories.New(db),
+	}, nil
+}
+
+// Transaction runs fn with a copy of the App whose DB and repositories are
+// bound to a single database transaction, committed when fn returns nil.
+// An App without a DB, as used with in-memory repositories, runs fn on
+// itself.
+func (a *App) Transaction(fn func(tx *App) error) error {
+	if a.DB == nil {
+		return fn(a)
+	}
+	return a.DB.Transaction(func(db *gorm.DB) error {
+		tx := *a
+		tx.DB = db
+		tx.Repositories = repositories.New(db)
+		return fn(&tx)
+	})
+}
+
+func OpenDB(dsn string) (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
+	if err != nil {
+		return nil, fmt.Errorf("connecting to database: %w", err)
+	}
+	return db, nil
+}
+
+// NewMailer picks the mail backend: "smtp", "file" to write .eml files to
+// cfg.Dir, or "memory".
+func NewMailer(cfg config.MailerConfig) (mailer.Mailer, error) {
+	var m mailer.Mailer
+	var err error
+
+	switch cfg.Backend {
+	case "smtp":
+		m, err = mailer.NewSMTPMailer(mailer.SMTPConfig{
+			Host:     cfg.SMTP.Host,
+			Port:     cfg.SMTP.Port,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password.Value(),
+			From:     cfg.From,
+			Security: cfg.SMTP.Security,
+			Auth:     cfg.SMTP.Auth,
+		})
+	case "file":
+		m, err = mailer.NewFileMailer(cfg.Dir, cfg.From)
+	case "memory":
+		m = mailer.NewMemoryMailer()
+	default:
+		return nil, fmt.Errorf("unknown MAILER_BACKEND %q", cfg.Backend)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("setting up mailer: %w", err)
+	}
+	return m, nil
+}
+
+// NewBlobStore picks the blob storage backend: "local" to keep files in
+// cfg.Dir, "s3" for an S3-compatible bucket, or "memory".
+func NewBlobStore(cfg config.StorageConfig) (storage.BlobStore, error) {
+	var store storage.BlobStore
+	var err error
+
+	switch cfg.Backend {
+	case "local":
+		store, err = storage.NewFileStore(cfg.Dir)
+	case "s3":
+		store, err = storage.NewS3Store(storage.S3Config{
+			Endpoint:        cfg.S3.Endpoint,
+			Region:          cfg.S3.Region,
+			Bucket:          cfg.S3.Bucket,
+			AccessKeyID:     cfg.S3.AccessKeyID,
+			SecretAccessKey: cfg.S3.SecretAccessKey.Value(),
+			PathStyle:       cfg.S3.PathStyle,
+		})
+	case "memory":
+		store = storage.NewMemoryStore()
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q", cfg.Backend)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("setting up blob storage: %w", err)
+	}
+	return store, nil
+}
+
+// DecodeContentKey decodes the master key from CONTENT_ENCRYPTION_KEY, 32
+// random bytes encoded as base64 (for example `openssl rand -base64 32`).
+func DecodeContentKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != encryption.KeySize {
+		return nil, errors.New("CONTENT_ENCRYPTION_KEY must be 32 bytes encoded as base64")
+	}
+	return key, nil
+}
@@ -0,0 +1,105 @@
+// Package audio recognises the formats accepted for voice notes and reads
+// their duration from the container, without decoding any audio.
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	ErrUnsupported = errors.New("audio must be Opus, WebM, M4A or MP3")
+	ErrMalformed   = errors.New("audio file is damaged or truncated")
+)
+
+// Info describes a recognised audio file.
+type Info struct {
+	ContentType string
+	Duration    time.Duration
+}
+
+// Probe sniffs the format of the size bytes in r and returns its content
+// type and duration. Neither the file name nor a client supplied content
+// type are trusted.
+func Probe(r io.ReaderAt, size int64) (Info, error) {
+	head := make([]byte, 64)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return Info{}, err
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return probeWebM(r, size)
+	case bytes.HasPrefix(head, []byte("OggS")):
+		return probeOgg(r, size)
+	case len(head) >= 8 && string(head[4:8]) == "ftyp":
+		return probeMP4(r, size)
+	case bytes.HasPrefix(head, []byte("ID3")) || (len(head) >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0):
+		return probeMP3(r, size)
+	}
+	return Info{}, ErrUnsupported
+}
+
+// reader reads big-endian values at a moving offset of an io.ReaderAt.
+type reader struct {
+	r    io.ReaderAt
+	off  int64
+	size int64
+}
+
+func (p *reader) bytes(n int64) ([]byte, error) {
+	if n < 0 || p.off+n > p.size {
+		return nil, ErrMalformed
+	}
+	buf := make([]byte, n)
+	if _, err := p.r.ReadAt(buf, p.off); err != nil && err != io.EOF {
+		return nil, err
+	}
+	p.off += n
+	return buf, nil
+}
+
+func (p *reader) byte() (byte, error) {
+	b, err := p.bytes(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (p *reader) uint32() (uint32, error) {
+	b, err := p.bytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+func (p *reader) uint64() (uint64, error) {
+	b, err := p.bytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+func (p *reader) skip(n int64) error {
+	if n < 0 || p.off+n > p.size {
+		return ErrMalformed
+	}
+	p.off += n
+	return nil
+}
+
+// fraction converts count units of 1/rate seconds to a duration.
+func fraction(count uint64, rate uint64) time.Duration {
+	if rate == 0 {
+		return 0
+	}
+	return time.Duration(float64(count) / float64(rate) * float64(time.Second))
+}
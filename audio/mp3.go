@@ -0,0 +1,162 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+const (
+	id3HeaderSize = 10
+	id3v1Size     = 128
+	mp3SyncSearch = 4 << 10
+)
+
+var (
+	mp3Bitrates = [2][15]uint64{
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320}, // MPEG-1
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},     // MPEG-2 and 2.5
+	}
+	mp3SampleRates = [3]uint64{44100, 48000, 32000}
+)
+
+// mp3Frame is a decoded MPEG audio layer III frame header.
+type mp3Frame struct {
+	mpeg1      bool
+	mono       bool
+	bitrate    uint64 // bits per second
+	sampleRate uint64
+	length     int64
+}
+
+func (f mp3Frame) samples() uint64 {
+	if f.mpeg1 {
+		return 1152
+	}
+	return 576
+}
+
+func parseMP3Frame(h []byte) (mp3Frame, bool) {
+	if len(h) < 4 || h[0] != 0xFF || h[1]&0xE0 != 0xE0 {
+		return mp3Frame{}, false
+	}
+	version := h[1] >> 3 & 3
+	layer := h[1] >> 1 & 3
+	bitrateIndex := h[2] >> 4
+	rateIndex := h[2] >> 2 & 3
+	if version == 1 || layer != 1 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+		return mp3Frame{}, false
+	}
+
+	f := mp3Frame{mpeg1: version == 3, mono: h[3]>>6 == 3}
+	table := 1
+	if f.mpeg1 {
+		table = 0
+	}
+	f.bitrate = mp3Bitrates[table][bitrateIndex] * 1000
+	f.sampleRate = mp3SampleRates[rateIndex]
+	switch version {
+	case 2:
+		f.sampleRate /= 2
+	case 0:
+		f.sampleRate /= 4
+	}
+	f.length = int64(f.samples() / 8 * f.bitrate / f.sampleRate)
+	if h[2]>>1&1 == 1 {
+		f.length++
+	}
+	return f, true
+}
+
+// probeMP3 finds the first frame after any ID3v2 tag. VBR files carry the
+// frame count in a Xing, Info or VBRI header; for the rest the bitrate of
+// the first frame is assumed throughout.
+func probeMP3(r io.ReaderAt, size int64) (Info, error) {
+	var start int64
+	head := make([]byte, id3HeaderSize)
+	if _, err := r.ReadAt(head, 0); err != nil && err != io.EOF {
+		return Info{}, err
+	}
+	if bytes.HasPrefix(head, []byte("ID3")) {
+		start = id3HeaderSize + (int64(head[6]&0x7F)<<21 | int64(head[7]&0x7F)<<14 |
+			int64(head[8]&0x7F)<<7 | int64(head[9]&0x7F))
+		if head[5]&0x10 != 0 {
+			start += id3HeaderSize // footer
+		}
+	}
+	if start >= size {
+		return Info{}, ErrMalformed
+	}
+
+	buf := make([]byte, mp3SyncSearch)
+	n, err := r.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return Info{}, err
+	}
+	buf = buf[:n]
+
+	// A frame only counts when the next one follows right after it, so
+	// random data that happens to look like a header isn't accepted.
+	offset := -1
+	var frame mp3Frame
+	for i := 0; i+4 <= len(buf); i++ {
+		f, ok := parseMP3Frame(buf[i:])
+		if !ok {
+			continue
+		}
+		next := start + int64(i) + f.length
+		if next+4 <= size {
+			h := make([]byte, 4)
+			if _, err := r.ReadAt(h, next); err != nil && err != io.EOF {
+				return Info{}, err
+			}
+			if _, ok := parseMP3Frame(h); !ok {
+				continue
+			}
+		}
+		offset, frame = i, f
+		break
+	}
+	if offset < 0 {
+		return Info{}, ErrUnsupported
+	}
+
+	info := Info{ContentType: "audio/mpeg"}
+	if frames, ok := vbrFrameCount(buf[offset:], frame); ok {
+		info.Duration = fraction(frames*frame.samples(), frame.sampleRate)
+		return info, nil
+	}
+
+	audioBytes := size - start - int64(offset)
+	tag := make([]byte, 3)
+	if size >= id3v1Size {
+		if _, err := r.ReadAt(tag, size-id3v1Size); err == nil && string(tag) == "TAG" {
+			audioBytes -= id3v1Size
+		}
+	}
+	info.Duration = fraction(uint64(audioBytes)*8, frame.bitrate)
+	return info, nil
+}
+
+// vbrFrameCount reads the frame count from a Xing/Info or VBRI header in
+// the first frame.
+func vbrFrameCount(frame []byte, f mp3Frame) (uint64, bool) {
+	side := 17
+	switch {
+	case f.mpeg1 && !f.mono:
+		side = 32
+	case !f.mpeg1 && f.mono:
+		side = 9
+	}
+
+	if x := 4 + side; x+12 <= len(frame) {
+		tag := string(frame[x : x+4])
+		if (tag == "Xing" || tag == "Info") && binary.BigEndian.Uint32(frame[x+4:])&1 != 0 {
+			return uint64(binary.BigEndian.Uint32(frame[x+8:])), true
+		}
+	}
+	if v := 4 + 32; v+18 <= len(frame) && string(frame[v:v+4]) == "VBRI" {
+		return uint64(binary.BigEndian.Uint32(frame[v+14:])), true
+	}
+	return 0, false
+}
@@ -0,0 +1,133 @@
+package audio
+
+import "io"
+
+// mp4Brands are the ftyp brands of audio-only MP4 files (M4A) and the
+// generic ones phones use for voice memos. Brands of images and video
+// containers, such as HEIC, aren't among them.
+var mp4Brands = map[string]bool{
+	"M4A ": true,
+	"M4B ": true,
+	"mp41": true,
+	"mp42": true,
+	"isom": true,
+	"iso2": true,
+	"dash": true,
+}
+
+// probeMP4 reads the duration from the movie header, which can be at the
+// start or the end of the file.
+func probeMP4(r io.ReaderAt, size int64) (Info, error) {
+	p := &reader{r: r, size: size}
+
+	end, kind, err := p.box()
+	if err != nil {
+		return Info{}, err
+	}
+	if kind != "ftyp" || end-p.off < 8 {
+		return Info{}, ErrUnsupported
+	}
+	brands, err := p.bytes(end - p.off)
+	if err != nil {
+		return Info{}, err
+	}
+	known := mp4Brands[string(brands[:4])]
+	for i := 8; i+4 <= len(brands); i += 4 {
+		known = known || mp4Brands[string(brands[i:i+4])]
+	}
+	if !known {
+		return Info{}, ErrUnsupported
+	}
+
+	for p.off < size {
+		end, kind, err := p.box()
+		if err != nil {
+			return Info{}, err
+		}
+		if kind != "moov" {
+			p.off = end
+			continue
+		}
+		for p.off < end {
+			childEnd, childKind, err := p.box()
+			if err != nil {
+				return Info{}, err
+			}
+			if childKind == "mvhd" {
+				return p.movieHeader()
+			}
+			p.off = childEnd
+		}
+	}
+	return Info{}, ErrMalformed
+}
+
+// box reads a box header and returns where the box ends and its type.
+func (p *reader) box() (int64, string, error) {
+	start := p.off
+	size32, err := p.uint32()
+	if err != nil {
+		return 0, "", err
+	}
+	kind, err := p.bytes(4)
+	if err != nil {
+		return 0, "", err
+	}
+
+	size := int64(size32)
+	switch size32 {
+	case 0:
+		size = p.size - start
+	case 1:
+		size64, err := p.uint64()
+		if err != nil {
+			return 0, "", err
+		}
+		if size64 > uint64(p.size) {
+			return 0, "", ErrMalformed
+		}
+		size = int64(size64)
+	}
+	if size < p.off-start || start+size > p.size {
+		return 0, "", ErrMalformed
+	}
+	return start + size, string(kind), nil
+}
+
+func (p *reader) movieHeader() (Info, error) {
+	version, err := p.byte()
+	if err != nil {
+		return Info{}, err
+	}
+
+	var timescale uint32
+	var duration uint64
+	if version == 1 {
+		if err := p.skip(3 + 16); err != nil { // flags, creation and modification times
+			return Info{}, err
+		}
+		if timescale, err = p.uint32(); err != nil {
+			return Info{}, err
+		}
+		if duration, err = p.uint64(); err != nil {
+			return Info{}, err
+		}
+	} else {
+		if err := p.skip(3 + 8); err != nil {
+			return Info{}, err
+		}
+		if timescale, err = p.uint32(); err != nil {
+			return Info{}, err
+		}
+		d, err := p.uint32()
+		if err != nil {
+			return Info{}, err
+		}
+		duration = uint64(d)
+	}
+
+	if timescale == 0 {
+		return Info{}, ErrMalformed
+	}
+	return Info{ContentType: "audio/mp4", Duration: fraction(duration, uint64(timescale))}, nil
+}
@@ -0,0 +1,61 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+const (
+	oggPageHeaderSize = 27
+	oggTailSize       = 64 << 10
+	opusSampleRate    = 48000
+)
+
+// probeOgg accepts Ogg files carrying Opus. The duration is the granule
+// position of the last page, which counts 48 kHz samples, less the
+// pre-skip from the Opus header.
+func probeOgg(r io.ReaderAt, size int64) (Info, error) {
+	p := &reader{r: r, size: size}
+	header, err := p.bytes(oggPageHeaderSize)
+	if err != nil {
+		return Info{}, err
+	}
+	if _, err := p.bytes(int64(header[26])); err != nil { // segment table
+		return Info{}, err
+	}
+	opusHead, err := p.bytes(19)
+	if err != nil {
+		return Info{}, err
+	}
+	if !bytes.HasPrefix(opusHead, []byte("OpusHead")) {
+		return Info{}, ErrUnsupported
+	}
+	serial := binary.LittleEndian.Uint32(header[14:18])
+	preSkip := uint64(binary.LittleEndian.Uint16(opusHead[10:12]))
+
+	tailStart := size - oggTailSize
+	if tailStart < 0 {
+		tailStart = 0
+	}
+	tail := make([]byte, size-tailStart)
+	if _, err := r.ReadAt(tail, tailStart); err != nil && err != io.EOF {
+		return Info{}, err
+	}
+
+	for i := bytes.LastIndex(tail, []byte("OggS")); i >= 0; i = bytes.LastIndex(tail[:i], []byte("OggS")) {
+		if i+oggPageHeaderSize > len(tail) || binary.LittleEndian.Uint32(tail[i+14:i+18]) != serial {
+			continue
+		}
+		granule := binary.LittleEndian.Uint64(tail[i+6 : i+14])
+		if granule == ^uint64(0) {
+			// No packet ends on this page.
+			continue
+		}
+		if granule < preSkip {
+			granule = preSkip
+		}
+		return Info{ContentType: "audio/ogg", Duration: fraction(granule-preSkip, opusSampleRate)}, nil
+	}
+	return Info{}, ErrMalformed
+}
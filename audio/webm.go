@@ -0,0 +1,224 @@
+package audio
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+// Matroska element IDs, with their length marker bits.
+const (
+	idEBML          = 0x1A45DFA3
+	idDocType       = 0x4282
+	idSegment       = 0x18538067
+	idInfo          = 0x1549A966
+	idTimecodeScale = 0x2AD7B1
+	idDuration      = 0x4489
+	idCluster       = 0x1F43B675
+	idTimecode      = 0xE7
+	idBlockGroup    = 0xA0
+	idBlock         = 0xA1
+	idSimpleBlock   = 0xA3
+)
+
+// probeWebM reads the duration from the segment info. Browsers recording
+// with MediaRecorder don't write one, so otherwise the clusters are walked
+// and the timestamp of the last block is used.
+func probeWebM(r io.ReaderAt, size int64) (Info, error) {
+	p := &reader{r: r, size: size}
+
+	var (
+		docType     string
+		scale       uint64 = 1000000
+		duration    float64
+		clusterTime uint64
+		lastBlock   int64 = -1
+	)
+
+	// Elements are read in order, stepping into the few containers that
+	// matter. That way sizes marked as unknown, which live recordings use
+	// for the segment and clusters, don't need to be resolved.
+scan:
+	for p.off < size {
+		id, err := p.elementID()
+		if err != nil {
+			break
+		}
+		length, known, err := p.elementSize()
+		if err != nil {
+			break
+		}
+
+		switch id {
+		case idEBML, idSegment, idInfo, idCluster, idBlockGroup:
+			if id == idCluster {
+				if docType == "" {
+					return Info{}, ErrMalformed
+				}
+				if duration > 0 {
+					break scan
+				}
+			}
+			continue
+		}
+		if !known {
+			return Info{}, ErrMalformed
+		}
+
+		switch id {
+		case idDocType:
+			b, err := p.bytes(length)
+			if err != nil {
+				break scan
+			}
+			docType = string(trimZeros(b))
+			if docType != "webm" && docType != "matroska" {
+				return Info{}, ErrUnsupported
+			}
+		case idTimecodeScale:
+			v, err := p.uintElement(length)
+			if err != nil {
+				break scan
+			}
+			if v > 0 {
+				scale = v
+			}
+		case idDuration:
+			b, err := p.bytes(length)
+			if err != nil {
+				break scan
+			}
+			switch length {
+			case 4:
+				duration = float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+			case 8:
+				duration = math.Float64frombits(binary.BigEndian.Uint64(b))
+			}
+		case idTimecode:
+			v, err := p.uintElement(length)
+			if err != nil {
+				break scan
+			}
+			clusterTime = v
+		case idSimpleBlock, idBlock:
+			start := p.off
+			if _, _, err := p.elementSize(); err != nil { // track number
+				break scan
+			}
+			b, err := p.bytes(2)
+			if err != nil {
+				break scan
+			}
+			at := int64(clusterTime) + int64(int16(binary.BigEndian.Uint16(b)))
+			if at > lastBlock {
+				lastBlock = at
+			}
+			if err := p.skip(length - (p.off - start)); err != nil {
+				break scan
+			}
+		default:
+			if err := p.skip(length); err != nil {
+				break scan
+			}
+		}
+	}
+
+	if docType == "" {
+		return Info{}, ErrMalformed
+	}
+	info := Info{ContentType: "audio/webm"}
+	if docType == "matroska" {
+		info.ContentType = "audio/x-matroska"
+	}
+	switch {
+	case duration > 0:
+		info.Duration = time.Duration(duration * float64(scale))
+	case lastBlock >= 0:
+		info.Duration = time.Duration(uint64(lastBlock) * scale)
+	default:
+		return Info{}, ErrMalformed
+	}
+	return info, nil
+}
+
+// elementID reads an EBML element ID, keeping its length marker.
+func (p *reader) elementID() (uint64, error) {
+	first, err := p.byte()
+	if err != nil {
+		return 0, err
+	}
+	n := 1
+	for mask := byte(0x80); n <= 4 && first&mask == 0; mask >>= 1 {
+		n++
+	}
+	if n > 4 {
+		return 0, ErrMalformed
+	}
+	id := uint64(first)
+	rest, err := p.bytes(int64(n - 1))
+	if err != nil {
+		return 0, err
+	}
+	for _, b := range rest {
+		id = id<<8 | uint64(b)
+	}
+	return id, nil
+}
+
+// elementSize reads an EBML variable length integer. known is false for
+// the reserved "unknown size" value.
+func (p *reader) elementSize() (int64, bool, error) {
+	first, err := p.byte()
+	if err != nil {
+		return 0, false, err
+	}
+	n := 1
+	mask := byte(0x80)
+	for n <= 8 && first&mask == 0 {
+		n++
+		mask >>= 1
+	}
+	if n > 8 {
+		return 0, false, ErrMalformed
+	}
+	value := uint64(first & (mask - 1))
+	allOnes := value == uint64(mask-1)
+	rest, err := p.bytes(int64(n - 1))
+	if err != nil {
+		return 0, false, err
+	}
+	for _, b := range rest {
+		value = value<<8 | uint64(b)
+		allOnes = allOnes && b == 0xFF
+	}
+	if allOnes {
+		return 0, false, nil
+	}
+	if value > math.MaxInt64 {
+		return 0, false, ErrMalformed
+	}
+	return int64(value), true, nil
+}
+
+func (p *reader) uintElement(length int64) (uint64, error) {
+	if length > 8 {
+		return 0, ErrMalformed
+	}
+	b, err := p.bytes(length)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+func trimZeros(b []byte) []byte {
+	for len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+	return b
+}
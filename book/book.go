@@ -0,0 +1,179 @@
+package book
+
+import (
+	"archive/zip"
+	"embed"
+	"encoding/xml"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"strings"
+	texttemplate "text/template"
+	"time"
+	"unicode/utf8"
+)
+
+//go:embed templates/*
+var templateFS embed.FS
+
+var (
+	xhtmlTemplates = htmltemplate.Must(htmltemplate.New("book").Funcs(htmltemplate.FuncMap{
+		"entry": entryData,
+	}).ParseFS(templateFS, "templates/*.xhtml", "templates/*.html"))
+	xmlTemplates = texttemplate.Must(texttemplate.New("book").Funcs(texttemplate.FuncMap{
+		"xml": xmlEscape,
+		"inc": func(i int) int { return i + 1 },
+	}).ParseFS(templateFS, "templates/*.xml", "templates/*.opf", "templates/*.ncx"))
+)
+
+// Book is a collection of journal entries grouped into chapters.
+type Book struct {
+	Identifier string
+	Title      string
+	Subtitle   string
+	Author     string
+	Language   string
+	Modified   time.Time
+	Chapters   []Chapter
+}
+
+// Chapter groups the entries of one period, typically a month.
+type Chapter struct {
+	ID      string
+	Title   string
+	Entries []Entry
+}
+
+// Entry is one journal entry. Body must be sanitized, well-formed XHTML, as
+// produced by utils.RenderMarkdown.
+type Entry struct {
+	Title string
+	Date  string
+	Body  htmltemplate.HTML
+}
+
+// File returns the name of the chapter's document inside the EPUB.
+func (c Chapter) File() string {
+	return "chapter-" + c.ID + ".xhtml"
+}
+
+// Anchor returns the fragment identifier of the i-th entry in the chapter.
+func (c Chapter) Anchor(i int) string {
+	return fmt.Sprintf("entry-%s-%d", c.ID, i+1)
+}
+
+func entryData(c Chapter, i int) interface{} {
+	return struct {
+		Anchor string
+		Entry  Entry
+	}{c.Anchor(i), c.Entries[i]}
+}
+
+// XMLSafe drops characters that aren't allowed in XML 1.0 documents, such as
+// control characters pasted into an entry.
+func XMLSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			return r
+		case r < 0x20, r == utf8.RuneError, r >= 0xFFFE && r <= 0xFFFF:
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// WriteEPUB writes the book as an EPUB 3 package with a navigation document,
+// an NCX table of contents for older readers and one document per chapter.
+func WriteEPUB(w io.Writer, b *Book) error {
+	zw := zip.NewWriter(w)
+
+	// The mimetype entry must come first and be stored uncompressed.
+	mimetype, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store, Modified: b.Modified})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mimetype, "application/epub+zip"); err != nil {
+		return err
+	}
+
+	files := []struct {
+		name   string
+		render func(io.Writer) error
+	}{
+		{"META-INF/container.xml", executeXML("container.xml", b)},
+		{"OEBPS/content.opf", executeXML("content.opf", b)},
+		{"OEBPS/toc.ncx", executeXML("toc.ncx", b)},
+		{"OEBPS/nav.xhtml", executeXHTML("nav.xhtml", b)},
+		{"OEBPS/title.xhtml", executeXHTML("title.xhtml", b)},
+		{"OEBPS/style.css", copyTemplateFile("style.css")},
+	}
+	for _, file := range files {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: b.Modified})
+		if err != nil {
+			return err
+		}
+		if err := file.render(f); err != nil {
+			return err
+		}
+	}
+
+	for _, chapter := range b.Chapters {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: "OEBPS/" + chapter.File(), Method: zip.Deflate, Modified: b.Modified})
+		if err != nil {
+			return err
+		}
+		data := struct {
+			Book    *Book
+			Chapter Chapter
+		}{b, chapter}
+		if err := xhtmlTemplates.ExecuteTemplate(f, "chapter.xhtml", data); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// WriteHTML writes the book as a single self-contained HTML file styled for
+// printing, with the table of contents linking to each chapter.
+func WriteHTML(w io.Writer, b *Book) error {
+	css, err := templateFS.ReadFile("templates/style.css")
+	if err != nil {
+		return err
+	}
+	data := struct {
+		*Book
+		Style htmltemplate.CSS
+	}{b, htmltemplate.CSS(css)}
+	return xhtmlTemplates.ExecuteTemplate(w, "print.html", data)
+}
+
+func executeXML(name string, data interface{}) func(io.Writer) error {
+	return func(w io.Writer) error {
+		return xmlTemplates.ExecuteTemplate(w, name, data)
+	}
+}
+
+func executeXHTML(name string, data interface{}) func(io.Writer) error {
+	return func(w io.Writer) error {
+		return xhtmlTemplates.ExecuteTemplate(w, name, data)
+	}
+}
+
+func copyTemplateFile(name string) func(io.Writer) error {
+	return func(w io.Writer) error {
+		data, err := templateFS.ReadFile("templates/" + name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cheeszy/journaling/mailer"
+)
+
+// messagesTo delivers pending email and returns what was sent to the address.
+func (ts *testServer) messagesTo(to string) []mailer.Message {
+	ts.t.Helper()
+	ts.deliver()
+
+	var messages []mailer.Message
+	for _, msg := range ts.mailer.Messages() {
+		if len(msg.To) > 0 && msg.To[0] == to {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+func TestChangeUsername(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+	bob := ts.signUp("bob")
+
+	change := func(u *testUser, username string) int {
+		return ts.do("PUT", "/api/account/change-username", u.Token, map[string]string{"username": username}).Code
+	}
+
+	for username, want := range map[string]int{
+		"al":    http.StatusBadRequest,
+		"a-b-c": http.StatusBadRequest,
+		"123":   http.StatusBadRequest,
+		"admin": http.StatusBadRequest,
+		"alice": http.StatusBadRequest,
+		"bob":   http.StatusConflict,
+	} {
+		if got := change(alice, username); got != want {
+			t.Errorf("changing to %q: status = %d, want %d", username, got, want)
+		}
+	}
+
+	if got := change(alice, "alicia"); got != http.StatusOK {
+		t.Fatalf("rename: status = %d", got)
+	}
+
+	rec := ts.do("PUT", "/api/account/change-username", alice.Token, map[string]string{"username": "ally"})
+	expectStatus(t, rec, http.StatusTooManyRequests)
+	if !strings.Contains(rec.Body.String(), "retryAt") {
+		t.Errorf("cooldown response %s has no retryAt", rec.Body.String())
+	}
+
+	// The old name stays held for alice during the redirect grace period.
+	if got := change(bob, "alice"); got != http.StatusConflict {
+		t.Errorf("taking a recently freed name: status = %d, want 409", got)
+	}
+	ts.clock.Advance(ts.app.Config.UsernameRedirectGrace + time.Hour)
+	ts.login(bob)
+	if got := change(bob, "alice"); got != http.StatusOK {
+		t.Errorf("taking the name after the grace period: status = %d, want 200", got)
+	}
+}
+
+func TestChangeEmail(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+	ts.signUp("bob")
+
+	expectStatus(t, ts.do("PUT", "/api/account/change-email", alice.Token, map[string]string{
+		"email": "not an address",
+	}), http.StatusBadRequest)
+	expectStatus(t, ts.do("PUT", "/api/account/change-email", alice.Token, map[string]string{
+		"email": alice.Email,
+	}), http.StatusBadRequest)
+	expectStatus(t, ts.do("PUT", "/api/account/change-email", alice.Token, map[string]string{
+		"email": "bob@example.com",
+	}), http.StatusConflict)
+
+	// A change cancelled from the old address doesn't apply.
+	expectStatus(t, ts.do("PUT", "/api/account/change-email", alice.Token, map[string]string{
+		"email": "alice@new.example",
+	}), http.StatusAccepted)
+	confirm := ts.linkToken("alice@new.example", "/account/email-change/confirm")
+	cancel := ts.linkToken(alice.Email, "/account/email-change/cancel")
+
+	expectStatus(t, ts.do("GET", "/api/account/email-change/cancel", "", nil), http.StatusBadRequest)
+	expectStatus(t, ts.do("GET", "/api/account/email-change/cancel?token=bogus", "", nil), http.StatusBadRequest)
+	expectStatus(t, ts.do("GET", "/api/account/email-change/cancel?token="+cancel, "", nil), http.StatusOK)
+	expectStatus(t, ts.do("GET", "/api/account/email-change/confirm?token="+confirm, "", nil), http.StatusConflict)
+
+	// A confirmed change does.
+	expectStatus(t, ts.do("PUT", "/api/account/change-email", alice.Token, map[string]string{
+		"email": "alice@new.example",
+	}), http.StatusAccepted)
+	confirm = ts.linkToken("alice@new.example", "/account/email-change/confirm")
+
+	expectStatus(t, ts.do("GET", "/api/account/email-change/confirm", "", nil), http.StatusBadRequest)
+	expectStatus(t, ts.do("GET", "/api/account/email-change/confirm?token="+confirm, "", nil), http.StatusOK)
+	expectStatus(t, ts.do("GET", "/api/account/email-change/confirm?token="+confirm, "", nil), http.StatusConflict)
+
+	alice.Email = "alice@new.example"
+	ts.login(alice)
+}
+
+func TestChangeEmailLinkExpires(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+
+	expectStatus(t, ts.do("PUT", "/api/account/change-email", alice.Token, map[string]string{
+		"email": "alice@new.example",
+	}), http.StatusAccepted)
+	confirm := ts.linkToken("alice@new.example", "/account/email-change/confirm")
+
+	ts.clock.Advance(25 * time.Hour)
+	expectStatus(t, ts.do("GET", "/api/account/email-change/confirm?token="+confirm, "", nil), http.StatusConflict)
+}
+
+func TestChangeTimezone(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+
+	expectStatus(t, ts.do("PUT", "/api/account/change-timezone", alice.Token, map[string]string{
+		"timezone": "Mars/Olympus_Mons",
+	}), http.StatusBadRequest)
+	expectStatus(t, ts.do("PUT", "/api/account/change-timezone", alice.Token, map[string]string{
+		"timezone": "Asia/Tokyo",
+	}), http.StatusOK)
+
+	user, err := ts.app.Users.FindByID(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Timezone != "Asia/Tokyo" {
+		t.Errorf("timezone = %q", user.Timezone)
+	}
+}
+
+func TestDailyDigest(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+	ts.createPost(alice, map[string]interface{}{"title": "Last year", "body": "Went to the lake"})
+
+	expectStatus(t, ts.do("PUT", "/api/account/digest", alice.Token, map[string]interface{}{
+		"hour": 8,
+	}), http.StatusBadRequest)
+	expectStatus(t, ts.do("PUT", "/api/account/digest", alice.Token, map[string]interface{}{
+		"enabled": true, "hour": 24,
+	}), http.StatusBadRequest)
+	expectStatus(t, ts.do("PUT", "/api/account/digest", alice.Token, map[string]interface{}{
+		"enabled": true, "hour": 0,
+	}), http.StatusOK)
+
+	now := ts.clock.Now()
+	later := now.AddDate(1, 0, 0)
+	if later.Day() != now.Day() {
+		later = now.AddDate(4, 0, 0)
+	}
+	ts.clock.Advance(later.Sub(now))
+
+	if n, err := ts.svc.SendDailyDigests(ts.clock.Now()); err != nil || n != 1 {
+		t.Fatalf("SendDailyDigests = %d, %v", n, err)
+	}
+	messages := ts.messagesTo(alice.Email)
+	if last := messages[len(messages)-1]; !strings.Contains(last.Text, "Last year") {
+		t.Errorf("digest text %q doesn't mention the memory", last.Text)
+	}
+
+	if n, err := ts.svc.SendDailyDigests(ts.clock.Now()); err != nil || n != 0 {
+		t.Fatalf("second SendDailyDigests the same day = %d, %v", n, err)
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+	ts.createPost(alice, map[string]interface{}{"title": "Doomed", "body": "b"})
+	sent := len(ts.messagesTo(alice.Email))
+
+	expectStatus(t, ts.do("DELETE", "/api/account", alice.Token, map[string]string{
+		"password": "wrong",
+	}), http.StatusUnauthorized)
+	expectStatus(t, ts.do("DELETE", "/api/account", alice.Token, map[string]string{
+		"password": alice.Password,
+	}), http.StatusAccepted)
+	if n := len(ts.messagesTo(alice.Email)); n != sent+1 {
+		t.Errorf("got %d new emails after scheduling the deletion, want 1", n-sent)
+	}
+	// Existing sessions end with it.
+	expectStatus(t, ts.do("GET", "/api/user", alice.Token, nil), http.StatusUnauthorized)
+
+	// Logging in during the grace period cancels the deletion.
+	ts.login(alice)
+	expectStatus(t, ts.do("GET", "/api/user", alice.Token, nil), http.StatusOK)
+	if n := len(ts.messagesTo(alice.Email)); n != sent+2 {
+		t.Errorf("got %d new emails after cancelling the deletion, want 2", n-sent)
+	}
+	grace := ts.app.Config.AccountDeletionGrace
+	ts.clock.Advance(grace + time.Hour)
+	if n, err := ts.svc.DeleteDueAccounts(ts.clock.Now()); err != nil || n != 0 {
+		t.Fatalf("DeleteDueAccounts after cancelling = %d, %v", n, err)
+	}
+
+	ts.login(alice)
+	expectStatus(t, ts.do("DELETE", "/api/account", alice.Token, map[string]string{
+		"password": alice.Password,
+	}), http.StatusAccepted)
+	ts.clock.Advance(grace + time.Hour)
+	if n, err := ts.svc.DeleteDueAccounts(ts.clock.Now()); err != nil || n != 1 {
+		t.Fatalf("DeleteDueAccounts = %d, %v", n, err)
+	}
+
+	expectStatus(t, ts.do("POST", "/api/login", "", map[string]string{
+		"identifier": alice.Email,
+		"password":   alice.Password,
+	}), http.StatusUnauthorized)
+
+	rec := ts.do("GET", "/api/posts", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if strings.Contains(rec.Body.String(), "Doomed") {
+		t.Errorf("posts of a deleted account are still listed: %s", rec.Body.String())
+	}
+
+	messages := ts.messagesTo(alice.Email)
+	if last := messages[len(messages)-1]; !strings.Contains(last.Subject, "deleted") {
+		t.Errorf("last email is %q, want the deletion notice", last.Subject)
+	}
+}
+
+func TestAccountUsage(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+
+	usage := func() (posts, bytes int64) {
+		t.Helper()
+		rec := ts.do("GET", "/api/account/usage", alice.Token, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var res struct {
+			Usage struct {
+				Plan        string `json:"plan"`
+				Posts       int64  `json:"posts"`
+				StoredBytes int64  `json:"storedBytes"`
+			} `json:"usage"`
+		}
+		decode(t, rec, &res)
+		if res.Usage.Plan != "free" {
+			t.Errorf("plan = %q, want free", res.Usage.Plan)
+		}
+		return res.Usage.Posts, res.Usage.StoredBytes
+	}
+
+	id := ts.createPost(alice, map[string]interface{}{"title": "t", "body": "some words"})
+	if posts, bytes := usage(); posts != 1 || bytes == 0 {
+		t.Errorf("usage after a post = %d posts, %d bytes", posts, bytes)
+	}
+
+	expectStatus(t, ts.do("DELETE", "/api/posts/"+id, alice.Token, nil), http.StatusAccepted)
+	if posts, bytes := usage(); posts != 0 || bytes != 0 {
+		t.Errorf("usage after deleting it = %d posts, %d bytes", posts, bytes)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+
+	rec := ts.do("POST", "/api/logout", alice.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if cookie := rec.Header().Get("Set-Cookie"); !strings.Contains(cookie, "token=;") {
+		t.Errorf("Set-Cookie = %q, want the token cleared", cookie)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cheeszy/journaling/mailer"
+	"github.com/google/uuid"
+)
+
+// rejectingMailer fails every delivery permanently, so emails go straight
+// to the dead letters.
+type rejectingMailer struct{}
+
+func (rejectingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	return &mailer.PermanentError{Err: errors.New("550 mailbox unavailable")}
+}
+
+type outboxJSON struct {
+	ID       string `json:"id"`
+	To       string `json:"to"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+}
+
+func TestAdminOutbox(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.signUp("admin_user")
+	ts.makeAdmin(admin)
+
+	ts.app.Mailer = rejectingMailer{}
+	carol := ts.register("carol")
+	ts.deliver()
+	ts.app.Mailer = ts.mailer
+
+	rec := ts.do("GET", "/api/admin/email-outbox?status=dead", admin.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var index struct {
+		Emails []outboxJSON `json:"emails"`
+	}
+	decode(t, rec, &index)
+	if len(index.Emails) != 1 || index.Emails[0].To != carol.Email {
+		t.Fatalf("dead letters = %+v, want carol's verification email", index.Emails)
+	}
+	path := "/api/admin/email-outbox/" + index.Emails[0].ID
+
+	rec = ts.do("GET", path, admin.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var shown struct {
+		Email outboxJSON `json:"email"`
+	}
+	decode(t, rec, &shown)
+	if shown.Email.Status != "dead" || shown.Email.Attempts != 1 {
+		t.Errorf("email = %+v", shown.Email)
+	}
+	expectStatus(t, ts.do("GET", "/api/admin/email-outbox/"+uuid.NewString(), admin.Token, nil), http.StatusNotFound)
+
+	expectStatus(t, ts.do("POST", path+"/retry", admin.Token, nil), http.StatusAccepted)
+	expectStatus(t, ts.do("POST", path+"/retry", admin.Token, nil), http.StatusNotFound)
+
+	ts.verify(carol)
+	rec = ts.do("GET", path, admin.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &shown)
+	if shown.Email.Status != "sent" {
+		t.Errorf("status after retry = %q, want sent", shown.Email.Status)
+	}
+}
+
+func TestAdminChangePlan(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.signUp("admin_user")
+	ts.makeAdmin(admin)
+	alice := ts.signUp("alice")
+
+	path := "/api/admin/users/" + alice.ID.String() + "/plan"
+	expectStatus(t, ts.do("PUT", path, admin.Token, map[string]string{"plan": "platinum"}), http.StatusBadRequest)
+	expectStatus(t, ts.do("PUT", "/api/admin/users/"+uuid.NewString()+"/plan", admin.Token, map[string]string{
+		"plan": "pro",
+	}), http.StatusNotFound)
+
+	rec := ts.do("PUT", path, admin.Token, map[string]string{"plan": "pro"})
+	expectStatus(t, rec, http.StatusOK)
+	var res struct {
+		Usage struct {
+			Plan     string `json:"plan"`
+			MaxPosts int64  `json:"maxPosts"`
+		} `json:"usage"`
+	}
+	decode(t, rec, &res)
+	if res.Usage.Plan != "pro" || res.Usage.MaxPosts != ts.app.Config.Plans.Pro.MaxPosts {
+		t.Errorf("usage = %+v, want the pro plan", res.Usage)
+	}
+}
+
+func TestMonkeytypeProxy(t *testing.T) {
+	ts := newTestServer(t)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/users/personalBests" || r.URL.Query().Get("mode") != "time" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "ApeKey test-ape-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"data":{"15":[{"wpm":120}]}}`))
+	}))
+	defer upstream.Close()
+
+	ts.app.Config.MonkeytypeURL = upstream.URL
+	ts.app.Config.MonkeytypeAPIKey = "test-ape-key"
+
+	rec := ts.do("GET", "/api/monkeytype", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if got := rec.Body.String(); got != `{"data":{"15":[{"wpm":120}]}}` {
+		t.Errorf("body = %s", got)
+	}
+
+	ts.app.Config.MonkeytypeAPIKey = "wrong"
+	expectStatus(t, ts.do("GET", "/api/monkeytype", "", nil), http.StatusUnauthorized)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cheeszy/journaling/models"
+	"gorm.io/gorm"
+)
+
+func TestRegistrationFlow(t *testing.T) {
+	ts := newTestServer(t)
+	u := ts.register("alice")
+
+	login := map[string]string{"identifier": u.Username, "password": u.Password}
+
+	rec := ts.do("POST", "/api/login", "", login)
+	expectStatus(t, rec, http.StatusUnauthorized)
+	if !strings.Contains(rec.Body.String(), "verify your email") {
+		t.Errorf("unverified login: %s", rec.Body.String())
+	}
+
+	expectStatus(t, ts.do("GET", "/api/verify", "", nil), http.StatusBadRequest)
+	expectStatus(t, ts.do("GET", "/api/verify?token=nope", "", nil), http.StatusBadRequest)
+	ts.verify(u)
+
+	rec = ts.do("POST", "/api/login", "", login)
+	expectStatus(t, rec, http.StatusForbidden)
+	var pending struct {
+		RecoveryKeyPending bool `json:"recoveryKeyPending"`
+	}
+	decode(t, rec, &pending)
+	if !pending.RecoveryKeyPending {
+		t.Errorf("login before confirming the recovery key: %s", rec.Body.String())
+	}
+
+	rec = ts.do("POST", "/api/recovery-key/kit", "", map[string]string{
+		"identifier": u.Username, "password": u.Password, "format": "txt",
+	})
+	expectStatus(t, rec, http.StatusOK)
+	if !strings.Contains(rec.Body.String(), u.RecoveryKey) {
+		t.Error("recovery kit doesn't contain the recovery key")
+	}
+
+	expectStatus(t, ts.do("POST", "/api/recovery-key/confirm", "", map[string]string{
+		"identifier": u.Username, "password": "wrong", "keySuffix": "whatever",
+	}), http.StatusUnauthorized)
+	expectStatus(t, ts.do("POST", "/api/recovery-key/confirm", "", map[string]string{
+		"identifier": u.Username, "password": u.Password, "keySuffix": "00000000",
+	}), http.StatusBadRequest)
+	ts.confirmRecoveryKey(u)
+	expectStatus(t, ts.do("POST", "/api/recovery-key/confirm", "", map[string]string{
+		"identifier": u.Username, "password": u.Password, "keySuffix": u.RecoveryKey[len(u.RecoveryKey)-8:],
+	}), http.StatusConflict)
+	expectStatus(t, ts.do("POST", "/api/recovery-key/kit", "", map[string]string{
+		"identifier": u.Username, "password": u.Password,
+	}), http.StatusGone)
+
+	ts.login(u)
+
+	rec = ts.do("GET", "/api/user", u.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var me struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	decode(t, rec, &me)
+	if me.ID != u.ID.String() || me.Username != u.Username {
+		t.Errorf("current user = %+v, want %s", me, u.Username)
+	}
+
+	rec = ts.do("POST", "/api/logout", u.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if cookie := rec.Result().Cookies(); len(cookie) == 0 || cookie[0].Name != "token" || cookie[0].MaxAge >= 0 {
+		t.Errorf("logout didn't clear the token cookie: %v", cookie)
+	}
+}
+
+func TestRegisterRejects(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("alice")
+
+	cases := []struct {
+		name string
+		body map[string]string
+		want int
+	}{
+		{"missing fields", map[string]string{"username": "bob"}, http.StatusBadRequest},
+		{"invalid email", map[string]string{"username": "bob", "email": "bob", "password": "pw"}, http.StatusBadRequest},
+		{"invalid username", map[string]string{"username": "b!", "email": "bob@example.com", "password": "pw"}, http.StatusBadRequest},
+		{"reserved username", map[string]string{"username": "Admin", "email": "bob@example.com", "password": "pw"}, http.StatusBadRequest},
+		{"taken username", map[string]string{"username": "ALICE", "email": "bob@example.com", "password": "pw"}, http.StatusConflict},
+		{"taken email", map[string]string{"username": "bob", "email": "alice@example.com", "password": "pw"}, http.StatusConflict},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			expectStatus(t, ts.do("POST", "/api/register", "", tc.body), tc.want)
+		})
+	}
+}
+
+func TestUsernamesIgnoreCase(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+	bob := ts.signUp("bob")
+	ts.createPost(alice, map[string]interface{}{"title": "t", "body": "b"})
+
+	// The store enforces it too, for a registration racing another.
+	err := ts.app.Users.Create(&models.User{Username: "Alice", Email: "other@example.com", Password: "x"})
+	if !errors.Is(err, gorm.ErrDuplicatedKey) {
+		t.Errorf("creating Alice next to alice: %v, want ErrDuplicatedKey", err)
+	}
+
+	expectStatus(t, ts.do("POST", "/api/login", "", map[string]string{
+		"identifier": "ALICE", "password": alice.Password,
+	}), http.StatusOK)
+
+	rec := ts.do("GET", "/api/posts/user/Alice", alice.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var res struct {
+		Data []postJSON `json:"data"`
+	}
+	decode(t, rec, &res)
+	if len(res.Data) != 1 {
+		t.Errorf("alice's posts as Alice = %+v", res.Data)
+	}
+	expectStatus(t, ts.do("GET", "/api/posts/user/Alice", bob.Token, nil), http.StatusForbidden)
+}
+
+func TestLoginRejectsBadCredentials(t *testing.T) {
+	ts := newTestServer(t)
+	u := ts.signUp("alice")
+
+	expectStatus(t, ts.do("POST", "/api/login", "", map[string]string{
+		"identifier": u.Email, "password": "wrong",
+	}), http.StatusUnauthorized)
+	expectStatus(t, ts.do("POST", "/api/login", "", map[string]string{
+		"identifier": "nobody", "password": u.Password,
+	}), http.StatusUnauthorized)
+}
+
+func TestVerificationLinkExpires(t *testing.T) {
+	ts := newTestServer(t)
+	u := ts.register("alice")
+	token := ts.linkToken(u.Email, "/verify")
+
+	ts.clock.Advance(16 * time.Minute)
+	rec := ts.do("GET", "/api/verify?token="+token, "", nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+	if !strings.Contains(rec.Body.String(), "expired") {
+		t.Errorf("expired token: %s", rec.Body.String())
+	}
+}
+
+func TestResendVerificationLimits(t *testing.T) {
+	ts := newTestServer(t)
+	u := ts.register("alice")
+	ts.deliver()
+
+	resend := func() (int, map[string]interface{}) {
+		rec := ts.do("POST", "/api/resend-verification", "", map[string]string{"email": u.Email})
+		var res map[string]interface{}
+		decode(t, rec, &res)
+		return rec.Code, res
+	}
+
+	for want := 2; want >= 0; want-- {
+		code, res := resend()
+		if code != http.StatusOK {
+			t.Fatalf("resend: status %d, %v", code, res)
+		}
+		if res["remaining_quota"] != float64(want) {
+			t.Errorf("remaining_quota = %v, want %d", res["remaining_quota"], want)
+		}
+		last, _ := res["last_delivery"].(map[string]interface{})
+		if last == nil || last["status"] == "" {
+			t.Errorf("last_delivery missing: %v", res)
+		}
+	}
+
+	code, res := resend()
+	if code != http.StatusTooManyRequests || res["error"] != "Max resend limit reached" {
+		t.Fatalf("fourth resend: status %d, %v", code, res)
+	}
+
+	// Only the newest link works.
+	token := ts.linkToken(u.Email, "/verify")
+
+	// The quota resets a day after the last link expired.
+	ts.clock.Advance(24*time.Hour + 16*time.Minute)
+	code, res = resend()
+	if code != http.StatusOK || res["resend_count"] != float64(1) {
+		t.Fatalf("resend after cooldown: status %d, %v", code, res)
+	}
+	expectStatus(t, ts.do("GET", "/api/verify?token="+token, "", nil), http.StatusBadRequest)
+
+	ts.verify(u)
+	code, res = resend()
+	if code != http.StatusTooManyRequests || res["error"] != "User is already verified" {
+		t.Errorf("resend when verified: status %d, %v", code, res)
+	}
+
+	expectStatus(t, ts.do("POST", "/api/resend-verification", "", map[string]string{
+		"email": "nobody@example.com",
+	}), http.StatusTooManyRequests)
+	expectStatus(t, ts.do("POST", "/api/resend-verification", "", map[string]string{
+		"email": "not an email",
+	}), http.StatusBadRequest)
+}
+
+func TestResetPasswordWithRecoveryKey(t *testing.T) {
+	ts := newTestServer(t)
+	u := ts.signUp("alice")
+
+	expectStatus(t, ts.do("POST", "/api/reset-password", "", map[string]string{
+		"recoveryKey": "not-the-key", "newPassword": "new password",
+	}), http.StatusBadRequest)
+
+	rec := ts.do("POST", "/api/reset-password", "", map[string]string{
+		"recoveryKey": u.RecoveryKey, "newPassword": "new password",
+	})
+	expectStatus(t, rec, http.StatusOK)
+
+	expectStatus(t, ts.do("POST", "/api/login", "", map[string]string{
+		"identifier": u.Email, "password": u.Password,
+	}), http.StatusUnauthorized)
+	u.Password = "new password"
+	ts.login(u)
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cheeszy/journaling/models"
+	"github.com/google/uuid"
+)
+
+// zipFiles reads every file of a zip archive.
+func zipFiles(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("reading zip: %v", err)
+	}
+	files := make(map[string]string)
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(content)
+	}
+	return files
+}
+
+func TestDataExport(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+	bob := ts.signUp("bob")
+	id := ts.createPost(alice, map[string]interface{}{"title": "Exported entry", "body": "Keep this"})
+	ts.store.AddComment(&models.Comment{
+		UserID:  alice.ID,
+		PostID:  uuid.MustParse(id),
+		Content: "A comment of mine",
+	})
+	capsule := ts.createPost(alice, map[string]interface{}{"title": "Capsule", "body": "Open me later"})
+	rec := ts.upload("POST", "/api/posts/"+capsule+"/attachments", alice.Token, "file", "letter.txt", []byte("Dear future me"), nil)
+	expectStatus(t, rec, http.StatusCreated)
+	expectStatus(t, ts.do("PUT", "/api/posts/"+capsule, alice.Token, map[string]interface{}{
+		"title":       "Capsule",
+		"body":        "Open me later",
+		"sealedUntil": ts.clock.Now().Add(48 * time.Hour),
+	}), http.StatusOK)
+
+	rec = ts.do("POST", "/api/account/export", alice.Token, nil)
+	expectStatus(t, rec, http.StatusAccepted)
+	var created struct {
+		Export struct {
+			ID     string `json:"id"`
+			Status string `json:"status"`
+		} `json:"export"`
+	}
+	decode(t, rec, &created)
+	path := "/api/account/export/" + created.Export.ID
+
+	expectStatus(t, ts.do("GET", path, bob.Token, nil), http.StatusNotFound)
+
+	if n, err := ts.svc.ProcessDataExports(ts.clock.Now()); err != nil || n != 1 {
+		t.Fatalf("ProcessDataExports = %d, %v", n, err)
+	}
+
+	rec = ts.do("GET", path, alice.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var shown struct {
+		Export struct {
+			Status string `json:"status"`
+			Size   int64  `json:"size"`
+		} `json:"export"`
+	}
+	decode(t, rec, &shown)
+	if shown.Export.Status != models.ExportStatusReady || shown.Export.Size == 0 {
+		t.Errorf("export = %+v, want it ready", shown.Export)
+	}
+
+	token := ts.linkToken(alice.Email, "/api/account/export/download")
+	expectStatus(t, ts.do("GET", "/api/account/export/download", "", nil), http.StatusBadRequest)
+	expectStatus(t, ts.do("GET", "/api/account/export/download?token=bogus", "", nil), http.StatusGone)
+
+	rec = ts.do("GET", "/api/account/export/download?token="+token, "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	files := zipFiles(t, rec.Body.Bytes())
+	if !strings.Contains(files["posts.json"], "Exported entry") {
+		t.Errorf("posts.json = %s", files["posts.json"])
+	}
+	if !strings.Contains(files["comments.json"], "A comment of mine") {
+		t.Errorf("comments.json = %s", files["comments.json"])
+	}
+	if !strings.Contains(files["profile.json"], alice.Email) {
+		t.Errorf("profile.json = %s", files["profile.json"])
+	}
+
+	// Sealed time capsules are exported in full, in a folder of their own.
+	if strings.Contains(files["posts.json"], "Open me later") {
+		t.Errorf("posts.json reveals the sealed entry: %s", files["posts.json"])
+	}
+	if !strings.Contains(files["sealed/posts.json"], "Open me later") || files["sealed/README.txt"] == "" {
+		t.Errorf("sealed/posts.json = %s", files["sealed/posts.json"])
+	}
+	var sealedFiles []string
+	for name, content := range files {
+		if strings.HasPrefix(name, "sealed/attachments/"+capsule+"/") && content == "Dear future me" ||
+			strings.HasPrefix(name, "sealed/entries/") && strings.Contains(content, "Open me later") {
+			sealedFiles = append(sealedFiles, name)
+		}
+	}
+	if len(sealedFiles) != 2 {
+		t.Errorf("sealed files = %v, want its entry and attachment", sealedFiles)
+	}
+
+	ts.clock.Advance(ts.app.Config.ExportLinkTTL + time.Hour)
+	if _, err := ts.svc.ExpireDataExports(ts.clock.Now()); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, ts.do("GET", "/api/account/export/download?token="+token, "", nil), http.StatusGone)
+}
+
+// markdownZip returns a zip archive with the given Markdown files.
+func markdownZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, content)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImport(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+	bob := ts.signUp("bob")
+
+	expectStatus(t, ts.do("POST", "/api/import", alice.Token, nil), http.StatusBadRequest)
+	rec := ts.upload("POST", "/api/import", alice.Token, "file", "notes.zip", []byte("not a zip"), nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	archive := markdownZip(t, map[string]string{
+		"journal/trip.md":   "---\ntitle: Road trip\ndate: 2020-05-01\n---\nDrove to the coast.\n",
+		"journal/broken.md": "---\ntitle: Broken\ndate: someday\n---\nLost.\n",
+	})
+	rec = ts.upload("POST", "/api/import", alice.Token, "file", "journal.zip", archive, nil)
+	expectStatus(t, rec, http.StatusAccepted)
+	var created struct {
+		Import struct {
+			ID string `json:"id"`
+		} `json:"import"`
+	}
+	decode(t, rec, &created)
+	path := "/api/import/" + created.Import.ID
+
+	if n, err := ts.svc.ProcessImports(ts.clock.Now()); err != nil || n != 1 {
+		t.Fatalf("ProcessImports = %d, %v", n, err)
+	}
+
+	expectStatus(t, ts.do("GET", path, bob.Token, nil), http.StatusNotFound)
+	rec = ts.do("GET", path, alice.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var shown struct {
+		Import struct {
+			Status   string `json:"status"`
+			Format   string `json:"format"`
+			Total    int    `json:"total"`
+			Imported int    `json:"imported"`
+			Failed   int    `json:"failed"`
+			Errors   []struct {
+				Entry string `json:"entry"`
+			} `json:"errors"`
+		} `json:"import"`
+	}
+	decode(t, rec, &shown)
+	job := shown.Import
+	if job.Status != models.ImportStatusCompleted || job.Format != models.ImportFormatMarkdown ||
+		job.Total != 2 || job.Imported != 1 || job.Failed != 1 {
+		t.Fatalf("import = %+v", job)
+	}
+	if len(job.Errors) != 1 || job.Errors[0].Entry != "journal/broken.md" {
+		t.Errorf("errors = %+v", job.Errors)
+	}
+
+	posts := ts.listPosts(alice)
+	if len(posts) != 1 || posts[0].Title != "Road trip" || posts[0].Body != "Drove to the coast." {
+		t.Fatalf("imported posts = %+v", posts)
+	}
+	stored, err := ts.app.Posts.FindByID(posts[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.BodyEncrypted || strings.Contains(stored.Body, "coast") {
+		t.Errorf("imported body stored as %q", stored.Body)
+	}
+
+	// Encrypted bodies aren't searched, so the entry is found by its title.
+	search := func(q string) []postJSON {
+		t.Helper()
+		rec := ts.do("GET", "/api/posts/search?q="+q, alice.Token, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var res struct {
+			Data []postJSON `json:"data"`
+		}
+		decode(t, rec, &res)
+		return res.Data
+	}
+	if found := search("road"); len(found) != 1 || found[0].Body != "Drove to the coast." {
+		t.Errorf("search by title = %+v, want the imported entry", found)
+	}
+	if found := search("coast"); len(found) != 0 {
+		t.Errorf("search by encrypted body = %+v, want nothing", found)
+	}
+	if found := search(url.QueryEscape(stored.Body[:8])); len(found) != 0 {
+		t.Errorf("search by ciphertext = %+v, want nothing", found)
+	}
+}
+
+func TestImportLimits(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+
+	files := make(map[string]string)
+	for i := 0; i <= 10_000; i++ {
+		files["journal/"+strconv.Itoa(i)+".md"] = ""
+	}
+	rec := ts.upload("POST", "/api/import", alice.Token, "file", "journal.zip", markdownZip(t, files), nil)
+	expectStatus(t, rec, http.StatusRequestEntityTooLarge)
+
+	ts.app.Config.Plans.Free.MaxBodyBytes = 16
+	archive := markdownZip(t, map[string]string{
+		"journal/short.md": "---\ntitle: Short\ndate: 2020-05-01\n---\nBrief.\n",
+		"journal/long.md":  "---\ntitle: Long\ndate: 2020-05-02\n---\nThis entry goes on for far too long.\n",
+	})
+	rec = ts.upload("POST", "/api/import", alice.Token, "file", "journal.zip", archive, nil)
+	expectStatus(t, rec, http.StatusAccepted)
+	if _, err := ts.svc.ProcessImports(ts.clock.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	posts := ts.listPosts(alice)
+	if len(posts) != 1 || posts[0].Title != "Short" {
+		t.Fatalf("imported posts = %+v", posts)
+	}
+}
+
+func TestBookExport(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+
+	expectStatus(t, ts.do("GET", "/api/account/export/book", alice.Token, nil), http.StatusNotFound)
+
+	ts.createPost(alice, map[string]interface{}{"title": "Chapter one", "body": "It begins."})
+
+	expectStatus(t, ts.do("GET", "/api/account/export/book?format=pdf", alice.Token, nil), http.StatusBadRequest)
+	expectStatus(t, ts.do("GET", "/api/account/export/book?from=2024-02-01&to=2024-01-01", alice.Token, nil), http.StatusBadRequest)
+	expectStatus(t, ts.do("GET", "/api/account/export/book?from=2000-01-01&to=2020-01-01", alice.Token, nil), http.StatusBadRequest)
+
+	rec := ts.do("GET", "/api/account/export/book?format=html", alice.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if !strings.Contains(rec.Body.String(), "Chapter one") {
+		t.Error("HTML book doesn't contain the entry")
+	}
+
+	rec = ts.do("GET", "/api/account/export/book", alice.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if got := rec.Header().Get("Content-Type"); got != "application/epub+zip" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	files := zipFiles(t, rec.Body.Bytes())
+	if files["mimetype"] != "application/epub+zip" {
+		t.Errorf("mimetype = %q", files["mimetype"])
+	}
+}
+
+func TestStats(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+
+	for _, year := range []string{"soon", "1969", "10000"} {
+		expectStatus(t, ts.do("GET", "/api/stats?year="+year, alice.Token, nil), http.StatusBadRequest)
+	}
+
+	stats := func(query string) (entries, words int) {
+		t.Helper()
+		rec := ts.do("GET", "/api/stats"+query, alice.Token, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var res struct {
+			TotalEntries int `json:"totalEntries"`
+			TotalWords   int `json:"totalWords"`
+		}
+		decode(t, rec, &res)
+		return res.TotalEntries, res.TotalWords
+	}
+
+	if entries, _ := stats(""); entries != 0 {
+		t.Errorf("entries before writing = %d", entries)
+	}
+
+	// Stats are cached per day and dropped when the user writes.
+	ts.createPost(alice, map[string]interface{}{"title": "t", "body": "three little words"})
+	ts.createPost(alice, map[string]interface{}{"title": "t", "body": "two words"})
+	if entries, words := stats(""); entries != 2 || words != 5 {
+		t.Errorf("stats = %d entries, %d words; want 2, 5", entries, words)
+	}
+	if entries, _ := stats("?year=" + strconv.Itoa(ts.clock.Now().Year())); entries != 2 {
+		t.Errorf("entries this year = %d", entries)
+	}
+
+	// A sealed time capsule counts as an entry but its words stay hidden
+	// until it unseals.
+	ts.createPost(alice, map[string]interface{}{
+		"title":       "t",
+		"body":        "a secret of six words here",
+		"sealedUntil": ts.clock.Now().Add(time.Hour),
+	})
+	if entries, words := stats(""); entries != 3 || words != 5 {
+		t.Errorf("stats with a sealed post = %d entries, %d words; want 3, 5", entries, words)
+	}
+	ts.clock.Advance(2 * time.Hour)
+	if _, err := ts.svc.NotifyUnsealedPosts(ts.clock.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if entries, words := stats(""); entries != 3 || words != 11 {
+		t.Errorf("stats after unsealing = %d entries, %d words; want 3, 11", entries, words)
+	}
+
+	// Posts stored without going through the service don't drop the cache,
+	// which shows what's cached: the last 365 days until the day ends, and
+	// other years not at all.
+	stats("?year=2020")
+	for _, at := range []time.Time{ts.clock.Now(), time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)} {
+		post := &models.Post{UserID: alice.ID, Title: "t", Status: models.PostStatusPublished, CreatedAt: at}
+		if err := ts.app.Posts.Create(post); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if entries, _ := stats("?year=2020"); entries != 5 {
+		t.Errorf("entries with the 2020 calendar = %d, want 5", entries)
+	}
+	if entries, _ := stats(""); entries != 3 {
+		t.Errorf("cached entries = %d, want 3", entries)
+	}
+	ts.clock.Advance(24 * time.Hour)
+	ts.login(alice)
+	if entries, _ := stats(""); entries != 5 {
+		t.Errorf("entries the next day = %d, want 5", entries)
+	}
+}
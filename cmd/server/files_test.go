@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cheeszy/journaling/encryption"
+	"github.com/cheeszy/journaling/services"
+)
+
+type attachmentJSON struct {
+	ID          string `json:"id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+}
+
+func (ts *testServer) listAttachments(u *testUser, postID string) []attachmentJSON {
+	ts.t.Helper()
+	rec := ts.do("GET", "/api/posts/"+postID+"/attachments", u.Token, nil)
+	expectStatus(ts.t, rec, http.StatusOK)
+
+	var res struct {
+		Data []attachmentJSON `json:"data"`
+	}
+	decode(ts.t, rec, &res)
+	return res.Data
+}
+
+func TestAttachments(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+	id := ts.createPost(alice, map[string]interface{}{"title": "t", "body": "b"})
+	content := []byte("plain notes\n")
+
+	rec := ts.do("POST", "/api/posts/"+id+"/attachments", alice.Token, nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = ts.upload("POST", "/api/posts/"+id+"/attachments", alice.Token, "file", "notes.txt", content, nil)
+	expectStatus(t, rec, http.StatusCreated)
+	var created struct {
+		Attachment attachmentJSON `json:"attachment"`
+	}
+	decode(t, rec, &created)
+	attachment := created.Attachment
+	if attachment.Filename != "notes.txt" || attachment.Size != int64(len(content)) {
+		t.Errorf("attachment = %+v", attachment)
+	}
+
+	if list := ts.listAttachments(alice, id); len(list) != 1 || list[0].ID != attachment.ID {
+		t.Fatalf("attachments = %+v", list)
+	}
+
+	path := "/api/posts/" + id + "/attachments/" + attachment.ID
+	rec = ts.do("GET", path, alice.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if !bytes.Equal(rec.Body.Bytes(), content) {
+		t.Errorf("downloaded %q, want %q", rec.Body.String(), content)
+	}
+	if got := rec.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("X-Content-Type-Options = %q", got)
+	}
+	if got := rec.Header().Get("Content-Disposition"); !strings.Contains(got, "notes.txt") {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+
+	expectStatus(t, ts.do("DELETE", path, alice.Token, nil), http.StatusOK)
+	expectStatus(t, ts.do("GET", path, alice.Token, nil), http.StatusNotFound)
+	if list := ts.listAttachments(alice, id); len(list) != 0 {
+		t.Fatalf("attachments after delete = %+v", list)
+	}
+}
+
+func TestAttachmentRanges(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+	id := ts.createPost(alice, map[string]interface{}{"title": "t", "body": "b"})
+
+	content := make([]byte, 2*encryption.ChunkSize+1000)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	rec := ts.upload("POST", "/api/posts/"+id+"/attachments", alice.Token, "file", "song.bin", content, nil)
+	expectStatus(t, rec, http.StatusCreated)
+	var created struct {
+		Attachment attachmentJSON `json:"attachment"`
+	}
+	decode(t, rec, &created)
+	path := "/api/posts/" + id + "/attachments/" + created.Attachment.ID
+
+	tests := []struct {
+		header     string
+		start, end int // inclusive
+	}{
+		{"bytes=65530-65545", encryption.ChunkSize - 6, encryption.ChunkSize + 9},
+		{"bytes=0-9", 0, 9},
+		{fmt.Sprintf("bytes=%d-", 2*encryption.ChunkSize-1), 2*encryption.ChunkSize - 1, len(content) - 1},
+		{"bytes=-20", len(content) - 20, len(content) - 1},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Range", tt.header)
+		rec := ts.serve(req, alice.Token)
+		expectStatus(t, rec, http.StatusPartialContent)
+		if !bytes.Equal(rec.Body.Bytes(), content[tt.start:tt.end+1]) {
+			t.Errorf("Range %s returned %d bytes that don't match the upload", tt.header, rec.Body.Len())
+		}
+		want := fmt.Sprintf("bytes %d-%d/%d", tt.start, tt.end, len(content))
+		if got := rec.Header().Get("Content-Range"); got != want {
+			t.Errorf("Range %s: Content-Range = %q, want %q", tt.header, got, want)
+		}
+	}
+
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", len(content)+10))
+	expectStatus(t, ts.serve(req, alice.Token), http.StatusRequestedRangeNotSatisfiable)
+}
+
+func TestAttachmentsOfOtherUsers(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+	bob := ts.signUp("bob")
+	id := ts.createPost(alice, map[string]interface{}{"title": "t", "body": "b"})
+
+	rec := ts.upload("POST", "/api/posts/"+id+"/attachments", alice.Token, "file", "notes.txt", []byte("mine"), nil)
+	expectStatus(t, rec, http.StatusCreated)
+	var created struct {
+		Attachment attachmentJSON `json:"attachment"`
+	}
+	decode(t, rec, &created)
+	path := "/api/posts/" + id + "/attachments/" + created.Attachment.ID
+
+	rec = ts.upload("POST", "/api/posts/"+id+"/attachments", bob.Token, "file", "evil.txt", []byte("theirs"), nil)
+	expectStatus(t, rec, http.StatusNotFound)
+	expectStatus(t, ts.do("GET", "/api/posts/"+id+"/attachments", bob.Token, nil), http.StatusNotFound)
+	expectStatus(t, ts.do("GET", path, bob.Token, nil), http.StatusNotFound)
+	expectStatus(t, ts.do("DELETE", path, bob.Token, nil), http.StatusNotFound)
+
+	if list := ts.listAttachments(alice, id); len(list) != 1 {
+		t.Fatalf("alice's attachments = %+v, want them untouched", list)
+	}
+}
+
+func TestVoiceRecordingCannotBeDeleted(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+
+	rec := ts.upload("POST", "/api/posts/voice", alice.Token, "audio", "note.mp3", mp3Fixture(4), nil)
+	expectStatus(t, rec, http.StatusCreated)
+	var res struct {
+		Post postJSON `json:"post"`
+	}
+	decode(t, rec, &res)
+
+	expectStatus(t, ts.do("DELETE", res.Post.Audio.URL, alice.Token, nil), http.StatusConflict)
+}
+
+// pngFixture returns a w×h PNG image.
+func pngFixture(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decodedSize(t *testing.T, data []byte) (int, int) {
+	t.Helper()
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decoding image: %v", err)
+	}
+	return cfg.Width, cfg.Height
+}
+
+func TestCoverPhoto(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+	id := ts.createPost(alice, map[string]interface{}{"title": "t", "body": "b"})
+	path := "/api/posts/" + id + "/cover"
+	storedBytes := func() int64 {
+		t.Helper()
+		user, err := ts.app.Users.FindByID(alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user.StoredBytes
+	}
+	textBytes := storedBytes()
+
+	expectStatus(t, ts.do("GET", path, alice.Token, nil), http.StatusNotFound)
+
+	rec := ts.upload("PUT", path, alice.Token, "file", "cover.gif", []byte("GIF89a"), nil)
+	expectStatus(t, rec, http.StatusUnsupportedMediaType)
+	rec = ts.upload("PUT", path, alice.Token, "file", "cover.png", make([]byte, services.CoverRequestMaxBytes), nil)
+	expectStatus(t, rec, http.StatusRequestEntityTooLarge)
+
+	rec = ts.upload("PUT", path, alice.Token, "file", "cover.png", pngFixture(t, 800, 400), nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	post := ts.findPost(alice, id)
+	if post == nil || post.Cover == nil || post.Cover.Width != 800 || post.Cover.Height != 400 {
+		t.Fatalf("post cover = %+v", post)
+	}
+	if _, ok := post.Cover.Thumbnails["small"]; !ok {
+		t.Errorf("thumbnails = %+v, want a small one", post.Cover.Thumbnails)
+	}
+	if got := storedBytes(); got <= textBytes {
+		t.Errorf("stored bytes with a cover = %d, want more than %d", got, textBytes)
+	}
+
+	rec = ts.do("GET", path, alice.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if got := rec.Header().Get("Content-Type"); got != "image/png" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if w, h := decodedSize(t, rec.Body.Bytes()); w != 800 || h != 400 {
+		t.Errorf("cover is %dx%d, want 800x400", w, h)
+	}
+
+	rec = ts.do("GET", path+"/small", alice.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if w, h := decodedSize(t, rec.Body.Bytes()); w != 160 || h != 80 {
+		t.Errorf("small thumbnail is %dx%d, want 160x80", w, h)
+	}
+	expectStatus(t, ts.do("GET", path+"/huge", alice.Token, nil), http.StatusNotFound)
+
+	ts.app.Config.Plans.Free.MaxBytes = storedBytes()
+	rec = ts.upload("PUT", path, alice.Token, "file", "cover.png", pngFixture(t, 1600, 800), nil)
+	expectStatus(t, rec, http.StatusPaymentRequired)
+	if post := ts.findPost(alice, id); post.Cover == nil || post.Cover.Width != 800 {
+		t.Errorf("cover after going over quota = %+v, want the old one", post.Cover)
+	}
+
+	expectStatus(t, ts.do("DELETE", path, alice.Token, nil), http.StatusOK)
+	expectStatus(t, ts.do("GET", path, alice.Token, nil), http.StatusNotFound)
+	expectStatus(t, ts.do("DELETE", path, alice.Token, nil), http.StatusNotFound)
+	if got := storedBytes(); got != textBytes {
+		t.Errorf("stored bytes after deleting the cover = %d, want %d", got, textBytes)
+	}
+}
+
+func TestCoverPhotoOfOtherUsers(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+	bob := ts.signUp("bob")
+	published := ts.createPost(alice, map[string]interface{}{"title": "t", "body": "b"})
+	draft := ts.createPost(alice, map[string]interface{}{"title": "t", "body": "b", "status": "draft"})
+
+	for _, id := range []string{published, draft} {
+		rec := ts.upload("PUT", "/api/posts/"+id+"/cover", alice.Token, "file", "cover.png", pngFixture(t, 64, 64), nil)
+		expectStatus(t, rec, http.StatusOK)
+	}
+
+	// Published covers are readable by everyone, drafts only by the owner.
+	expectStatus(t, ts.do("GET", "/api/posts/"+published+"/cover", bob.Token, nil), http.StatusOK)
+	expectStatus(t, ts.do("GET", "/api/posts/"+draft+"/cover", bob.Token, nil), http.StatusNotFound)
+
+	rec := ts.upload("PUT", "/api/posts/"+published+"/cover", bob.Token, "file", "cover.png", pngFixture(t, 32, 32), nil)
+	expectStatus(t, rec, http.StatusNotFound)
+	expectStatus(t, ts.do("DELETE", "/api/posts/"+published+"/cover", bob.Token, nil), http.StatusNotFound)
+
+	post := ts.findPost(alice, published)
+	if post == nil || post.Cover == nil || post.Cover.Width != 64 {
+		t.Fatalf("alice's cover = %+v, want it untouched", post)
+	}
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cheeszy/journaling/app"
+	"github.com/cheeszy/journaling/config"
+	"github.com/cheeszy/journaling/encryption"
+	"github.com/cheeszy/journaling/logging"
+	"github.com/cheeszy/journaling/mailer"
+	"github.com/cheeszy/journaling/repositories/memory"
+	"github.com/cheeszy/journaling/services"
+	"github.com/cheeszy/journaling/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	slog.SetDefault(logging.New(io.Discard, slog.LevelError))
+	flag.Parse()
+
+	code := m.Run()
+	if code == 0 && flag.Lookup("test.run").Value.String() == "" {
+		if missing := untestedRoutes(); len(missing) > 0 {
+			fmt.Fprintf(os.Stderr, "routes without a test:\n  %s\n", strings.Join(missing, "\n  "))
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+// testClock is an app.Clock the test moves forward by hand.
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// testServer is the API from newRouter on top of in-memory repositories,
+// mailer and blob storage. Background workers don't run; tests call them
+// through svc when they need them.
+type testServer struct {
+	t      *testing.T
+	app    *app.App
+	svc    *services.Service
+	store  *memory.Store
+	mailer *mailer.MemoryMailer
+	clock  *testClock
+	router *gin.Engine
+}
+
+func testConfig(dir string) *config.Config {
+	cfg := config.Default()
+	cfg.Domain = "http://api.test"
+	cfg.FEDomain = "http://app.test"
+	cfg.JWTSecret = "test-jwt-secret"
+	cfg.Mailer.Backend = "memory"
+	cfg.Storage.Backend = "memory"
+	cfg.ImportDir = filepath.Join(dir, "imports")
+	cfg.ExportDir = filepath.Join(dir, "exports")
+	cfg.CoverDir = filepath.Join(dir, "covers")
+	return &cfg
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	key := make([]byte, encryption.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	store := memory.NewStore()
+	m := mailer.NewMemoryMailer()
+	clock := &testClock{now: time.Now()}
+	a := &app.App{
+		Config:           testConfig(t.TempDir()),
+		Mailer:           m,
+		BlobStore:        storage.NewMemoryStore(),
+		Clock:            clock,
+		ContentMasterKey: key,
+		Repositories:     store.Repositories(),
+	}
+	svc := services.New(a)
+
+	return &testServer{
+		t:      t,
+		app:    a,
+		svc:    svc,
+		store:  store,
+		mailer: m,
+		clock:  clock,
+		router: newRouter(svc),
+	}
+}
+
+var (
+	hitsMu sync.Mutex
+	hits   = make(map[string]bool)
+)
+
+// serve sends req to the router and records the route for untestedRoutes.
+func (ts *testServer) serve(req *http.Request, token string) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	hitsMu.Lock()
+	hits[req.Method+" "+req.URL.Path] = true
+	hitsMu.Unlock()
+
+	rec := httptest.NewRecorder()
+	ts.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// do sends body, if any, as JSON.
+func (ts *testServer) do(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	ts.t.Helper()
+
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			ts.t.Fatal(err)
+		}
+		r = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, r)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return ts.serve(req, token)
+}
+
+// upload sends a multipart form with content in the file field and the
+// other fields alongside.
+func (ts *testServer) upload(method, path, token, field, filename string, content []byte, fields map[string]string) *httptest.ResponseRecorder {
+	ts.t.Helper()
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for name, value := range fields {
+		if err := w.WriteField(name, value); err != nil {
+			ts.t.Fatal(err)
+		}
+	}
+	part, err := w.CreateFormFile(field, filename)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	part.Write(content)
+	if err := w.Close(); err != nil {
+		ts.t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return ts.serve(req, token)
+}
+
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if rec.Code != want {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, want, rec.Body.String())
+	}
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+	}
+}
+
+// testUser is an account registered through the API.
+type testUser struct {
+	ID          uuid.UUID
+	Username    string
+	Email       string
+	Password    string
+	RecoveryKey string
+	Token       string
+}
+
+// register creates an account through the API, leaving it unverified and
+// with its recovery key unconfirmed.
+func (ts *testServer) register(username string) *testUser {
+	ts.t.Helper()
+
+	u := &testUser{
+		Username: username,
+		Email:    strings.ToLower(username) + "@example.com",
+		Password: "correct horse battery staple",
+	}
+	rec := ts.do("POST", "/api/register", "", map[string]string{
+		"username": u.Username,
+		"email":    u.Email,
+		"password": u.Password,
+	})
+	expectStatus(ts.t, rec, http.StatusOK)
+
+	var res struct {
+		RecoveryKey string `json:"recoveryKey"`
+	}
+	decode(ts.t, rec, &res)
+	u.RecoveryKey = res.RecoveryKey
+
+	user, err := ts.app.Users.FindByEmail(u.Email)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	u.ID = user.ID
+	return u
+}
+
+// deliver runs the outbox worker once.
+func (ts *testServer) deliver() {
+	ts.t.Helper()
+	if _, _, err := ts.svc.DeliverOutbox(ts.clock.Now()); err != nil {
+		ts.t.Fatal(err)
+	}
+}
+
+// linkToken delivers pending email and returns the token of the newest link
+// to path sent to the address.
+func (ts *testServer) linkToken(to, path string) string {
+	ts.t.Helper()
+	ts.deliver()
+
+	pattern := regexp.MustCompile(regexp.QuoteMeta(path) + `\?token=([A-Za-z0-9_-]+)`)
+	messages := ts.mailer.Messages()
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := messages[i]
+		if len(msg.To) == 0 || msg.To[0] != to {
+			continue
+		}
+		if m := pattern.FindStringSubmatch(msg.Text); m != nil {
+			return m[1]
+		}
+	}
+	ts.t.Fatalf("no email to %s with a %s link", to, path)
+	return ""
+}
+
+// verify follows the link in the verification email.
+func (ts *testServer) verify(u *testUser) {
+	ts.t.Helper()
+	token := ts.linkToken(u.Email, "/verify")
+	expectStatus(ts.t, ts.do("GET", "/api/verify?token="+token, "", nil), http.StatusOK)
+}
+
+func (ts *testServer) confirmRecoveryKey(u *testUser) {
+	ts.t.Helper()
+	rec := ts.do("POST", "/api/recovery-key/confirm", "", map[string]string{
+		"identifier": u.Username,
+		"password":   u.Password,
+		"keySuffix":  u.RecoveryKey[len(u.RecoveryKey)-services.RecoveryKeySuffixLength:],
+	})
+	expectStatus(ts.t, rec, http.StatusOK)
+}
+
+// login returns a fresh JWT for u and remembers it as u.Token.
+func (ts *testServer) login(u *testUser) string {
+	ts.t.Helper()
+	rec := ts.do("POST", "/api/login", "", map[string]string{
+		"identifier": u.Email,
+		"password":   u.Password,
+	})
+	expectStatus(ts.t, rec, http.StatusOK)
+
+	var res struct {
+		Token string `json:"token"`
+	}
+	decode(ts.t, rec, &res)
+	u.Token = res.Token
+	return u.Token
+}
+
+// signUp registers, verifies and logs in a new user.
+func (ts *testServer) signUp(username string) *testUser {
+	ts.t.Helper()
+	u := ts.register(username)
+	ts.verify(u)
+	ts.confirmRecoveryKey(u)
+	ts.login(u)
+	return u
+}
+
+func (ts *testServer) makeAdmin(u *testUser) {
+	ts.t.Helper()
+	user, err := ts.app.Users.FindByID(u.ID)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	user.IsAdmin = true
+	if err := ts.app.Users.Update(user); err != nil {
+		ts.t.Fatal(err)
+	}
+}
+
+// createPost creates a post through the API and returns its ID.
+func (ts *testServer) createPost(u *testUser, body map[string]interface{}) string {
+	ts.t.Helper()
+	rec := ts.do("POST", "/api/posts", u.Token, body)
+	expectStatus(ts.t, rec, http.StatusCreated)
+
+	var res struct {
+		Post struct {
+			ID string `json:"id"`
+		} `json:"post"`
+	}
+	decode(ts.t, rec, &res)
+	return res.Post.ID
+}
+
+// routeParams returns how many parameters of a gin route pattern a request
+// path fills, or -1 when it doesn't match.
+func routeParams(pattern, path string) int {
+	want := strings.Split(pattern, "/")
+	got := strings.Split(path, "/")
+	if len(want) != len(got) {
+		return -1
+	}
+	params := 0
+	for i := range want {
+		switch {
+		case strings.HasPrefix(want[i], ":") && got[i] != "":
+			params++
+		case want[i] != got[i]:
+			return -1
+		}
+	}
+	return params
+}
+
+// untestedRoutes lists the routes of newRouter no test sent a request to.
+// Like gin, a request is matched to the route with the fewest parameters,
+// so /account/export/book doesn't count for /account/export/:id.
+func untestedRoutes() []string {
+	router := newRouter(services.New(&app.App{Config: testConfig(os.TempDir())}))
+	routes := router.Routes()
+
+	hitsMu.Lock()
+	defer hitsMu.Unlock()
+
+	covered := make(map[string]bool)
+	for hit := range hits {
+		method, path, _ := strings.Cut(hit, " ")
+		best, fewest := "", -1
+		for _, route := range routes {
+			if route.Method != method {
+				continue
+			}
+			if n := routeParams(route.Path, path); n >= 0 && (fewest < 0 || n < fewest) {
+				best, fewest = route.Path, n
+			}
+		}
+		covered[method+" "+best] = true
+	}
+
+	var missing []string
+	for _, route := range routes {
+		if !covered[route.Method+" "+route.Path] {
+			missing = append(missing, route.Method+" "+route.Path)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cheeszy/journaling/mailer"
+)
+
+// unreachableMailer is a mailer whose server can't be reached.
+type unreachableMailer struct {
+	*mailer.MemoryMailer
+	pings *int
+}
+
+func (m unreachableMailer) Ping(ctx context.Context) error {
+	*m.pings++
+	return errors.New("dial tcp 10.0.0.5:587: connection refused")
+}
+
+func TestHealthz(t *testing.T) {
+	ts := newTestServer(t)
+	ts.app.Mailer = unreachableMailer{ts.mailer, new(int)}
+
+	expectStatus(t, ts.do("GET", "/healthz", "", nil), http.StatusOK)
+}
+
+func TestReadyz(t *testing.T) {
+	ts := newTestServer(t)
+
+	rec := ts.do("GET", "/readyz", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var res struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}
+	decode(t, rec, &res)
+	if res.Checks["mailer"] != "ok" {
+		t.Errorf("checks = %v", res.Checks)
+	}
+
+	logs := captureLogs(t)
+	pings := 0
+	ts.app.Mailer = unreachableMailer{ts.mailer, &pings}
+	for i := 0; i < 3; i++ {
+		rec = ts.do("GET", "/readyz", "", nil)
+		expectStatus(t, rec, http.StatusServiceUnavailable)
+	}
+	// The outcome of the last ping is reused for a while.
+	if pings != 1 {
+		t.Errorf("mailer pinged %d times, want once", pings)
+	}
+	ts.clock.Advance(time.Minute)
+	expectStatus(t, ts.do("GET", "/readyz", "", nil), http.StatusServiceUnavailable)
+	if pings != 2 {
+		t.Errorf("mailer pinged %d times, want it pinged again", pings)
+	}
+	// What failed is only logged.
+	decode(t, rec, &res)
+	if res.Checks["mailer"] != "failed" || strings.Contains(rec.Body.String(), "refused") {
+		t.Errorf("readyz = %s", rec.Body)
+	}
+	if !strings.Contains(logs.String(), "connection refused") {
+		t.Errorf("logs = %s, want the mailer error", logs)
+	}
+}
+
+func TestWorkersStop(t *testing.T) {
+	ts := newTestServer(t)
+	carol := ts.register("carol")
+	ts.svc.StartOutboxWorker(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ts.svc.Stop(ctx); err != nil {
+		t.Fatalf("Stop() = %v", err)
+	}
+	// Stop waited for the run already in progress.
+	if msgs := ts.mailer.Messages(); len(msgs) != 1 || msgs[0].To[0] != carol.Email {
+		t.Error("the outbox worker didn't finish sending before Stop returned")
+	}
+	// Stopping twice is harmless.
+	if err := ts.svc.Stop(ctx); err != nil {
+		t.Fatalf("second Stop() = %v", err)
+	}
+}
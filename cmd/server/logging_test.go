@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cheeszy/journaling/logging"
+)
+
+// captureLogs sends log lines to a buffer for the rest of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	slog.SetDefault(logging.New(&buf, slog.LevelInfo))
+	t.Cleanup(func() { slog.SetDefault(logging.New(io.Discard, slog.LevelError)) })
+	return &buf
+}
+
+// accessLogs returns the access log lines in buf.
+func accessLogs(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("log line %q isn't JSON: %v", scanner.Text(), err)
+		}
+		if line["msg"] == "Request" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestRequestID(t *testing.T) {
+	ts := newTestServer(t)
+
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	req.Header.Set("X-Request-ID", "lb-1234")
+	if got := ts.serve(req, "").Header().Get("X-Request-ID"); got != "lb-1234" {
+		t.Errorf("X-Request-ID = %q, want the one sent", got)
+	}
+
+	for _, sent := range []string{"", "has spaces", strings.Repeat("a", 200)} {
+		req := httptest.NewRequest("GET", "/healthz", nil)
+		req.Header.Set("X-Request-ID", sent)
+		got := ts.serve(req, "").Header().Get("X-Request-ID")
+		if got == "" || got == sent {
+			t.Errorf("X-Request-ID for %q = %q, want a generated one", sent, got)
+		}
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+	logs := captureLogs(t)
+
+	req := httptest.NewRequest("GET", "/api/user", nil)
+	req.Header.Set("X-Request-ID", "req-42")
+	expectStatus(t, ts.serve(req, alice.Token), 200)
+	ts.do("GET", "/api/verify?token=secret-token", "", nil)
+
+	out := logs.String()
+	lines := accessLogs(t, logs)
+	if len(lines) != 2 {
+		t.Fatalf("access log = %v", lines)
+	}
+	if lines[0]["request_id"] != "req-42" || lines[0]["user_id"] != alice.ID.String() ||
+		lines[0]["path"] != "/api/user" || lines[0]["status"] != float64(200) {
+		t.Errorf("access log line = %v", lines[0])
+	}
+	if _, ok := lines[1]["user_id"]; ok {
+		t.Errorf("anonymous request logged a user: %v", lines[1])
+	}
+	for _, leaked := range []string{alice.Email, alice.Token, "secret-token"} {
+		if strings.Contains(out, leaked) {
+			t.Errorf("logs contain %q:\n%s", leaked, out)
+		}
+	}
+}
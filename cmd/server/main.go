@@ -1,67 +1,125 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/cheeszy/journaling/controllers"
-	"github.com/cheeszy/journaling/initializers"
-	"github.com/cheeszy/journaling/middleware"
-	"github.com/gin-contrib/cors"
+	"github.com/cheeszy/journaling/app"
+	"github.com/cheeszy/journaling/config"
+	"github.com/cheeszy/journaling/logging"
+	"github.com/cheeszy/journaling/services"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
-	initializers.LoadEnvVariables()
-	initializers.ConnectToDB()
+	configPath := flag.String("config", "", "path to a YAML config file (defaults to $CONFIG_FILE)")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration, with secrets redacted, and exit")
+	flag.Parse()
 
-	router := gin.Default()
-	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{os.Getenv("FE_DOMAIN")},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
+	if *printConfig {
+		os.Exit(printEffectiveConfig(*configPath))
+	}
 
-	// ===== Public Routes =====
-	public := router.Group("/api")
-	{
-		public.POST("/register", controllers.Register)
-		public.POST("/login", controllers.Login)
-		public.POST("/resend-verification", controllers.ResendVerificationEmail)
-		public.POST("/reset-password", controllers.ResetPasswordWithRecoveryKey)
+	// Log at info until the configuration says otherwise.
+	slog.SetDefault(logging.New(os.Stdout, slog.LevelInfo))
+	// Gin's debug mode prints plain-text route listings between the JSON
+	// lines; GIN_MODE can still turn it back on.
+	if os.Getenv(gin.EnvGinMode) == "" {
+		gin.SetMode(gin.ReleaseMode)
+	}
 
-		public.GET("/verify", controllers.VerifyEmail)
-		public.GET("/monkeytype", controllers.MonkeyAPI)
-		public.GET("/posts", controllers.PostsIndex)
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fatal("Loading configuration", err)
+	}
+	level, _ := logging.ParseLevel(cfg.LogLevel)
+	slog.SetDefault(logging.New(os.Stdout, level))
 
-		// Optional/Commented routes
-		// public.GET("/posts/:id", controllers.PostsShowById)
-		// public.GET("/users", controllers.Users)
+	a, err := app.New(cfg)
+	if err != nil {
+		fatal("Starting", err)
 	}
+	svc := services.New(a)
 
-	// ===== Protected Routes =====
-	protected := router.Group("/api")
-	protected.Use(middleware.RequireAuth)
-	protected.Use(middleware.RequireRLS)
-	{
-		protected.GET("/posts/user/:username", controllers.PostsShowAllPosts)
-		protected.POST("/posts", controllers.PostsCreate)
-		protected.PUT("/posts/:id", controllers.PostsUpdate)
-		protected.DELETE("/posts/:id", controllers.PostsDelete)
+	svc.StartPostScheduler(time.Minute)
+	svc.StartTimeCapsuleScheduler(5 * time.Minute)
+	svc.StartDigestScheduler(15 * time.Minute)
+	svc.StartOutboxWorker(10 * time.Second)
+	svc.StartAccountDeletionScheduler(time.Hour)
+	svc.StartExportWorker(30 * time.Second)
+	svc.StartImportWorker(10 * time.Second)
 
-		protected.POST("/logout", controllers.Logout)
-		protected.GET("/user", controllers.GetCurrentUser)
-		protected.GET("/", controllers.HomeHandler)
+	server := &http.Server{
+		Addr:              cfg.Addr(),
+		Handler:           newRouter(svc),
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Serving", "domain", cfg.Domain, "addr", cfg.Addr())
+		serveErr <- server.ListenAndServe()
+	}()
 
-		protected.PUT("/account/change-username", controllers.ChangeUsername)
-		protected.PUT("/account/change-email", controllers.ChangeEmail)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-serveErr:
+		fatal("Serving HTTP", err)
+	case sig := <-stop:
+		slog.Info("Shutting down", "signal", sig.String())
+	}
+
+	// Requests and background jobs share one deadline; whatever is still
+	// running when it passes is cut off.
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("HTTP server shutdown failed", "error", err)
+	}
+	if err := svc.Stop(ctx); err != nil {
+		slog.Error("Background workers didn't stop in time", "error", err)
 	}
+	if a.DB != nil {
+		if sqlDB, err := a.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}
+	slog.Info("Shut down")
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
 
-	router.NoRoute(controllers.NotFoundHandler)
-	fmt.Println(os.Getenv("DOMAIN"))
-	router.Run(":3000")
+// printEffectiveConfig writes the configuration as YAML to stdout and any
+// validation problems to stderr, and returns the exit code.
+func printEffectiveConfig(path string) int {
+	cfg, err := config.Load(path)
+	if cfg == nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	out, marshalErr := cfg.YAML()
+	if marshalErr != nil {
+		fmt.Fprintln(os.Stderr, marshalErr)
+		return 1
+	}
+	os.Stdout.Write(out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
 }
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+type metricJSON struct {
+	ID   string   `json:"id"`
+	Name string   `json:"name"`
+	Kind string   `json:"kind"`
+	Min  *float64 `json:"min"`
+	Max  *float64 `json:"max"`
+}
+
+type seriesJSON struct {
+	Bucket string `json:"bucket"`
+	Points []struct {
+		Count int64   `json:"count"`
+		Avg   float64 `json:"avg"`
+		Min   float64 `json:"min"`
+		Max   float64 `json:"max"`
+		Sum   float64 `json:"sum"`
+	} `json:"points"`
+}
+
+func (ts *testServer) createMetric(u *testUser, body map[string]interface{}) metricJSON {
+	ts.t.Helper()
+	rec := ts.do("POST", "/api/metrics", u.Token, body)
+	expectStatus(ts.t, rec, http.StatusCreated)
+
+	var res struct {
+		Metric metricJSON `json:"metric"`
+	}
+	decode(ts.t, rec, &res)
+	return res.Metric
+}
+
+func TestCreateMetric(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+
+	mood := ts.createMetric(alice, map[string]interface{}{"name": "mood", "kind": "scale"})
+	if mood.Min == nil || *mood.Min != 1 || mood.Max == nil || *mood.Max != 5 {
+		t.Errorf("scale metric = %+v, want a 1-5 range by default", mood)
+	}
+
+	expectStatus(t, ts.do("POST", "/api/metrics", alice.Token, map[string]interface{}{
+		"name": "mood", "kind": "scale",
+	}), http.StatusConflict)
+	expectStatus(t, ts.do("POST", "/api/metrics", alice.Token, map[string]interface{}{
+		"name": "sleep", "kind": "duration",
+	}), http.StatusBadRequest)
+	expectStatus(t, ts.do("POST", "/api/metrics", alice.Token, map[string]interface{}{
+		"name": "sleep", "kind": "number", "min": 10, "max": 0,
+	}), http.StatusBadRequest)
+
+	// Names are only unique per user.
+	bob := ts.signUp("bob")
+	ts.createMetric(bob, map[string]interface{}{"name": "mood", "kind": "scale"})
+
+	rec := ts.do("GET", "/api/metrics", alice.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var res struct {
+		Metrics []metricJSON `json:"metrics"`
+	}
+	decode(t, rec, &res)
+	if len(res.Metrics) != 1 || res.Metrics[0].ID != mood.ID {
+		t.Fatalf("metrics = %+v, want only alice's mood", res.Metrics)
+	}
+}
+
+func TestMetricSeries(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+	mood := ts.createMetric(alice, map[string]interface{}{"name": "mood", "kind": "scale"})
+
+	withMood := func(value float64) map[string]interface{} {
+		return map[string]interface{}{
+			"title":   "t",
+			"body":    "b",
+			"metrics": []map[string]interface{}{{"metricId": mood.ID, "value": value}},
+		}
+	}
+
+	expectStatus(t, ts.do("POST", "/api/posts", alice.Token, withMood(6)), http.StatusBadRequest)
+
+	ts.createPost(alice, withMood(4))
+	second := ts.createPost(alice, withMood(2))
+
+	post := ts.findPost(alice, second)
+	if post == nil || len(post.Metrics) != 1 || post.Metrics[0].Name != "mood" || post.Metrics[0].Value != 2 {
+		t.Fatalf("post metrics = %+v", post)
+	}
+
+	sealed := withMood(1)
+	sealed["sealedUntil"] = ts.clock.Now().Add(time.Hour)
+	ts.createPost(alice, sealed)
+
+	series := func() seriesJSON {
+		t.Helper()
+		to := ts.clock.Now().UTC().Format("2006-01-02")
+		rec := ts.do("GET", "/api/metrics/"+mood.ID+"/series?bucket=day&to="+to, alice.Token, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var res seriesJSON
+		decode(t, rec, &res)
+		return res
+	}
+
+	got := series()
+	if len(got.Points) != 1 {
+		t.Fatalf("series = %+v, want one day", got)
+	}
+	if p := got.Points[0]; p.Count != 2 || p.Avg != 3 || p.Min != 2 || p.Max != 4 || p.Sum != 6 {
+		t.Errorf("point = %+v, want the two unsealed values", p)
+	}
+
+	// Saving a post again replaces its value.
+	update := withMood(5)
+	expectStatus(t, ts.do("PUT", "/api/posts/"+second, alice.Token, update), http.StatusOK)
+	if p := series().Points[0]; p.Count != 2 || p.Avg != 4.5 {
+		t.Errorf("point after update = %+v", p)
+	}
+
+	expectStatus(t, ts.do("GET", "/api/metrics/"+mood.ID+"/series?bucket=hour", alice.Token, nil), http.StatusBadRequest)
+	expectStatus(t, ts.do("GET", "/api/metrics/"+mood.ID+"/series?from=yesterday", alice.Token, nil), http.StatusBadRequest)
+}
+
+func TestDeleteMetric(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+	bob := ts.signUp("bob")
+	mood := ts.createMetric(alice, map[string]interface{}{"name": "mood", "kind": "scale"})
+	id := ts.createPost(alice, map[string]interface{}{
+		"title":   "t",
+		"body":    "b",
+		"metrics": []map[string]interface{}{{"metricId": mood.ID, "value": 3}},
+	})
+
+	expectStatus(t, ts.do("GET", "/api/metrics/"+mood.ID+"/series", bob.Token, nil), http.StatusNotFound)
+	expectStatus(t, ts.do("DELETE", "/api/metrics/"+mood.ID, bob.Token, nil), http.StatusNotFound)
+	expectStatus(t, ts.do("GET", "/api/metrics/"+mood.ID+"/series", alice.Token, nil), http.StatusOK)
+
+	expectStatus(t, ts.do("DELETE", "/api/metrics/"+mood.ID, alice.Token, nil), http.StatusAccepted)
+	expectStatus(t, ts.do("GET", "/api/metrics/"+mood.ID+"/series", alice.Token, nil), http.StatusNotFound)
+
+	if post := ts.findPost(alice, id); post == nil || len(post.Metrics) != 0 {
+		t.Fatalf("post after deleting its metric = %+v", post)
+	}
+}
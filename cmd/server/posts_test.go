@@ -0,0 +1,450 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type postJSON struct {
+	ID          string     `json:"id"`
+	Kind        string     `json:"kind"`
+	Title       string     `json:"title"`
+	Body        string     `json:"body"`
+	BodyHTML    string     `json:"bodyHtml"`
+	Transcript  string     `json:"transcript"`
+	Status      string     `json:"status"`
+	Sealed      bool       `json:"sealed"`
+	AutosavedAt *time.Time `json:"autosavedAt"`
+	Audio       *struct {
+		URL        string `json:"url"`
+		DurationMs int64  `json:"durationMs"`
+	} `json:"audio"`
+	Metrics []struct {
+		MetricID string  `json:"metricId"`
+		Name     string  `json:"name"`
+		Value    float64 `json:"value"`
+	} `json:"metrics"`
+	Cover *struct {
+		URL        string `json:"url"`
+		Width      int    `json:"width"`
+		Height     int    `json:"height"`
+		Thumbnails map[string]struct {
+			URL string `json:"url"`
+		} `json:"thumbnails"`
+	} `json:"cover"`
+}
+
+// listPosts returns the user's own posts from /posts/user/:username.
+func (ts *testServer) listPosts(u *testUser) []postJSON {
+	ts.t.Helper()
+	rec := ts.do("GET", "/api/posts/user/"+u.Username, u.Token, nil)
+	expectStatus(ts.t, rec, http.StatusOK)
+
+	var res struct {
+		Data []postJSON `json:"data"`
+	}
+	decode(ts.t, rec, &res)
+	return res.Data
+}
+
+func (ts *testServer) findPost(u *testUser, id string) *postJSON {
+	ts.t.Helper()
+	for _, post := range ts.listPosts(u) {
+		if post.ID == id {
+			return &post
+		}
+	}
+	return nil
+}
+
+func TestPostLifecycle(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+
+	rec := ts.do("POST", "/api/posts?render=html", alice.Token, map[string]interface{}{
+		"title": "First",
+		"body":  "Some **bold** words",
+	})
+	expectStatus(t, rec, http.StatusCreated)
+	var created struct {
+		Post postJSON `json:"post"`
+	}
+	decode(t, rec, &created)
+	if created.Post.Status != "published" {
+		t.Errorf("status = %q, want published", created.Post.Status)
+	}
+	if !strings.Contains(created.Post.BodyHTML, "<strong>bold</strong>") {
+		t.Errorf("bodyHtml = %q, want rendered markdown", created.Post.BodyHTML)
+	}
+	id := created.Post.ID
+
+	rec = ts.do("GET", "/api/posts", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var index struct {
+		Posts []postJSON `json:"posts"`
+	}
+	decode(t, rec, &index)
+	if len(index.Posts) != 1 || index.Posts[0].ID != id {
+		t.Fatalf("public index = %+v, want the new post", index.Posts)
+	}
+
+	rec = ts.do("PUT", "/api/posts/"+id, alice.Token, map[string]interface{}{
+		"title": "First, edited",
+		"body":  "New body",
+	})
+	expectStatus(t, rec, http.StatusOK)
+	if post := ts.findPost(alice, id); post == nil || post.Title != "First, edited" || post.Body != "New body" {
+		t.Fatalf("after update got %+v", post)
+	}
+
+	rec = ts.do("PUT", "/api/posts/"+id+"/autosave", alice.Token, map[string]string{"body": "x"})
+	expectStatus(t, rec, http.StatusConflict)
+
+	rec = ts.do("PUT", "/api/posts/"+id, alice.Token, map[string]interface{}{
+		"title":  "Draft",
+		"body":   "Draft body",
+		"status": "scheduled",
+	})
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	expectStatus(t, ts.do("DELETE", "/api/posts/"+id, alice.Token, nil), http.StatusAccepted)
+	if posts := ts.listPosts(alice); len(posts) != 0 {
+		t.Fatalf("after delete got %d posts", len(posts))
+	}
+	expectStatus(t, ts.do("DELETE", "/api/posts/"+id, alice.Token, nil), http.StatusNotFound)
+}
+
+func TestCreatePostValidation(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+
+	tests := []struct {
+		name string
+		body map[string]interface{}
+		want int
+	}{
+		{"missing body", map[string]interface{}{"title": "t"}, http.StatusBadRequest},
+		{"unknown status", map[string]interface{}{"title": "t", "body": "b", "status": "hidden"}, http.StatusBadRequest},
+		{"scheduled without publishAt", map[string]interface{}{"title": "t", "body": "b", "status": "scheduled"}, http.StatusBadRequest},
+		{"scheduled in the past", map[string]interface{}{
+			"title": "t", "body": "b", "status": "scheduled",
+			"publishAt": ts.clock.Now().Add(-time.Hour),
+		}, http.StatusBadRequest},
+		{"publishAt without scheduling", map[string]interface{}{
+			"title": "t", "body": "b",
+			"publishAt": ts.clock.Now().Add(time.Hour),
+		}, http.StatusBadRequest},
+		{"sealed in the past", map[string]interface{}{
+			"title": "t", "body": "b",
+			"sealedUntil": ts.clock.Now().Add(-time.Hour),
+		}, http.StatusBadRequest},
+		{"unknown metric", map[string]interface{}{
+			"title": "t", "body": "b",
+			"metrics": []map[string]interface{}{{"metricId": "7b0c1f6e-5d1a-4e9b-9a51-3c2a4c1d2e3f", "value": 1}},
+		}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, ts.do("POST", "/api/posts", alice.Token, tt.body), tt.want)
+		})
+	}
+}
+
+func TestPostQuotas(t *testing.T) {
+	ts := newTestServer(t)
+	ts.app.Config.Plans.Free.MaxPosts = 1
+	ts.app.Config.Plans.Free.MaxBodyBytes = 16
+	alice := ts.signUp("alice")
+
+	rec := ts.do("POST", "/api/posts", alice.Token, map[string]interface{}{
+		"title": "Long",
+		"body":  strings.Repeat("a", 17),
+	})
+	expectStatus(t, rec, http.StatusRequestEntityTooLarge)
+
+	// Far larger requests are cut off while they're read.
+	rec = ts.do("POST", "/api/posts", alice.Token, map[string]interface{}{
+		"title": "Huge",
+		"body":  strings.Repeat("a", 1<<20),
+	})
+	expectStatus(t, rec, http.StatusRequestEntityTooLarge)
+	if !strings.Contains(rec.Body.String(), "Request body is too large") {
+		t.Errorf("oversized request answered with %s", rec.Body)
+	}
+
+	ts.createPost(alice, map[string]interface{}{"title": "One", "body": "short"})
+	rec = ts.do("POST", "/api/posts", alice.Token, map[string]interface{}{"title": "Two", "body": "short"})
+	expectStatus(t, rec, http.StatusPaymentRequired)
+}
+
+func TestPostsOfOtherUsers(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+	bob := ts.signUp("bob")
+
+	id := ts.createPost(alice, map[string]interface{}{"title": "Mine", "body": "Private", "status": "draft"})
+
+	expectStatus(t, ts.do("GET", "/api/posts/user/alice", bob.Token, nil), http.StatusForbidden)
+	expectStatus(t, ts.do("PUT", "/api/posts/"+id, bob.Token, map[string]interface{}{
+		"title": "Stolen",
+		"body":  "Overwritten",
+	}), http.StatusNotFound)
+	expectStatus(t, ts.do("PUT", "/api/posts/"+id+"/autosave", bob.Token, map[string]string{
+		"body": "Overwritten",
+	}), http.StatusNotFound)
+	expectStatus(t, ts.do("DELETE", "/api/posts/"+id, bob.Token, nil), http.StatusNotFound)
+	expectStatus(t, ts.do("PUT", "/api/posts/not-a-uuid", bob.Token, map[string]interface{}{
+		"title": "t",
+		"body":  "b",
+	}), http.StatusNotFound)
+
+	post := ts.findPost(alice, id)
+	if post == nil || post.Title != "Mine" || post.Body != "Private" {
+		t.Fatalf("alice's post = %+v, want it untouched", post)
+	}
+
+	rec := ts.do("GET", "/api/posts", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if strings.Contains(rec.Body.String(), id) {
+		t.Error("public index lists a draft")
+	}
+}
+
+func TestAutosaveDraft(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+
+	id := ts.createPost(alice, map[string]interface{}{"title": "Draft", "body": "Start", "status": "draft"})
+	ts.clock.Advance(time.Minute)
+
+	rec := ts.do("PUT", "/api/posts/"+id+"/autosave", alice.Token, map[string]string{"body": "Start, continued"})
+	expectStatus(t, rec, http.StatusOK)
+
+	post := ts.findPost(alice, id)
+	if post == nil || post.Body != "Start, continued" || post.Title != "Draft" {
+		t.Fatalf("after autosave got %+v", post)
+	}
+	if post.AutosavedAt == nil {
+		t.Error("autosavedAt not set")
+	}
+
+	rec = ts.do("PUT", "/api/posts/"+id+"/autosave", alice.Token, map[string]string{"transcript": "words"})
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestScheduledPostPublishes(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+
+	id := ts.createPost(alice, map[string]interface{}{
+		"title":     "Later",
+		"body":      "Not yet",
+		"status":    "scheduled",
+		"publishAt": ts.clock.Now().Add(time.Hour),
+	})
+
+	// Sending only a new publishAt reschedules the post.
+	expectStatus(t, ts.do("PUT", "/api/posts/"+id, alice.Token, map[string]interface{}{
+		"title":     "Later",
+		"body":      "Not yet",
+		"publishAt": ts.clock.Now().Add(3 * time.Hour),
+	}), http.StatusOK)
+
+	ts.clock.Advance(2 * time.Hour)
+	if n, err := ts.svc.PublishDuePosts(ts.clock.Now()); err != nil || n != 0 {
+		t.Fatalf("PublishDuePosts before publishAt = %d, %v", n, err)
+	}
+	ts.clock.Advance(2 * time.Hour)
+	if n, err := ts.svc.PublishDuePosts(ts.clock.Now()); err != nil || n != 1 {
+		t.Fatalf("PublishDuePosts after publishAt = %d, %v", n, err)
+	}
+
+	if post := ts.findPost(alice, id); post == nil || post.Status != "published" {
+		t.Fatalf("after publishing got %+v", post)
+	}
+
+	// A published post can't be rescheduled without saying so.
+	expectStatus(t, ts.do("PUT", "/api/posts/"+id, alice.Token, map[string]interface{}{
+		"title":     "Later",
+		"body":      "Not yet",
+		"publishAt": ts.clock.Now().Add(time.Hour),
+	}), http.StatusBadRequest)
+}
+
+func TestSealedPost(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+
+	id := ts.createPost(alice, map[string]interface{}{
+		"title":       "Capsule",
+		"body":        "Hello from the past",
+		"sealedUntil": ts.clock.Now().Add(48 * time.Hour),
+	})
+
+	post := ts.findPost(alice, id)
+	if post == nil || !post.Sealed || post.Title != "" || post.Body != "" {
+		t.Fatalf("sealed post = %+v, want its content withheld", post)
+	}
+	expectStatus(t, ts.do("PUT", "/api/posts/"+id, alice.Token, map[string]interface{}{
+		"title": "Peek",
+		"body":  "Peek",
+	}), http.StatusConflict)
+
+	rec := ts.do("GET", "/api/posts/search?q=past", alice.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if strings.Contains(rec.Body.String(), id) {
+		t.Error("search finds a sealed post")
+	}
+
+	ts.clock.Advance(49 * time.Hour)
+	ts.login(alice)
+	if n, err := ts.svc.NotifyUnsealedPosts(ts.clock.Now()); err != nil || n != 1 {
+		t.Fatalf("NotifyUnsealedPosts = %d, %v", n, err)
+	}
+	ts.deliver()
+	if msgs := ts.mailer.Messages(); len(msgs) == 0 || msgs[len(msgs)-1].To[0] != alice.Email {
+		t.Error("no unseal email sent")
+	}
+
+	post = ts.findPost(alice, id)
+	if post == nil || post.Sealed || post.Body != "Hello from the past" {
+		t.Fatalf("unsealed post = %+v", post)
+	}
+}
+
+func TestSearchPosts(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+	bob := ts.signUp("bob")
+
+	id := ts.createPost(alice, map[string]interface{}{"title": "Hiking", "body": "Walked up the mountain"})
+	ts.createPost(alice, map[string]interface{}{"title": "Cooking", "body": "Made soup"})
+	ts.createPost(bob, map[string]interface{}{"title": "Mountain", "body": "Bob's mountain"})
+
+	expectStatus(t, ts.do("GET", "/api/posts/search?q=+", alice.Token, nil), http.StatusBadRequest)
+
+	rec := ts.do("GET", "/api/posts/search?q=MOUNTAIN", alice.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var res struct {
+		Data []postJSON `json:"data"`
+	}
+	decode(t, rec, &res)
+	if len(res.Data) != 1 || res.Data[0].ID != id {
+		t.Fatalf("search = %+v, want only alice's hiking post", res.Data)
+	}
+}
+
+func TestOnThisDay(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+
+	id := ts.createPost(alice, map[string]interface{}{"title": "Today", "body": "Written today"})
+
+	now := ts.clock.Now().UTC()
+	later := now.AddDate(1, 0, 0)
+	if later.Day() != now.Day() {
+		later = now.AddDate(4, 0, 0) // 29 February
+	}
+
+	expectStatus(t, ts.do("GET", "/api/posts/on-this-day?date=tomorrow", alice.Token, nil), http.StatusBadRequest)
+
+	rec := ts.do("GET", "/api/posts/on-this-day?date="+later.Format("2006-01-02"), alice.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var res struct {
+		Data []postJSON `json:"data"`
+	}
+	decode(t, rec, &res)
+	if len(res.Data) != 1 || res.Data[0].ID != id {
+		t.Fatalf("on this day a year later = %+v, want the post", res.Data)
+	}
+
+	rec = ts.do("GET", "/api/posts/on-this-day", alice.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	res.Data = nil
+	decode(t, rec, &res)
+	if len(res.Data) != 0 {
+		t.Fatalf("on this day today = %+v, want nothing from this year", res.Data)
+	}
+}
+
+// mp3Fixture returns frames MPEG-1 Layer III frames at 128 kbps and
+// 44.1 kHz, 417 bytes each.
+func mp3Fixture(frames int) []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+	return bytes.Repeat(frame, frames)
+}
+
+func TestVoicePost(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+
+	rec := ts.upload("POST", "/api/posts/voice", alice.Token, "audio", "note.mp3", []byte("not audio at all"), nil)
+	expectStatus(t, rec, http.StatusUnsupportedMediaType)
+
+	rec = ts.upload("POST", "/api/posts/voice", alice.Token, "audio", "note.mp3", mp3Fixture(10), map[string]string{
+		"transcript": "remember the milk",
+	})
+	expectStatus(t, rec, http.StatusCreated)
+	var res struct {
+		Post postJSON `json:"post"`
+	}
+	decode(t, rec, &res)
+	post := res.Post
+	if post.Kind != "voice" || post.Title != "Voice note" || post.Transcript != "remember the milk" {
+		t.Errorf("voice post = %+v", post)
+	}
+	if post.Audio == nil || post.Audio.DurationMs != 260 {
+		t.Fatalf("audio = %+v, want 260ms", post.Audio)
+	}
+
+	rec = ts.do("GET", post.Audio.URL, alice.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if !bytes.Equal(rec.Body.Bytes(), mp3Fixture(10)) {
+		t.Error("downloaded recording differs from the upload")
+	}
+
+	rec = ts.do("PUT", "/api/posts/"+post.ID, alice.Token, map[string]interface{}{
+		"title":      "Shopping",
+		"transcript": "remember the oat milk",
+	})
+	expectStatus(t, rec, http.StatusOK)
+
+	rec = ts.do("GET", "/api/posts/search?q=oat", alice.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if !strings.Contains(rec.Body.String(), post.ID) {
+		t.Error("search doesn't match the transcript")
+	}
+}
+
+func TestUsernameRedirect(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.signUp("alice")
+	bob := ts.signUp("bob")
+	ts.createPost(alice, map[string]interface{}{"title": "t", "body": "b"})
+
+	expectStatus(t, ts.do("PUT", "/api/account/change-username", alice.Token, map[string]string{
+		"username": "alicia",
+	}), http.StatusOK)
+
+	rec := ts.do("GET", "/api/posts/user/alice", alice.Token, nil)
+	expectStatus(t, rec, http.StatusTemporaryRedirect)
+	if loc := rec.Header().Get("Location"); loc != "/api/posts/user/alicia" {
+		t.Errorf("Location = %q", loc)
+	}
+
+	// Others aren't told the new name.
+	rec = ts.do("GET", "/api/posts/user/alice", bob.Token, nil)
+	expectStatus(t, rec, http.StatusForbidden)
+	if loc := rec.Header().Get("Location"); loc != "" || strings.Contains(rec.Body.String(), "alicia") {
+		t.Errorf("bob was sent to %q: %s", loc, rec.Body)
+	}
+
+	alice.Username = "alicia"
+	if posts := ts.listPosts(alice); len(posts) != 1 {
+		t.Fatalf("got %d posts under the new name", len(posts))
+	}
+}
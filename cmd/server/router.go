@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io"
+	"time"
+
+	"github.com/cheeszy/journaling/controllers"
+	"github.com/cheeszy/journaling/middleware"
+	"github.com/cheeszy/journaling/services"
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// newRouter sets up every route of the API on top of svc.
+func newRouter(svc *services.Service) *gin.Engine {
+	users := controllers.NewUserHandler(svc)
+	posts := controllers.NewPostHandler(svc)
+	attachments := controllers.NewAttachmentHandler(svc)
+	covers := controllers.NewCoverHandler(svc)
+	metrics := controllers.NewMetricHandler(svc)
+	exports := controllers.NewExportHandler(svc)
+	books := controllers.NewBookHandler(svc)
+	imports := controllers.NewImportHandler(svc)
+	stats := controllers.NewStatsHandler(svc)
+	admin := controllers.NewAdminHandler(svc)
+	health := controllers.NewHealthHandler(svc)
+
+	router := gin.New()
+	router.Use(middleware.RequestID, middleware.AccessLog)
+	router.Use(gin.CustomRecoveryWithWriter(io.Discard, middleware.Recover))
+	router.Use(cors.New(cors.Config{
+		AllowOrigins:     []string{svc.Config.FEDomain},
+		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", middleware.RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", middleware.RequestIDHeader},
+		AllowCredentials: true,
+		MaxAge:           12 * time.Hour,
+	}))
+
+	// ===== Probes =====
+	router.GET("/healthz", health.Healthz)
+	router.GET("/readyz", health.Readyz)
+
+	// ===== Public Routes =====
+	public := router.Group("/api")
+	{
+		public.POST("/register", users.Register)
+		public.POST("/login", users.Login)
+		public.POST("/resend-verification", users.ResendVerificationEmail)
+		public.POST("/reset-password", users.ResetPasswordWithRecoveryKey)
+		public.POST("/recovery-key/confirm", users.ConfirmRecoveryKey)
+		public.POST("/recovery-key/kit", users.DownloadRecoveryKit)
+
+		public.GET("/verify", users.VerifyEmail)
+		public.GET("/account/email-change/confirm", users.ConfirmEmailChange)
+		public.GET("/account/email-change/cancel", users.CancelEmailChange)
+		public.GET("/account/export/download", exports.DataExportDownload)
+		public.GET("/monkeytype", posts.MonkeyAPI)
+		public.GET("/posts", posts.PostsIndex)
+
+		// Optional/Commented routes
+		// public.GET("/posts/:id", posts.PostsShowById)
+		// public.GET("/users", users.Users)
+	}
+
+	// ===== Protected Routes =====
+	protected := router.Group("/api")
+	protected.Use(middleware.RequireAuth(svc.App))
+	protected.Use(middleware.RequireRLS(svc.App))
+	{
+		protected.GET("/posts/user/:username", posts.PostsShowAllPosts)
+		protected.GET("/posts/on-this-day", posts.PostsOnThisDay)
+		protected.GET("/posts/search", posts.PostsSearch)
+		protected.POST("/posts", posts.PostsCreate)
+		protected.POST("/posts/voice", posts.PostsCreateVoice)
+		protected.PUT("/posts/:id", posts.PostsUpdate)
+		protected.PUT("/posts/:id/autosave", posts.PostsAutosave)
+		protected.DELETE("/posts/:id", posts.PostsDelete)
+		protected.POST("/posts/:id/attachments", attachments.AttachmentsCreate)
+		protected.GET("/posts/:id/attachments", attachments.AttachmentsIndex)
+		protected.GET("/posts/:id/attachments/:attachmentId", attachments.AttachmentsDownload)
+		protected.DELETE("/posts/:id/attachments/:attachmentId", attachments.AttachmentsDelete)
+		protected.PUT("/posts/:id/cover", covers.PostsSetCover)
+		protected.DELETE("/posts/:id/cover", covers.PostsDeleteCover)
+		protected.GET("/posts/:id/cover", covers.PostsShowCover)
+		protected.GET("/posts/:id/cover/:size", covers.PostsShowCover)
+
+		protected.GET("/metrics", metrics.MetricsIndex)
+		protected.POST("/metrics", metrics.MetricsCreate)
+		protected.DELETE("/metrics/:id", metrics.MetricsDelete)
+		protected.GET("/metrics/:id/series", metrics.MetricsSeries)
+
+		protected.POST("/logout", users.Logout)
+		protected.GET("/user", users.GetCurrentUser)
+		protected.GET("/", controllers.HomeHandler)
+
+		protected.PUT("/account/change-username", users.ChangeUsername)
+		protected.PUT("/account/change-email", users.ChangeEmail)
+		protected.PUT("/account/change-timezone", users.ChangeTimezone)
+		protected.PUT("/account/digest", users.UpdateDigestSettings)
+		protected.DELETE("/account", users.DeleteAccount)
+		protected.GET("/account/usage", users.AccountUsage)
+		protected.POST("/account/export", exports.DataExportCreate)
+		protected.GET("/account/export/:id", exports.DataExportShow)
+		protected.GET("/account/export/book", books.BookExport)
+
+		protected.POST("/import", imports.ImportCreate)
+		protected.GET("/import/:id", imports.ImportShow)
+
+		protected.GET("/stats", stats.StatsShow)
+	}
+
+	// ===== Admin Routes =====
+	adminGroup := router.Group("/api/admin")
+	adminGroup.Use(middleware.RequireAuth(svc.App))
+	adminGroup.Use(middleware.RequireAdmin)
+	{
+		adminGroup.GET("/email-outbox", admin.AdminOutboxIndex)
+		adminGroup.GET("/email-outbox/:id", admin.AdminOutboxShow)
+		adminGroup.POST("/email-outbox/:id/retry", admin.AdminOutboxRetry)
+		adminGroup.PUT("/users/:id/plan", admin.AdminUpdateUserPlan)
+	}
+
+	router.NoRoute(controllers.NotFoundHandler)
+	return router
+}
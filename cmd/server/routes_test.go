@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// publicRoutes need no token; every other route does.
+var publicRoutes = map[string]bool{
+	"GET /healthz":                          true,
+	"GET /readyz":                           true,
+	"POST /api/register":                    true,
+	"POST /api/login":                       true,
+	"POST /api/resend-verification":         true,
+	"POST /api/reset-password":              true,
+	"POST /api/recovery-key/confirm":        true,
+	"POST /api/recovery-key/kit":            true,
+	"GET /api/verify":                       true,
+	"GET /api/account/email-change/confirm": true,
+	"GET /api/account/email-change/cancel":  true,
+	"GET /api/account/export/download":      true,
+	"GET /api/monkeytype":                   true,
+	"GET /api/posts":                        true,
+}
+
+// fillParams turns a route pattern into a path, with a random UUID for each
+// parameter.
+func fillParams(pattern string) string {
+	parts := strings.Split(pattern, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") {
+			parts[i] = uuid.NewString()
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+func signToken(t *testing.T, secret string, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestProtectedRoutesRequireAuth(t *testing.T) {
+	ts := newTestServer(t)
+	u := ts.signUp("alice")
+
+	secret := ts.app.Config.JWTSecret.Value()
+	exp := ts.clock.Now().Add(time.Hour).Unix()
+	tokens := map[string]string{
+		"no token":     "",
+		"garbage":      "not-a-jwt",
+		"wrong secret": signToken(t, "other-secret", jwt.MapClaims{"sub": u.ID.String(), "exp": exp}),
+		"missing sub":  signToken(t, secret, jwt.MapClaims{"exp": exp}),
+		"invalid sub":  signToken(t, secret, jwt.MapClaims{"sub": "alice", "exp": exp}),
+		"unknown user": signToken(t, secret, jwt.MapClaims{"sub": uuid.NewString(), "exp": exp}),
+		"expired":      signToken(t, secret, jwt.MapClaims{"sub": u.ID.String(), "exp": ts.clock.Now().Add(-time.Minute).Unix()}),
+	}
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"sub": u.ID.String(), "exp": exp}).
+		SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens["none algorithm"] = none
+
+	protected := 0
+	for _, route := range ts.router.Routes() {
+		key := route.Method + " " + route.Path
+		if publicRoutes[key] {
+			continue
+		}
+		protected++
+		path := fillParams(route.Path)
+
+		for name, token := range tokens {
+			rec := ts.do(route.Method, path, token, nil)
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("%s with %s: status %d, want 401", key, name, rec.Code)
+			}
+		}
+	}
+	if protected == 0 {
+		t.Fatal("no protected routes found")
+	}
+}
+
+func TestTokenExpiresAfterADay(t *testing.T) {
+	ts := newTestServer(t)
+	u := ts.signUp("alice")
+
+	expectStatus(t, ts.do("GET", "/api/user", u.Token, nil), http.StatusOK)
+	ts.clock.Advance(24*time.Hour + time.Minute)
+	expectStatus(t, ts.do("GET", "/api/user", u.Token, nil), http.StatusUnauthorized)
+}
+
+func TestTokenCookie(t *testing.T) {
+	ts := newTestServer(t)
+	u := ts.signUp("alice")
+
+	req := httptest.NewRequest("GET", "/api/user", nil)
+	req.AddCookie(&http.Cookie{Name: "token", Value: u.Token})
+	expectStatus(t, ts.serve(req, ""), http.StatusOK)
+}
+
+func TestAdminRoutesRequireAdmin(t *testing.T) {
+	ts := newTestServer(t)
+	u := ts.signUp("alice")
+
+	for _, route := range ts.router.Routes() {
+		if !strings.HasPrefix(route.Path, "/api/admin/") {
+			continue
+		}
+		rec := ts.do(route.Method, fillParams(route.Path), u.Token, nil)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s %s as a regular user: status %d, want 403", route.Method, route.Path, rec.Code)
+		}
+	}
+}
+
+func TestHomeAndNotFound(t *testing.T) {
+	ts := newTestServer(t)
+	u := ts.signUp("alice")
+
+	expectStatus(t, ts.do("GET", "/api/", u.Token, nil), http.StatusOK)
+	expectStatus(t, ts.do("GET", "/api/nothing-here", "", nil), http.StatusNotFound)
+}
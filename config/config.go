@@ -0,0 +1,168 @@
+// Package config loads the server's settings from defaults, an optional
+// YAML file, a .env file and the environment, in increasing precedence.
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Secret is a string that is redacted whenever it's printed, logged or
+// marshalled. Use Value to read it.
+type Secret string
+
+const redacted = "[redacted]"
+
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return `"` + s.String() + `"`
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Config holds every setting of the server. The env tag names the
+// environment variable that overrides a field, the yaml tag its key in the
+// config file.
+type Config struct {
+	Port     int    `yaml:"port" env:"PORT"`
+	Domain   string `yaml:"domain" env:"DOMAIN"`
+	FEDomain string `yaml:"fe_domain" env:"FE_DOMAIN"`
+	// LogLevel is debug, info, warn or error.
+	LogLevel string `yaml:"log_level" env:"LOG_LEVEL"`
+
+	DatabaseURL          Secret `yaml:"db_url" env:"DB_URL"`
+	JWTSecret            Secret `yaml:"jwt_secret" env:"JWT_SECRET"`
+	ContentEncryptionKey Secret `yaml:"content_encryption_key" env:"CONTENT_ENCRYPTION_KEY"`
+	MonkeytypeAPIKey     Secret `yaml:"monkeytype_api_key" env:"MONKEYTYPE_API_KEY"`
+	MonkeytypeURL        string `yaml:"monkeytype_url" env:"MONKEYTYPE_URL"`
+
+	HTTP    HTTPConfig    `yaml:"http"`
+	Mailer  MailerConfig  `yaml:"mailer"`
+	Storage StorageConfig `yaml:"storage"`
+	Plans   PlansConfig   `yaml:"plans"`
+
+	ImportDir         string `yaml:"import_dir" env:"IMPORT_DIR"`
+	ExportDir         string `yaml:"export_dir" env:"EXPORT_DIR"`
+	CoverDir          string `yaml:"cover_dir" env:"COVER_DIR"`
+	CoverKeepMetadata bool   `yaml:"cover_keep_metadata" env:"COVER_KEEP_METADATA"`
+
+	ReservedUsernames      []string      `yaml:"reserved_usernames" env:"RESERVED_USERNAMES"`
+	UsernameChangeCooldown time.Duration `yaml:"username_change_cooldown" env:"USERNAME_CHANGE_COOLDOWN"`
+	UsernameRedirectGrace  time.Duration `yaml:"username_redirect_grace" env:"USERNAME_REDIRECT_GRACE"`
+	AccountDeletionGrace   time.Duration `yaml:"account_deletion_grace" env:"ACCOUNT_DELETION_GRACE"`
+	ExportLinkTTL          time.Duration `yaml:"export_link_ttl" env:"EXPORT_LINK_TTL"`
+}
+
+// HTTPConfig bounds how long the server spends on a connection. A zero
+// read, write or idle timeout means no limit.
+type HTTPConfig struct {
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"HTTP_READ_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT"`
+	// ShutdownTimeout is how long in-flight requests and background jobs
+	// get to finish after SIGTERM.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"HTTP_SHUTDOWN_TIMEOUT"`
+}
+
+type MailerConfig struct {
+	// Backend is "smtp", "file" to write .eml files to Dir, or "memory".
+	Backend string     `yaml:"backend" env:"MAILER_BACKEND"`
+	Dir     string     `yaml:"dir" env:"MAILER_DIR"`
+	From    string     `yaml:"from" env:"EMAIL_FROM"`
+	SMTP    SMTPConfig `yaml:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host" env:"SMTP_HOST"`
+	Port     string `yaml:"port" env:"SMTP_PORT"`
+	Username string `yaml:"username" env:"SMTP_USERNAME"`
+	Password Secret `yaml:"password" env:"EMAIL_PASSWORD"`
+	Security string `yaml:"security" env:"SMTP_SECURITY"`
+	Auth     string `yaml:"auth" env:"SMTP_AUTH"`
+}
+
+type StorageConfig struct {
+	// Backend is "local" to keep files in Dir, "s3" or "memory".
+	Backend string   `yaml:"backend" env:"STORAGE_BACKEND"`
+	Dir     string   `yaml:"dir" env:"STORAGE_DIR"`
+	S3      S3Config `yaml:"s3"`
+}
+
+type S3Config struct {
+	Endpoint        string `yaml:"endpoint" env:"S3_ENDPOINT"`
+	Region          string `yaml:"region" env:"S3_REGION"`
+	Bucket          string `yaml:"bucket" env:"S3_BUCKET"`
+	AccessKeyID     string `yaml:"access_key_id" env:"S3_ACCESS_KEY_ID"`
+	SecretAccessKey Secret `yaml:"secret_access_key" env:"S3_SECRET_ACCESS_KEY"`
+	PathStyle       bool   `yaml:"path_style" env:"S3_PATH_STYLE"`
+}
+
+type PlansConfig struct {
+	Free PlanLimits `yaml:"free" env:"PLAN_FREE"`
+	Pro  PlanLimits `yaml:"pro" env:"PLAN_PRO"`
+}
+
+// PlanLimits are read from <PLAN>_MAX_POSTS and so on, for example
+// PLAN_FREE_MAX_POSTS.
+type PlanLimits struct {
+	MaxPosts     int64 `yaml:"max_posts" env:"MAX_POSTS"`
+	MaxBytes     int64 `yaml:"max_bytes" env:"MAX_BYTES"`
+	MaxBodyBytes int64 `yaml:"max_body_bytes" env:"MAX_BODY_BYTES"`
+}
+
+// Default returns the settings used for anything that isn't configured.
+func Default() Config {
+	return Config{
+		Port:          3000,
+		LogLevel:      "info",
+		MonkeytypeURL: "https://api.monkeytype.com",
+		// Uploads and exports stream large bodies, so reads and writes get
+		// minutes rather than seconds.
+		HTTP: HTTPConfig{
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       5 * time.Minute,
+			WriteTimeout:      5 * time.Minute,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Mailer: MailerConfig{
+			Backend: "smtp",
+			Dir:     "tmp/mail",
+		},
+		Storage: StorageConfig{
+			Backend: "local",
+			Dir:     "data/blobs",
+		},
+		Plans: PlansConfig{
+			Free: PlanLimits{MaxPosts: 2_000, MaxBytes: 500 << 20, MaxBodyBytes: 64 << 10},
+			Pro:  PlanLimits{MaxPosts: 100_000, MaxBytes: 20 << 30, MaxBodyBytes: 1 << 20},
+		},
+		ImportDir:              filepath.Join(os.TempDir(), "journaling-imports"),
+		ExportDir:              filepath.Join(os.TempDir(), "journaling-exports"),
+		CoverDir:               "data/covers",
+		UsernameChangeCooldown: 30 * 24 * time.Hour,
+		UsernameRedirectGrace:  90 * 24 * time.Hour,
+		AccountDeletionGrace:   14 * 24 * time.Hour,
+		ExportLinkTTL:          72 * time.Hour,
+	}
+}
+
+// Addr is the address the HTTP server listens on.
+func (c *Config) Addr() string {
+	return ":" + strconv.Itoa(c.Port)
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Load builds the configuration. path names a YAML file; when it's empty
+// the CONFIG_FILE variable is used, and without either no file is read.
+// Variables from .env never override ones already in the environment.
+//
+// The returned Config is filled in even when validation fails, so it can
+// still be printed; the error is then a *ValidationError.
+func Load(path string) (*Config, error) {
+	if _, err := os.Stat(".env"); err == nil {
+		if err := godotenv.Load(); err != nil {
+			return nil, fmt.Errorf("loading .env: %w", err)
+		}
+	} else {
+		slog.Info(".env file not found, skipping loading env file")
+	}
+
+	cfg := Default()
+
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading config file: %w", err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	}
+
+	var problems []string
+	applyEnv(reflect.ValueOf(&cfg).Elem(), "", &problems)
+	problems = append(problems, cfg.validate()...)
+	if len(problems) > 0 {
+		return &cfg, &ValidationError{Problems: problems}
+	}
+	return &cfg, nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyEnv overrides fields from the variables named by their env tags.
+// Nested structs without a tag share their parent's prefix; with one, it's
+// prepended to their fields' names.
+func applyEnv(v reflect.Value, prefix string, problems *[]string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, tagged := field.Tag.Lookup("env")
+		if tagged && prefix != "" {
+			name = prefix + "_" + name
+		}
+		value := v.Field(i)
+
+		if field.Type.Kind() == reflect.Struct {
+			next := prefix
+			if tagged {
+				next = name
+			}
+			applyEnv(value, next, problems)
+			continue
+		}
+		if !tagged {
+			continue
+		}
+		raw, ok := os.LookupEnv(name)
+		if !ok || raw == "" {
+			continue
+		}
+		if err := setField(value, raw); err != nil {
+			*problems = append(*problems, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+}
+
+func setField(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 72h", raw)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", raw)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", raw)
+		}
+		v.SetInt(n)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// YAML returns the configuration as YAML, with secrets redacted.
+func (c *Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c)
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/cheeszy/journaling/encryption"
+	"github.com/cheeszy/journaling/logging"
+)
+
+// ValidationError lists every setting that is missing or invalid, so they
+// can all be fixed at once.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+func (c *Config) validate() []string {
+	var problems []string
+	required := func(name, value string) {
+		if value == "" {
+			problems = append(problems, name+" is required")
+		}
+	}
+	absoluteURL := func(name, value string) {
+		required(name, value)
+		if value == "" {
+			return
+		}
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("%s must be an http(s) URL, got %q", name, value))
+		}
+	}
+	nonNegative := func(name string, value int64) {
+		if value < 0 {
+			problems = append(problems, name+" must not be negative")
+		}
+	}
+	positive := func(name string, value int64) {
+		if value <= 0 {
+			problems = append(problems, name+" must be greater than zero")
+		}
+	}
+
+	if c.Port < 1 || c.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("PORT must be between 1 and 65535, got %d", c.Port))
+	}
+	positive("HTTP_READ_HEADER_TIMEOUT", int64(c.HTTP.ReadHeaderTimeout))
+	nonNegative("HTTP_READ_TIMEOUT", int64(c.HTTP.ReadTimeout))
+	nonNegative("HTTP_WRITE_TIMEOUT", int64(c.HTTP.WriteTimeout))
+	nonNegative("HTTP_IDLE_TIMEOUT", int64(c.HTTP.IdleTimeout))
+	positive("HTTP_SHUTDOWN_TIMEOUT", int64(c.HTTP.ShutdownTimeout))
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		problems = append(problems, fmt.Sprintf("LOG_LEVEL must be debug, info, warn or error, got %q", c.LogLevel))
+	}
+	absoluteURL("DOMAIN", c.Domain)
+	absoluteURL("FE_DOMAIN", c.FEDomain)
+	absoluteURL("MONKEYTYPE_URL", c.MonkeytypeURL)
+	required("DB_URL", c.DatabaseURL.Value())
+	required("JWT_SECRET", c.JWTSecret.Value())
+
+	if c.ContentEncryptionKey == "" {
+		problems = append(problems, "CONTENT_ENCRYPTION_KEY is required")
+	} else if key, err := base64.StdEncoding.DecodeString(c.ContentEncryptionKey.Value()); err != nil || len(key) != encryption.KeySize {
+		problems = append(problems, "CONTENT_ENCRYPTION_KEY must be 32 bytes encoded as base64")
+	}
+
+	switch c.Mailer.Backend {
+	case "smtp":
+		required("SMTP_HOST", c.Mailer.SMTP.Host)
+		required("SMTP_PORT", c.Mailer.SMTP.Port)
+		required("EMAIL_FROM", c.Mailer.From)
+	case "file":
+		required("MAILER_DIR", c.Mailer.Dir)
+	case "memory":
+	default:
+		problems = append(problems, fmt.Sprintf("MAILER_BACKEND must be smtp, file or memory, got %q", c.Mailer.Backend))
+	}
+
+	switch c.Storage.Backend {
+	case "local":
+		required("STORAGE_DIR", c.Storage.Dir)
+	case "s3":
+		required("S3_REGION", c.Storage.S3.Region)
+		required("S3_BUCKET", c.Storage.S3.Bucket)
+		required("S3_ACCESS_KEY_ID", c.Storage.S3.AccessKeyID)
+		required("S3_SECRET_ACCESS_KEY", c.Storage.S3.SecretAccessKey.Value())
+	case "memory":
+	default:
+		problems = append(problems, fmt.Sprintf("STORAGE_BACKEND must be local, s3 or memory, got %q", c.Storage.Backend))
+	}
+
+	for _, plan := range []struct {
+		name   string
+		limits PlanLimits
+	}{{"PLAN_FREE", c.Plans.Free}, {"PLAN_PRO", c.Plans.Pro}} {
+		positive(plan.name+"_MAX_POSTS", plan.limits.MaxPosts)
+		positive(plan.name+"_MAX_BYTES", plan.limits.MaxBytes)
+		positive(plan.name+"_MAX_BODY_BYTES", plan.limits.MaxBodyBytes)
+	}
+
+	required("IMPORT_DIR", c.ImportDir)
+	required("EXPORT_DIR", c.ExportDir)
+	required("COVER_DIR", c.CoverDir)
+	nonNegative("USERNAME_CHANGE_COOLDOWN", int64(c.UsernameChangeCooldown))
+	nonNegative("USERNAME_REDIRECT_GRACE", int64(c.UsernameRedirectGrace))
+	nonNegative("ACCOUNT_DELETION_GRACE", int64(c.AccountDeletionGrace))
+	nonNegative("EXPORT_LINK_TTL", int64(c.ExportLinkTTL))
+
+	return problems
+}
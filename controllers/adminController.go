@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/cheeszy/journaling/dto"
+	"github.com/cheeszy/journaling/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AdminHandler struct {
+	svc *services.Service
+}
+
+func NewAdminHandler(svc *services.Service) *AdminHandler {
+	return &AdminHandler{svc: svc}
+}
+
+func (h *AdminHandler) AdminOutboxIndex(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	emails, err := h.svc.GetOutboxEmails(c.Query("status"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"emails": emails})
+}
+
+func (h *AdminHandler) AdminOutboxShow(c *gin.Context) {
+	email, err := h.svc.GetOutboxEmail(c.Param("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Email not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"email": email})
+}
+
+func (h *AdminHandler) AdminOutboxRetry(c *gin.Context) {
+	ok, err := h.svc.RetryOutboxEmail(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No dead-lettered email with this ID"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Email queued for retry"})
+}
+
+func (h *AdminHandler) AdminUpdateUserPlan(c *gin.Context) {
+	var req dto.UpdatePlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	usage, err := h.svc.ChangePlan(c.Param("id"), req.Plan)
+	if errors.Is(err, services.ErrUnknownPlan) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"usage": usage})
+}
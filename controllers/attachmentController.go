@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+
+	"github.com/cheeszy/journaling/models"
+	"github.com/cheeszy/journaling/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AttachmentHandler struct {
+	svc *services.Service
+}
+
+func NewAttachmentHandler(svc *services.Service) *AttachmentHandler {
+	return &AttachmentHandler{svc: svc}
+}
+
+// postFileError writes the response for errors shared by the attachment
+// handlers and reports whether err was one of them.
+func postFileError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+	case errors.Is(err, services.ErrPostSealed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		return false
+	}
+	return true
+}
+
+func (h *AttachmentHandler) AttachmentsCreate(c *gin.Context) {
+	u := c.MustGet("user").(models.User)
+
+	limitRequestBody(c, services.AttachmentRequestMaxBytes)
+	file, err := c.FormFile("file")
+	if requestTooLarge(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A file is required in the \"file\" field"})
+		return
+	}
+
+	attachment, err := h.svc.CreateAttachment(c.Request.Context(), c.Param("id"), u.ID, file)
+	if errors.Is(err, services.ErrAttachmentTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+	if quotaError(c, err) {
+		return
+	}
+	if postFileError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"attachment": attachment})
+}
+
+func (h *AttachmentHandler) AttachmentsIndex(c *gin.Context) {
+	u := c.MustGet("user").(models.User)
+
+	attachments, err := h.svc.GetAttachments(c.Param("id"), u.ID)
+	if postFileError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": attachments})
+}
+
+func (h *AttachmentHandler) AttachmentsDownload(c *gin.Context) {
+	u := c.MustGet("user").(models.User)
+
+	attachment, content, err := h.svc.OpenAttachment(c.Request.Context(), c.Param("id"), c.Param("attachmentId"), u.ID)
+	if postFileError(c, err) {
+		return
+	}
+	defer content.Close()
+
+	disposition := "attachment"
+	if services.IsInlineContentType(attachment.ContentType) {
+		disposition = "inline"
+	}
+	c.Header("Content-Type", attachment.ContentType)
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "private, no-store")
+	http.ServeContent(c.Writer, c.Request, attachment.Filename, attachment.CreatedAt, content)
+}
+
+func (h *AttachmentHandler) AttachmentsDelete(c *gin.Context) {
+	u := c.MustGet("user").(models.User)
+
+	err := h.svc.DeleteAttachment(c.Request.Context(), c.Param("id"), c.Param("attachmentId"), u.ID)
+	if errors.Is(err, services.ErrVoiceRecording) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if postFileError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted"})
+}
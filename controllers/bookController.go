@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	"github.com/cheeszy/journaling/book"
+	"github.com/cheeszy/journaling/models"
+	"github.com/cheeszy/journaling/services"
+	"github.com/gin-gonic/gin"
+)
+
+type BookHandler struct {
+	svc *services.Service
+}
+
+func NewBookHandler(svc *services.Service) *BookHandler {
+	return &BookHandler{svc: svc}
+}
+
+func (h *BookHandler) BookExport(c *gin.Context) {
+	u := c.MustGet("user").(models.User)
+
+	format := c.DefaultQuery("format", "epub")
+	if format != "epub" && format != "html" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be epub or html"})
+		return
+	}
+
+	b, err := h.svc.BuildBook(u, c.Query("from"), c.Query("to"))
+	if errors.Is(err, services.ErrInvalidBookRange) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrBookEmpty) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var buf bytes.Buffer
+	contentType := "application/epub+zip"
+	if format == "html" {
+		contentType = "text/html; charset=utf-8"
+		err = book.WriteHTML(&buf, b)
+	} else {
+		err = book.WriteEPUB(&buf, b)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	first, last := b.Chapters[0].ID, b.Chapters[len(b.Chapters)-1].ID
+	filename := "journal-" + first + "-to-" + last + "." + format
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/cheeszy/journaling/models"
+	"github.com/cheeszy/journaling/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CoverHandler struct {
+	svc *services.Service
+}
+
+func NewCoverHandler(svc *services.Service) *CoverHandler {
+	return &CoverHandler{svc: svc}
+}
+
+func (h *CoverHandler) PostsSetCover(c *gin.Context) {
+	u := c.MustGet("user").(models.User)
+
+	limitRequestBody(c, services.CoverRequestMaxBytes)
+	file, err := c.FormFile("file")
+	if requestTooLarge(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An image is required in the \"file\" field"})
+		return
+	}
+
+	cover, err := h.svc.SetPostCover(c.Param("id"), u.ID, file)
+	if errors.Is(err, services.ErrCoverTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrCoverFormat) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	}
+	if quotaError(c, err) {
+		return
+	}
+	if postFileError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"cover": cover})
+}
+
+func (h *CoverHandler) PostsDeleteCover(c *gin.Context) {
+	u := c.MustGet("user").(models.User)
+
+	err := h.svc.DeletePostCover(c.Param("id"), u.ID)
+	if errors.Is(err, services.ErrNoCover) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if postFileError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Cover photo removed"})
+}
+
+func (h *CoverHandler) PostsShowCover(c *gin.Context) {
+	u := c.MustGet("user").(models.User)
+
+	file, post, err := h.svc.OpenPostCover(c.Param("id"), u, c.Param("size"))
+	if errors.Is(err, services.ErrNoCover) || errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cover photo not found"})
+		return
+	}
+	if postFileError(c, err) {
+		return
+	}
+	defer file.Close()
+
+	c.Header("Content-Type", post.CoverContentType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "private, no-cache")
+	http.ServeContent(c.Writer, c.Request, file.Name(), *post.CoverUpdatedAt, file)
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/cheeszy/journaling/models"
+	"github.com/cheeszy/journaling/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ExportHandler struct {
+	svc *services.Service
+}
+
+func NewExportHandler(svc *services.Service) *ExportHandler {
+	return &ExportHandler{svc: svc}
+}
+
+func (h *ExportHandler) DataExportCreate(c *gin.Context) {
+	u := c.MustGet("user").(models.User)
+
+	export, err := h.svc.RequestDataExport(u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Export started. We'll email you a download link when it's ready.",
+		"export":  export,
+	})
+}
+
+func (h *ExportHandler) DataExportShow(c *gin.Context) {
+	u := c.MustGet("user").(models.User)
+
+	export, err := h.svc.GetDataExport(c.Param("id"), u.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"export": export})
+}
+
+func (h *ExportHandler) DataExportDownload(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token is required"})
+		return
+	}
+
+	export, file, err := h.svc.OpenDataExport(token)
+	if err != nil {
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	filename := "journal-export-" + export.CreatedAt.Format("2006-01-02") + ".zip"
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Cache-Control", "no-store")
+	http.ServeContent(c.Writer, c.Request, filename, *export.CompletedAt, file)
+}
@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/cheeszy/journaling/services"
+	"github.com/gin-gonic/gin"
+)
+
+// readinessTimeout bounds all readiness checks together, so a hung
+// dependency fails the probe instead of stalling it.
+const readinessTimeout = 5 * time.Second
+
+type HealthHandler struct {
+	svc *services.Service
+}
+
+func NewHealthHandler(svc *services.Service) *HealthHandler {
+	return &HealthHandler{svc: svc}
+}
+
+// Healthz answers as long as the process can serve HTTP. It checks no
+// dependencies, so an outage of one doesn't get every instance restarted.
+func (h *HealthHandler) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz reports whether the instance should receive traffic.
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	checks, ready := h.svc.CheckReadiness(ctx)
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "checks": checks})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "checks": checks})
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/cheeszy/journaling/models"
+	"github.com/cheeszy/journaling/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ImportHandler struct {
+	svc *services.Service
+}
+
+func NewImportHandler(svc *services.Service) *ImportHandler {
+	return &ImportHandler{svc: svc}
+}
+
+func (h *ImportHandler) ImportCreate(c *gin.Context) {
+	u := c.MustGet("user").(models.User)
+
+	limitRequestBody(c, services.ImportRequestMaxBytes)
+	file, err := c.FormFile("file")
+	if requestTooLarge(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A zip archive is required in the \"file\" field"})
+		return
+	}
+
+	job, err := h.svc.RequestImport(u.ID, file)
+	if errors.Is(err, services.ErrImportTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrImportNotZip) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Import started. Check its status to follow progress.",
+		"import":  job,
+	})
+}
+
+func (h *ImportHandler) ImportShow(c *gin.Context) {
+	u := c.MustGet("user").(models.User)
+
+	job, err := h.svc.GetImportJob(c.Param("id"), u.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"import": job})
+}
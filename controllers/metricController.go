@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/cheeszy/journaling/dto"
+	"github.com/cheeszy/journaling/models"
+	"github.com/cheeszy/journaling/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type MetricHandler struct {
+	svc *services.Service
+}
+
+func NewMetricHandler(svc *services.Service) *MetricHandler {
+	return &MetricHandler{svc: svc}
+}
+
+func (h *MetricHandler) MetricsIndex(c *gin.Context) {
+	u := c.MustGet("user").(models.User)
+
+	metrics, err := h.svc.GetMetrics(u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"metrics": metrics})
+}
+
+func (h *MetricHandler) MetricsCreate(c *gin.Context) {
+	var req dto.CreateMetricRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	u := c.MustGet("user").(models.User)
+
+	metric, err := h.svc.CreateMetric(u.ID, req)
+	if errors.Is(err, services.ErrInvalidMetricRange) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A metric with this name already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"metric": metric})
+}
+
+func (h *MetricHandler) MetricsDelete(c *gin.Context) {
+	u := c.MustGet("user").(models.User)
+
+	if err := h.svc.DeleteMetric(c.Param("id"), u.ID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Deleted"})
+}
+
+func (h *MetricHandler) MetricsSeries(c *gin.Context) {
+	u := c.MustGet("user").(models.User)
+
+	series, err := h.svc.GetMetricSeries(c.Param("id"), u.ID, c.Query("from"), c.Query("to"), c.Query("bucket"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Metric not found"})
+		return
+	}
+	if errors.Is(err, services.ErrInvalidSeriesQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, series)
+}
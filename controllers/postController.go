@@ -1,29 +1,80 @@
 package controllers
 
 import (
+	"errors"
 	"io"
 	"net/http"
-	"os"
+	"net/url"
+	"strings"
 
+	"github.com/cheeszy/journaling/audio"
 	"github.com/cheeszy/journaling/dto"
 	"github.com/cheeszy/journaling/models"
 	"github.com/cheeszy/journaling/services"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+type PostHandler struct {
+	svc *services.Service
+}
+
+func NewPostHandler(svc *services.Service) *PostHandler {
+	return &PostHandler{svc: svc}
+}
+
 func NotFoundHandler(c *gin.Context) {
 	c.JSON(http.StatusNotFound, gin.H{
 		"error": "URL not found.",
 	})
 }
 
-func PostsCreate(c *gin.Context) {
-	var req dto.CreatePostRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
-		return
+func isInvalidPostInput(err error) bool {
+	return errors.Is(err, services.ErrPublishAtRequired) ||
+		errors.Is(err, services.ErrPublishAtUnscheduled) ||
+		errors.Is(err, services.ErrSealedUntilPast) ||
+		errors.Is(err, services.ErrUnknownMetric) ||
+		errors.Is(err, services.ErrInvalidMetricValue) ||
+		errors.Is(err, services.ErrNotVoiceEntry)
+}
+
+// quotaError writes the response for plan limit errors and reports whether
+// err was one: 413 for an oversized body and 402 once a quota is used up.
+func quotaError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrBodyTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case services.IsQuotaError(err):
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+	default:
+		return false
+	}
+	return true
+}
+
+// limitRequestBody makes reading more than n bytes of the request body fail.
+func limitRequestBody(c *gin.Context, n int64) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, n)
+}
+
+// requestTooLarge writes a 413 when err came from reading past the limit
+// set by limitRequestBody, and reports whether it did.
+func requestTooLarge(c *gin.Context, err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(err, &maxBytesErr) {
+		return false
 	}
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body is too large"})
+	return true
+}
 
+// renderRequested reports whether the client asked for bodies rendered to
+// HTML with ?render=html.
+func renderRequested(c *gin.Context) bool {
+	return c.Query("render") == "html"
+}
+
+func (h *PostHandler) PostsCreate(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
@@ -31,7 +82,71 @@ func PostsCreate(c *gin.Context) {
 	}
 	u := user.(models.User)
 
-	post, err := services.CreatePost(req, u.ID)
+	limitRequestBody(c, h.svc.PostRequestMaxBytes(u.Plan))
+	var req dto.CreatePostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if requestTooLarge(c, err) {
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	post, err := h.svc.CreatePost(req, u.ID)
+	if isInvalidPostInput(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if quotaError(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if renderRequested(c) {
+		h.svc.RenderPostBody(post)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"post": post})
+}
+
+func (h *PostHandler) PostsCreateVoice(c *gin.Context) {
+	u := c.MustGet("user").(models.User)
+
+	limitRequestBody(c, services.AttachmentRequestMaxBytes+h.svc.PostRequestMaxBytes(u.Plan))
+	var req dto.CreateVoicePostRequest
+	if err := c.ShouldBind(&req); err != nil {
+		if requestTooLarge(c, err) {
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	file, err := c.FormFile("audio")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A recording is required in the \"audio\" field"})
+		return
+	}
+
+	post, err := h.svc.CreateVoicePost(c.Request.Context(), req, u.ID, file)
+	if errors.Is(err, audio.ErrUnsupported) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, audio.ErrMalformed) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrAttachmentTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+	if quotaError(c, err) {
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -40,56 +155,162 @@ func PostsCreate(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"post": post})
 }
 
-func PostsShowById(c *gin.Context) {
+func (h *PostHandler) PostsSearch(c *gin.Context) {
+	u := c.MustGet("user").(models.User)
+
+	posts, err := h.svc.SearchPosts(u.ID, c.Query("q"))
+	if errors.Is(err, services.ErrEmptySearch) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if renderRequested(c) {
+		h.svc.RenderPostBodies(posts)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": posts})
+}
+
+func (h *PostHandler) PostsShowById(c *gin.Context) {
 	id := c.Param("id")
-	post, err := services.GetPostByID(id)
+	post, err := h.svc.GetPostByID(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
+	if renderRequested(c) {
+		h.svc.RenderPostBody(post)
+	}
 	c.JSON(http.StatusOK, gin.H{"post": post})
 }
 
-func PostsShowAllPosts(c *gin.Context) {
+func (h *PostHandler) PostsShowAllPosts(c *gin.Context) {
 	username := c.Param("username")
 	userInToken := c.MustGet("user").(models.User)
 
-	if userInToken.Username != username {
+	if !strings.EqualFold(userInToken.Username, username) {
+		// Old usernames keep working for a while after a rename, for the
+		// renamed user only; anyone else would learn the new name.
+		if current, ok := h.svc.ResolveUsernameRedirect(username); ok && current.ID == userInToken.ID {
+			c.Redirect(http.StatusTemporaryRedirect, "/api/posts/user/"+url.PathEscape(current.Username))
+			return
+		}
+
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
 		return
 	}
 
-	posts, err := services.GetPostsByUsername(username)
+	posts, err := h.svc.GetPostsByUsername(username)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 
+	if renderRequested(c) {
+		h.svc.RenderPostBodies(posts)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"data": posts})
 }
 
-func PostsUpdate(c *gin.Context) {
+func (h *PostHandler) PostsUpdate(c *gin.Context) {
 	id := c.Param("id")
+	u := c.MustGet("user").(models.User)
 
+	limitRequestBody(c, h.svc.PostRequestMaxBytes(u.Plan))
 	var req dto.UpdatePostRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
+		if requestTooLarge(c, err) {
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	post, err := h.svc.UpdatePost(id, u.ID, req)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+	if isInvalidPostInput(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if quotaError(c, err) {
+		return
+	}
+	if errors.Is(err, services.ErrPostSealed) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if renderRequested(c) {
+		h.svc.RenderPostBody(post)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"post": post})
+}
+
+func (h *PostHandler) PostsAutosave(c *gin.Context) {
+	id := c.Param("id")
+	u := c.MustGet("user").(models.User)
+
+	limitRequestBody(c, h.svc.PostRequestMaxBytes(u.Plan))
+	var req dto.AutosavePostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if requestTooLarge(c, err) {
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
 
-	post, err := services.UpdatePost(id, req)
+	post, err := h.svc.AutosavePost(id, u.ID, req)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+	if errors.Is(err, services.ErrNotVoiceEntry) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrNotAutosavable) || errors.Is(err, services.ErrPostSealed) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if quotaError(c, err) {
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	if renderRequested(c) {
+		h.svc.RenderPostBody(post)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"post": post})
 }
 
-func PostsDelete(c *gin.Context) {
+func (h *PostHandler) PostsDelete(c *gin.Context) {
 	id := c.Param("id")
+	u := c.MustGet("user").(models.User)
 
-	if err := services.DeletePost(id); err != nil {
+	err := h.svc.DeletePost(c.Request.Context(), id, u.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -97,19 +318,42 @@ func PostsDelete(c *gin.Context) {
 	c.JSON(http.StatusAccepted, gin.H{"message": "Deleted"})
 }
 
-func PostsIndex(c *gin.Context) {
-	posts, err := services.GetAllPosts()
+func (h *PostHandler) PostsIndex(c *gin.Context) {
+	posts, err := h.svc.GetAllPosts()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if renderRequested(c) {
+		h.svc.RenderPostBodies(posts)
+	}
 	c.JSON(http.StatusOK, gin.H{"posts": posts})
 }
 
-func MonkeyAPI(c *gin.Context) {
-	apiKey := os.Getenv("MONKEYTYPE_API_KEY")
+func (h *PostHandler) PostsOnThisDay(c *gin.Context) {
+	u := c.MustGet("user").(models.User)
+
+	posts, err := h.svc.GetOnThisDay(u, c.Query("date"))
+	if errors.Is(err, services.ErrInvalidDate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if renderRequested(c) {
+		h.svc.RenderPostBodies(posts)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": posts})
+}
+
+func (h *PostHandler) MonkeyAPI(c *gin.Context) {
+	apiKey := h.svc.Config.MonkeytypeAPIKey.Value()
 
-	req, _ := http.NewRequest("GET", "https://api.monkeytype.com/users/personalBests?mode=time", nil)
+	req, _ := http.NewRequest("GET", h.svc.Config.MonkeytypeURL+"/users/personalBests?mode=time", nil)
 	req.Header.Add("Authorization", "ApeKey "+apiKey)
 
 	client := &http.Client{}
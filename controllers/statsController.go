@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/cheeszy/journaling/models"
+	"github.com/cheeszy/journaling/services"
+	"github.com/gin-gonic/gin"
+)
+
+type StatsHandler struct {
+	svc *services.Service
+}
+
+func NewStatsHandler(svc *services.Service) *StatsHandler {
+	return &StatsHandler{svc: svc}
+}
+
+func (h *StatsHandler) StatsShow(c *gin.Context) {
+	u := c.MustGet("user").(models.User)
+
+	year := 0
+	if value := c.Query("year"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1970 || parsed > 9999 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year"})
+			return
+		}
+		year = parsed
+	}
+
+	stats, err := h.svc.GetStats(u, year)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
@@ -1,38 +1,71 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/cheeszy/journaling/dto"
-	"github.com/cheeszy/journaling/initializers"
 	"github.com/cheeszy/journaling/models"
 	"github.com/cheeszy/journaling/services"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
-func Register(c *gin.Context) {
+type UserHandler struct {
+	svc *services.Service
+}
+
+func NewUserHandler(svc *services.Service) *UserHandler {
+	return &UserHandler{svc: svc}
+}
+
+func (h *UserHandler) Register(c *gin.Context) {
 	var input dto.RegisterRequest
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	recoveryKey, err := services.RegisterUser(input)
+	recoveryKey, err := h.svc.RegisterUser(input)
+	if status, ok := usernameErrorStatus(err); ok {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrAlreadyRegistered) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	c.Header("Cache-Control", "no-store")
 	c.JSON(http.StatusOK, gin.H{
-		"message":     "User registered. Please check your email to verify your account.",
-		"recoveryKey": recoveryKey,
+		"message": "User registered. Please check your email to verify your account. " +
+			"Save your recovery key now: it is shown only once and must be confirmed before you can log in.",
+		"recoveryKey":             recoveryKey,
+		"recoveryKeySuffixLength": services.RecoveryKeySuffixLength,
 	})
 }
 
-func Users(c *gin.Context) {
+// usernameErrorStatus maps username policy errors to an HTTP status.
+func usernameErrorStatus(err error) (int, bool) {
+	switch {
+	case errors.Is(err, services.ErrUsernameInvalid),
+		errors.Is(err, services.ErrUsernameReserved),
+		errors.Is(err, services.ErrUsernameUnchanged):
+		return http.StatusBadRequest, true
+	case errors.Is(err, services.ErrUsernameTaken),
+		errors.Is(err, services.ErrUsernameUnavailable):
+		return http.StatusConflict, true
+	}
+	return 0, false
+}
+
+func (h *UserHandler) Users(c *gin.Context) {
 	var users []models.User
-	initializers.DB.Find(&users)
+	h.svc.DB.Find(&users)
 
 	//Respond with them
 	c.JSON(200, gin.H{
@@ -40,14 +73,18 @@ func Users(c *gin.Context) {
 	})
 }
 
-func Login(c *gin.Context) {
+func (h *UserHandler) Login(c *gin.Context) {
 	var input dto.LoginRequest
 	if err := c.BindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
 
-	tokenString, expiresAt, err := services.LoginUser(input)
+	tokenString, expiresAt, err := h.svc.LoginUser(input)
+	if errors.Is(err, services.ErrRecoveryKeyPending) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "recoveryKeyPending": true})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
@@ -59,39 +96,39 @@ func Login(c *gin.Context) {
 		"expires_in": expiresAt,
 	})
 }
-func Logout(c *gin.Context) {
+func (h *UserHandler) Logout(c *gin.Context) {
 	c.SetCookie("token", "", -1, "/", "", true, true)
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
-func VerifyEmail(c *gin.Context) {
+func (h *UserHandler) VerifyEmail(c *gin.Context) {
 	token := c.Query("token")
 	if token == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Token is required"})
 		return
 	}
 
-	if err := services.VerifyUserEmail(token); err != nil {
+	if err := h.svc.VerifyUserEmail(token); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
 }
-func GetCurrentUser(c *gin.Context) {
+func (h *UserHandler) GetCurrentUser(c *gin.Context) {
 	user := c.MustGet("user")
 
 	c.JSON(200, user)
 }
 
-func ResendVerificationEmail(c *gin.Context) {
+func (h *UserHandler) ResendVerificationEmail(c *gin.Context) {
 	var input dto.ResendVerificationRequest
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	res, err := services.ResendVerificationEmail(input.Email)
+	res, err := h.svc.ResendVerificationEmail(input.Email)
 	if err != nil {
 		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
 		return
@@ -100,14 +137,18 @@ func ResendVerificationEmail(c *gin.Context) {
 	c.JSON(http.StatusOK, res)
 }
 
-func ResetPasswordWithRecoveryKey(c *gin.Context) {
+func (h *UserHandler) ResetPasswordWithRecoveryKey(c *gin.Context) {
 	var input dto.ResetPasswordRequest
 	if err := c.BindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
 
-	user, err := services.ResetPassword(input)
+	user, err := h.svc.ResetPassword(input)
+	if errors.Is(err, services.ErrInvalidRecoveryKey) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -119,7 +160,54 @@ func ResetPasswordWithRecoveryKey(c *gin.Context) {
 	})
 }
 
-func ChangeUsername(c *gin.Context) {
+func (h *UserHandler) ConfirmRecoveryKey(c *gin.Context) {
+	var input dto.ConfirmRecoveryKeyRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.svc.ConfirmRecoveryKey(input)
+	switch {
+	case errors.Is(err, services.ErrInvalidCredentials):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrRecoveryKeyConfirmed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrRecoveryKeyMismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "Recovery key confirmed. Your account is now active."})
+	}
+}
+
+func (h *UserHandler) DownloadRecoveryKit(c *gin.Context) {
+	var input dto.RecoveryKitRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	kit, err := h.svc.BuildRecoveryKit(input)
+	switch {
+	case errors.Is(err, services.ErrInvalidCredentials):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrRecoveryKeyConfirmed):
+		c.JSON(http.StatusGone, gin.H{"error": "The recovery kit is no longer available"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="`+kit.Filename+`"`)
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, kit.ContentType, kit.Data)
+}
+
+func (h *UserHandler) ChangeUsername(c *gin.Context) {
 	var req dto.ChangeUsernameRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request", "error": err.Error()})
@@ -137,7 +225,21 @@ func ChangeUsername(c *gin.Context) {
 		return
 	}
 
-	if err := services.ChangeUsername(userID, req.Username); err != nil {
+	err := h.svc.ChangeUsername(userID, req.Username)
+	var cooldown *services.UsernameCooldownError
+	if errors.As(err, &cooldown) {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"message": "Failed to update username",
+			"error":   err.Error(),
+			"retryAt": cooldown.RetryAt,
+		})
+		return
+	}
+	if status, ok := usernameErrorStatus(err); ok {
+		c.JSON(status, gin.H{"message": "Failed to update username", "error": err.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to update username", "error": err.Error()})
 		return
 	}
@@ -145,7 +247,7 @@ func ChangeUsername(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Username updated successfully"})
 }
 
-func ChangeEmail(c *gin.Context) {
+func (h *UserHandler) ChangeEmail(c *gin.Context) {
 	var req dto.ChangeEmailRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request", "error": err.Error()})
@@ -163,10 +265,133 @@ func ChangeEmail(c *gin.Context) {
 		return
 	}
 
-	if err := services.ChangeEmail(userID, req.Email); err != nil {
+	change, err := h.svc.ChangeEmail(userID, req.Email)
+	if errors.Is(err, services.ErrEmailUnchanged) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Failed to update email", "error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrEmailTaken) {
+		c.JSON(http.StatusConflict, gin.H{"message": "Failed to update email", "error": err.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to update email", "error": err.Error()})
 		return
 	}
 
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":   "Please confirm the change from the link sent to your new email address",
+		"newEmail":  change.NewEmail,
+		"expiresAt": change.ExpiresAt,
+	})
+}
+
+func (h *UserHandler) ConfirmEmailChange(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token is required"})
+		return
+	}
+
+	if err := h.svc.ConfirmEmailChange(token); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrEmailTaken) || errors.Is(err, services.ErrEmailChangeNotActive) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Email updated successfully"})
 }
+
+func (h *UserHandler) CancelEmailChange(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token is required"})
+		return
+	}
+
+	if err := h.svc.CancelEmailChange(token); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrEmailChangeNotActive) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email change cancelled"})
+}
+
+func (h *UserHandler) ChangeTimezone(c *gin.Context) {
+	var req dto.ChangeTimezoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request", "error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	if err := h.svc.ChangeTimezone(userID, req.Timezone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Failed to update timezone", "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Timezone updated successfully"})
+}
+
+func (h *UserHandler) UpdateDigestSettings(c *gin.Context) {
+	var req dto.DigestSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request", "error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	if err := h.svc.UpdateDigestSettings(userID, req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to update digest settings", "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Digest settings updated successfully"})
+}
+
+func (h *UserHandler) DeleteAccount(c *gin.Context) {
+	var req dto.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request", "error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	deleteAt, err := h.svc.ScheduleAccountDeletion(userID, req.Password)
+	if errors.Is(err, services.ErrInvalidPassword) {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Failed to delete account", "error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to delete account", "error": err.Error()})
+		return
+	}
+
+	c.SetCookie("token", "", -1, "/", "", true, true)
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":  "Account scheduled for deletion. Log in before the deletion date to cancel.",
+		"deleteAt": deleteAt,
+	})
+}
+
+func (h *UserHandler) AccountUsage(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	usage, err := h.svc.GetUsage(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"usage": usage})
+}
@@ -8,7 +8,24 @@ type ChangeEmailRequest struct {
 	Email string `json:"email" binding:"required,email"`
 }
 
+type ChangeTimezoneRequest struct {
+	Timezone string `json:"timezone" binding:"required"`
+}
+
+type DigestSettingsRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+	Hour    *int  `json:"hour" binding:"omitempty,min=0,max=23"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
 type ResetPasswordRequest struct {
 	RecoveryKey string `json:"recoveryKey"`
 	NewPassword string `json:"newPassword"`
 }
+
+type UpdatePlanRequest struct {
+	Plan string `json:"plan" binding:"required"`
+}
@@ -0,0 +1,7 @@
+package dto
+
+type AutosavePostRequest struct {
+	Title      *string `json:"title"`
+	Body       *string `json:"body"`
+	Transcript *string `json:"transcript"`
+}
@@ -1,6 +1,12 @@
 package dto
 
+import "time"
+
 type CreatePostRequest struct {
-	Title string `json:"title" binding:"required"`
-	Body  string `json:"body" binding:"required"`
+	Title       string             `json:"title" binding:"required"`
+	Body        string             `json:"body" binding:"required"`
+	Status      string             `json:"status" binding:"omitempty,oneof=draft published scheduled"`
+	PublishAt   *time.Time         `json:"publishAt"`
+	SealedUntil *time.Time         `json:"sealedUntil"`
+	Metrics     []MetricValueInput `json:"metrics" binding:"omitempty,dive"`
 }
@@ -0,0 +1,8 @@
+package dto
+
+// CreateVoicePostRequest holds the form fields sent along with the recording.
+type CreateVoicePostRequest struct {
+	Title      string `form:"title"`
+	Transcript string `form:"transcript"`
+	Status     string `form:"status" binding:"omitempty,oneof=draft published"`
+}
@@ -0,0 +1,16 @@
+package dto
+
+import "github.com/google/uuid"
+
+type CreateMetricRequest struct {
+	Name string   `json:"name" binding:"required,max=50"`
+	Kind string   `json:"kind" binding:"required,oneof=scale number boolean"`
+	Unit string   `json:"unit" binding:"max=20"`
+	Min  *float64 `json:"min"`
+	Max  *float64 `json:"max"`
+}
+
+type MetricValueInput struct {
+	MetricID uuid.UUID `json:"metricId" binding:"required"`
+	Value    float64   `json:"value"`
+}
@@ -0,0 +1,30 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type MetricValueResponse struct {
+	MetricID uuid.UUID `json:"metricId"`
+	Name     string    `json:"name"`
+	Value    float64   `json:"value"`
+}
+
+type MetricSeriesPoint struct {
+	Bucket time.Time `json:"bucket"`
+	Count  int64     `json:"count"`
+	Avg    float64   `json:"avg"`
+	Min    float64   `json:"min"`
+	Max    float64   `json:"max"`
+	Sum    float64   `json:"sum"`
+}
+
+type MetricSeriesResponse struct {
+	MetricID uuid.UUID           `json:"metricId"`
+	Bucket   string              `json:"bucket"`
+	From     time.Time           `json:"from"`
+	To       time.Time           `json:"to"`
+	Points   []MetricSeriesPoint `json:"points"`
+}
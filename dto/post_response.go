@@ -10,11 +10,38 @@ type UserResponse struct {
 	Username string `json:"username"`
 }
 
+type ImageResponse struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+type CoverResponse struct {
+	ImageResponse
+	Thumbnails map[string]ImageResponse `json:"thumbnails"`
+}
+
+type AudioResponse struct {
+	URL        string `json:"url"`
+	DurationMs int64  `json:"durationMs"`
+}
+
 type PostResponse struct {
-	ID        uuid.UUID `json:"id"`
-	Title     string    `json:"title"`
-	Body      string    `json:"body"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID          uuid.UUID             `json:"id"`
+	Kind        string                `json:"kind"`
+	Title       string                `json:"title"`
+	Body        string                `json:"body"`
+	BodyHTML    string                `json:"bodyHtml,omitempty"`
+	Transcript  string                `json:"transcript,omitempty"`
+	Audio       *AudioResponse        `json:"audio,omitempty"`
+	Status      string                `json:"status"`
+	PublishAt   *time.Time            `json:"publishAt,omitempty"`
+	AutosavedAt *time.Time            `json:"autosavedAt,omitempty"`
+	Sealed      bool                  `json:"sealed"`
+	SealedUntil *time.Time            `json:"sealedUntil,omitempty"`
+	Metrics     []MetricValueResponse `json:"metrics,omitempty"`
+	Cover       *CoverResponse        `json:"cover,omitempty"`
+	CreatedAt   time.Time             `json:"createdAt"`
+	UpdatedAt   time.Time             `json:"updatedAt"`
 	// User  UserResponse `json:"user"`
 }
@@ -0,0 +1,13 @@
+package dto
+
+type ConfirmRecoveryKeyRequest struct {
+	Identifier string `json:"identifier" binding:"required"`
+	Password   string `json:"password" binding:"required"`
+	KeySuffix  string `json:"keySuffix" binding:"required"`
+}
+
+type RecoveryKitRequest struct {
+	Identifier string `json:"identifier" binding:"required"`
+	Password   string `json:"password" binding:"required"`
+	Format     string `json:"format" binding:"omitempty,oneof=txt pdf"`
+}
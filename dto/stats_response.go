@@ -0,0 +1,20 @@
+package dto
+
+type StatsDay struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+type StatsResponse struct {
+	Timezone      string  `json:"timezone"`
+	TotalEntries  int     `json:"totalEntries"`
+	TotalWords    int     `json:"totalWords"`
+	AverageWords  float64 `json:"averageWords"`
+	CurrentStreak int     `json:"currentStreak"`
+	LongestStreak int     `json:"longestStreak"`
+	// EntriesPerWeekday is indexed from Sunday (0) to Saturday (6).
+	EntriesPerWeekday [7]int `json:"entriesPerWeekday"`
+	// EntriesPerHour is indexed by the local hour of day (0-23).
+	EntriesPerHour [24]int    `json:"entriesPerHour"`
+	Calendar       []StatsDay `json:"calendar"`
+}
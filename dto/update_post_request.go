@@ -1,6 +1,13 @@
 package dto
 
+import "time"
+
 type UpdatePostRequest struct {
-	Title string `json:"title"`
-	Body  string `json:"body"`
+	Title       string             `json:"title"`
+	Body        string             `json:"body"`
+	Transcript  *string            `json:"transcript"`
+	Status      string             `json:"status" binding:"omitempty,oneof=draft published scheduled"`
+	PublishAt   *time.Time         `json:"publishAt"`
+	SealedUntil *time.Time         `json:"sealedUntil"`
+	Metrics     []MetricValueInput `json:"metrics" binding:"omitempty,dive"`
 }
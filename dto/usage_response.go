@@ -0,0 +1,12 @@
+package dto
+
+type UsageResponse struct {
+	Plan            string `json:"plan"`
+	Posts           int64  `json:"posts"`
+	MaxPosts        int64  `json:"maxPosts"`
+	StoredBytes     int64  `json:"storedBytes"`
+	MaxStoredBytes  int64  `json:"maxStoredBytes"`
+	MaxBodyBytes    int64  `json:"maxBodyBytes"`
+	MaxPostsReached bool   `json:"maxPostsReached"`
+	StorageFull     bool   `json:"storageFull"`
+}
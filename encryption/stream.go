@@ -0,0 +1,262 @@
+package encryption
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Streams are split into chunks that are encrypted separately, so a range
+// of the plaintext can be decrypted without reading what comes before it.
+// Each chunk's nonce is a random per-stream prefix, the chunk index and a
+// flag marking the final chunk, which stops chunks from being reordered or
+// the stream from being truncated. Every chunk also authenticates the
+// stream's additional data, so a chunk from another stream under the same
+// key doesn't decrypt in its place.
+//
+// Layout: magic | nonce prefix | chunk 0 | chunk 1 | ... where every chunk
+// is up to ChunkSize bytes of ciphertext followed by a GCM tag.
+const (
+	ChunkSize  = 64 << 10
+	HeaderSize = len(streamMagic) + prefixSize
+
+	streamMagic = "JNE1"
+	prefixSize  = 7
+	tagSize     = 16
+)
+
+var errBadHeader = errors.New("encryption: not an encrypted stream")
+
+// EncryptedSize returns the size of the stream NewEncryptWriter produces for
+// plainSize bytes of input.
+func EncryptedSize(plainSize int64) int64 {
+	chunks := (plainSize + ChunkSize - 1) / ChunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	return int64(HeaderSize) + plainSize + chunks*tagSize
+}
+
+func chunkNonce(prefix []byte, index int64, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[prefixSize:], uint32(index))
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	prefix []byte
+	ad     []byte
+	buf    []byte
+	index  int64
+	closed bool
+}
+
+// NewEncryptWriter returns a writer that encrypts everything written to it
+// into w. Close must be called to write the final chunk; it doesn't close w.
+// additionalData is authenticated but not stored; the same value must be
+// passed to NewDecryptReader.
+func NewEncryptWriter(w io.Writer, key, additionalData []byte) (io.WriteCloser, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, prefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, streamMagic); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(prefix); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, prefix: prefix, ad: additionalData, buf: make([]byte, 0, ChunkSize)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("encryption: write after close")
+	}
+	n := 0
+	for len(p) > 0 {
+		// A full chunk is only written once more data arrives, since the
+		// last chunk has to be flagged as such.
+		if len(e.buf) == ChunkSize {
+			if err := e.flush(false); err != nil {
+				return n, err
+			}
+		}
+		k := copy(e.buf[len(e.buf):ChunkSize], p)
+		e.buf = e.buf[:len(e.buf)+k]
+		p = p[k:]
+		n += k
+	}
+	return n, nil
+}
+
+func (e *encryptWriter) flush(last bool) error {
+	sealed := e.aead.Seal(nil, chunkNonce(e.prefix, e.index, last), e.buf, e.ad)
+	if _, err := e.w.Write(sealed); err != nil {
+		return err
+	}
+	e.index++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+func (e *encryptWriter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.flush(true)
+}
+
+// RangeOpener returns length bytes of an encrypted stream starting at
+// offset. A negative length reads to the end of the stream.
+type RangeOpener func(offset, length int64) (io.ReadCloser, error)
+
+type decryptReader struct {
+	aead   cipher.AEAD
+	ad     []byte
+	open   RangeOpener
+	size   int64
+	chunks int64
+	prefix []byte
+
+	pos   int64
+	src   io.ReadCloser
+	next  int64 // index of the chunk src is positioned at
+	plain []byte
+	buf   []byte
+}
+
+// NewDecryptReader decrypts a stream of plainSize bytes of plaintext. Data
+// is fetched through open only when read, starting at the chunk that holds
+// the current position, so seeking to the middle of a large stream doesn't
+// download what comes before it.
+func NewDecryptReader(key, additionalData []byte, plainSize int64, open RangeOpener) (io.ReadSeekCloser, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	chunks := (plainSize + ChunkSize - 1) / ChunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	return &decryptReader{aead: aead, ad: additionalData, open: open, size: plainSize, chunks: chunks}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	if d.pos >= d.size {
+		return 0, io.EOF
+	}
+	if len(d.plain) == 0 {
+		if err := d.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	d.pos += int64(n)
+	return n, nil
+}
+
+func (d *decryptReader) readChunk() error {
+	if d.prefix == nil {
+		if err := d.readHeader(); err != nil {
+			return err
+		}
+	}
+
+	index := d.pos / ChunkSize
+	if d.src == nil || d.next != index {
+		d.closeSource()
+		src, err := d.open(int64(HeaderSize)+index*(ChunkSize+tagSize), -1)
+		if err != nil {
+			return err
+		}
+		d.src = src
+		d.next = index
+	}
+
+	plainLen := ChunkSize
+	if remaining := d.size - index*ChunkSize; remaining < ChunkSize {
+		plainLen = int(remaining)
+	}
+	if d.buf == nil {
+		d.buf = make([]byte, ChunkSize+tagSize)
+	}
+	sealed := d.buf[:plainLen+tagSize]
+	if _, err := io.ReadFull(d.src, sealed); err != nil {
+		return err
+	}
+
+	plain, err := d.aead.Open(sealed[:0], chunkNonce(d.prefix, index, index == d.chunks-1), sealed, d.ad)
+	if err != nil {
+		return ErrDecrypt
+	}
+	d.next++
+	d.plain = plain[d.pos-index*ChunkSize:]
+	return nil
+}
+
+func (d *decryptReader) readHeader() error {
+	src, err := d.open(0, int64(HeaderSize))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	header := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return err
+	}
+	if string(header[:len(streamMagic)]) != streamMagic {
+		return errBadHeader
+	}
+	d.prefix = header[len(streamMagic):]
+	return nil
+}
+
+func (d *decryptReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += d.pos
+	case io.SeekEnd:
+		offset += d.size
+	default:
+		return 0, errors.New("encryption: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("encryption: negative position")
+	}
+	if offset != d.pos {
+		// The open source stays usable if the new position is in the
+		// next chunk; readChunk reopens it otherwise.
+		d.plain = nil
+		d.pos = offset
+	}
+	return d.pos, nil
+}
+
+func (d *decryptReader) closeSource() {
+	if d.src != nil {
+		d.src.Close()
+		d.src = nil
+	}
+}
+
+func (d *decryptReader) Close() error {
+	d.closeSource()
+	return nil
+}
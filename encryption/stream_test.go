@@ -0,0 +1,210 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+// encryptStream encrypts plain under key and additionalData.
+func encryptStream(t *testing.T, key, additionalData, plain []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewEncryptWriter(&buf, key, additionalData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if int64(buf.Len()) != EncryptedSize(int64(len(plain))) {
+		t.Fatalf("encrypted %d bytes to %d, EncryptedSize says %d", len(plain), buf.Len(), EncryptedSize(int64(len(plain))))
+	}
+	return buf.Bytes()
+}
+
+// decryptStream returns a reader over sealed, which holds plainSize bytes
+// of plaintext. It counts the ranges it opens in opens.
+func decryptStream(t *testing.T, key, additionalData, sealed []byte, plainSize int64, opens *int) io.ReadSeekCloser {
+	t.Helper()
+	r, err := NewDecryptReader(key, additionalData, plainSize, func(offset, length int64) (io.ReadCloser, error) {
+		if opens != nil {
+			*opens++
+		}
+		if offset > int64(len(sealed)) {
+			offset = int64(len(sealed))
+		}
+		end := int64(len(sealed))
+		if length >= 0 && offset+length < end {
+			end = offset + length
+		}
+		return io.NopCloser(bytes.NewReader(sealed[offset:end])), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	key := randomBytes(t, KeySize)
+	ad := []byte("attachment-1")
+
+	for _, size := range []int{0, 1, ChunkSize - 1, ChunkSize, ChunkSize + 1, 3*ChunkSize + 100} {
+		plain := randomBytes(t, size)
+		sealed := encryptStream(t, key, ad, plain)
+
+		got, err := io.ReadAll(decryptStream(t, key, ad, sealed, int64(size), nil))
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("size %d: round trip changed the data", size)
+		}
+	}
+}
+
+func TestStreamSeek(t *testing.T) {
+	key := randomBytes(t, KeySize)
+	ad := []byte("attachment-1")
+	plain := randomBytes(t, 3*ChunkSize+100)
+	sealed := encryptStream(t, key, ad, plain)
+
+	var offsets []int64
+	for chunk := int64(0); chunk <= 3; chunk++ {
+		boundary := chunk * ChunkSize
+		offsets = append(offsets, boundary)
+		if boundary > 0 {
+			offsets = append(offsets, boundary-1)
+		}
+	}
+	offsets = append(offsets, int64(len(plain)-1))
+
+	for _, offset := range offsets {
+		opens := 0
+		r := decryptStream(t, key, ad, sealed, int64(len(plain)), &opens)
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, 10)
+		n, err := io.ReadFull(r, got)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			t.Fatalf("reading at %d: %v", offset, err)
+		}
+		if want := plain[offset:min(offset+10, int64(len(plain)))]; !bytes.Equal(got[:n], want) {
+			t.Errorf("at %d read %x, want %x", offset, got[:n], want)
+		}
+		// The header and at most the two chunks the read spans.
+		if opens > 3 {
+			t.Errorf("reading at %d opened %d ranges", offset, opens)
+		}
+	}
+
+	r := decryptStream(t, key, ad, sealed, int64(len(plain)), nil)
+	if pos, err := r.Seek(-5, io.SeekEnd); err != nil || pos != int64(len(plain)-5) {
+		t.Fatalf("Seek(-5, SeekEnd) = %d, %v", pos, err)
+	}
+	if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, plain[len(plain)-5:]) {
+		t.Errorf("tail = %x, %v", got, err)
+	}
+	if _, err := r.Seek(-1, io.SeekStart); err == nil {
+		t.Error("seeking before the start succeeded")
+	}
+}
+
+// chunk returns the bounds of chunk i of a sealed stream.
+func chunk(sealed []byte, i int) (int, int) {
+	start := HeaderSize + i*(ChunkSize+tagSize)
+	return start, min(start+ChunkSize+tagSize, len(sealed))
+}
+
+func TestStreamTampering(t *testing.T) {
+	key := randomBytes(t, KeySize)
+	ad := []byte("attachment-1")
+	plain := randomBytes(t, 3*ChunkSize)
+	sealed := encryptStream(t, key, ad, plain)
+	size := int64(len(plain))
+
+	expectDecryptError := func(name string, sealed, ad []byte, size int64) {
+		t.Helper()
+		_, err := io.ReadAll(decryptStream(t, key, ad, sealed, size, nil))
+		if !errors.Is(err, ErrDecrypt) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%s: read err = %v, want an authentication failure", name, err)
+		}
+	}
+
+	flipped := bytes.Clone(sealed)
+	flipped[HeaderSize+ChunkSize+5] ^= 1
+	expectDecryptError("flipped bit", flipped, ad, size)
+
+	reordered := bytes.Clone(sealed)
+	s0, e0 := chunk(sealed, 0)
+	s1, e1 := chunk(sealed, 1)
+	copy(reordered[s0:e0], sealed[s1:e1])
+	copy(reordered[s1:e1], sealed[s0:e0])
+	expectDecryptError("reordered chunks", reordered, ad, size)
+
+	s2, _ := chunk(sealed, 2)
+	expectDecryptError("truncated", sealed[:s2+100], ad, size)
+
+	expectDecryptError("other additional data", sealed, []byte("attachment-2"), size)
+}
+
+func TestStreamLastChunkFlag(t *testing.T) {
+	key := randomBytes(t, KeySize)
+	ad := []byte("attachment-1")
+	plain := randomBytes(t, 3*ChunkSize)
+	sealed := encryptStream(t, key, ad, plain)
+
+	// Cutting the stream at a chunk boundary leaves only whole, valid
+	// chunks. It still fails because chunk 1 wasn't sealed as the last one.
+	_, end := chunk(sealed, 1)
+	r := decryptStream(t, key, ad, sealed[:end], 2*ChunkSize, nil)
+	if _, err := io.ReadAll(r); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("reading a stream cut after chunk 1: %v, want ErrDecrypt", err)
+	}
+
+	// The real last chunk doesn't decrypt as a middle one either.
+	r = decryptStream(t, key, ad, sealed, 4*ChunkSize, nil)
+	if _, err := io.ReadAll(r); !errors.Is(err, ErrDecrypt) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("reading past the last chunk: %v, want an error", err)
+	}
+}
+
+func TestStreamSwappedBlob(t *testing.T) {
+	key := randomBytes(t, KeySize)
+	plain := randomBytes(t, ChunkSize+10)
+	mine := encryptStream(t, key, []byte("attachment-1"), plain)
+	other := encryptStream(t, key, []byte("attachment-2"), randomBytes(t, len(plain)))
+
+	// The other attachment's blob in place of the whole stream.
+	r := decryptStream(t, key, []byte("attachment-1"), other, int64(len(plain)), nil)
+	if _, err := io.ReadAll(r); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("reading another attachment's blob: %v, want ErrDecrypt", err)
+	}
+
+	// A single chunk sealed at the same index, spliced in with this
+	// stream's header.
+	spliced := bytes.Clone(mine)
+	s, e := chunk(mine, 0)
+	copy(spliced[s:e], other[s:e])
+	copy(spliced[len(streamMagic):HeaderSize], other[len(streamMagic):HeaderSize])
+	r = decryptStream(t, key, []byte("attachment-1"), spliced, int64(len(plain)), nil)
+	if _, err := io.ReadAll(r); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("reading a spliced chunk: %v, want ErrDecrypt", err)
+	}
+}
@@ -0,0 +1,99 @@
+// Package logging sets up the server's structured logs: JSON lines through
+// log/slog, tagged with the request and user IDs carried by the context,
+// with email addresses, tokens and passwords redacted.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	userIDKey
+)
+
+// WithRequestID returns a context whose log lines carry the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request ID of ctx, or "" outside a request.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithUserID returns a context whose log lines carry the signed-in user.
+func WithUserID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, userIDKey, id)
+}
+
+// ParseLevel accepts debug, info, warn or error.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+	return level, nil
+}
+
+// New returns a logger writing JSON lines to w. Log with the *Context
+// functions so request and user IDs are included.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(contextHandler{slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactAttr,
+	})})
+}
+
+// contextHandler adds the IDs stored in the context to every record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if id, ok := ctx.Value(userIDKey).(string); ok {
+		r.AddAttrs(slog.String("user_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// sensitiveKeys are attribute names, alone or as the last word of a
+// snake_case name such as new_password, whose values are never logged.
+var sensitiveKeys = []string{"password", "token", "secret", "authorization", "cookie", "recovery_key", "api_key", "email"}
+
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, sensitive := range sensitiveKeys {
+		if key == sensitive || strings.HasSuffix(key, "_"+sensitive) {
+			return slog.String(a.Key, redacted)
+		}
+	}
+
+	switch v := a.Value.Resolve(); v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(v.String()))
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return slog.String(a.Key, Redact(err.Error()))
+		}
+	}
+	return a
+}
@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"sent to alice@example.com", "sent to [redacted]"},
+		{"Authorization: Bearer abc.def", "Authorization: Bearer [redacted]"},
+		{"GET /api/verify?token=s3cr3t&x=1", "GET /api/verify?token=[redacted]&x=1"},
+		{`{"password":"hunter2"}`, `{"password":"[redacted]"}`},
+		{"jwt eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiIxIn0.c2ln here", "jwt [redacted] here"},
+		{"duplicate key value violates unique constraint", "duplicate key value violates unique constraint"},
+	}
+	for _, tt := range tests {
+		if got := Redact(tt.in); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func logLine(t *testing.T, ctx context.Context, msg string, args ...interface{}) map[string]interface{} {
+	t.Helper()
+	var buf bytes.Buffer
+	New(&buf, slog.LevelInfo).InfoContext(ctx, msg, args...)
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("decoding %q: %v", buf.String(), err)
+	}
+	return line
+}
+
+func TestLoggerRedactsAttributes(t *testing.T) {
+	line := logLine(t, context.Background(), "Welcome email for bob@example.com",
+		"email", "bob@example.com",
+		"new_password", "hunter2",
+		"download_token", "abc",
+		"outbox_id", "42",
+		"error", errors.New("550 carol@example.com: no such user"),
+	)
+
+	want := map[string]interface{}{
+		"msg":            "Welcome email for [redacted]",
+		"email":          "[redacted]",
+		"new_password":   "[redacted]",
+		"download_token": "[redacted]",
+		"outbox_id":      "42",
+		"error":          "550 [redacted]: no such user",
+	}
+	for key, value := range want {
+		if line[key] != value {
+			t.Errorf("%s = %v, want %v", key, line[key], value)
+		}
+	}
+}
+
+func TestLoggerAddsContextIDs(t *testing.T) {
+	ctx := WithUserID(WithRequestID(context.Background(), "req-1"), "user-1")
+	line := logLine(t, ctx, "Request")
+	if line["request_id"] != "req-1" || line["user_id"] != "user-1" {
+		t.Errorf("line = %v", line)
+	}
+
+	line = logLine(t, context.Background(), "Worker")
+	if _, ok := line["request_id"]; ok {
+		t.Errorf("line outside a request = %v", line)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if level, err := ParseLevel("warn"); err != nil || level != slog.LevelWarn {
+		t.Errorf("ParseLevel(warn) = %v, %v", level, err)
+	}
+	if _, err := ParseLevel("loud"); err == nil || !strings.Contains(err.Error(), "loud") {
+		t.Errorf("ParseLevel(loud) error = %v", err)
+	}
+}
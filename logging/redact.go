@@ -0,0 +1,23 @@
+package logging
+
+import "regexp"
+
+const redacted = "[redacted]"
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	jwtPattern   = regexp.MustCompile(`eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*`)
+	// bearerPattern and paramPattern keep the name and hide the value, so
+	// "token=abc" stays recognisable as a token.
+	bearerPattern = regexp.MustCompile(`(?i)\b(bearer\s+)\S+`)
+	paramPattern  = regexp.MustCompile(`(?i)\b([a-z_]*(?:token|password|secret|key))(["']?\s*[=:]\s*["']?)[^\s&"',;]+`)
+)
+
+// Redact hides email addresses, JWTs, bearer tokens and values of
+// token=, password= and similar parameters in s.
+func Redact(s string) string {
+	s = emailPattern.ReplaceAllString(s, redacted)
+	s = jwtPattern.ReplaceAllString(s, redacted)
+	s = bearerPattern.ReplaceAllString(s, "${1}"+redacted)
+	return paramPattern.ReplaceAllString(s, "${1}${2}"+redacted)
+}
@@ -0,0 +1,87 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// MemoryMailer keeps sent messages in memory. It's meant for tests and local
+// development where no mail server is available.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns a copy of every message sent so far.
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
+
+// FileMailer writes each message as an .eml file into a directory, so emails
+// can be opened in a mail client during development.
+type FileMailer struct {
+	dir  string
+	from string
+
+	mu  sync.Mutex
+	seq int
+}
+
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if msg.From == "" {
+		msg.From = m.from
+	}
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.seq++
+	name := fmt.Sprintf("%s-%04d.eml", time.Now().UTC().Format("20060102T150405"), m.seq)
+	m.mu.Unlock()
+
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o644)
+}
+
+// Ping checks the directory still exists.
+func (m *FileMailer) Ping(ctx context.Context) error {
+	info, err := os.Stat(m.dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", m.dir)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Message is an email with a plain-text body and an optional HTML alternative.
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers messages. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Pinger is implemented by mailers that can check their backend is
+// reachable without sending anything.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Bytes renders the message as RFC 5322 data. Messages with an HTML body are
+// sent as multipart/alternative so clients can pick the richer part.
+func (m Message) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+
+	header := func(key, value string) {
+		buf.WriteString(key + ": " + value + "\r\n")
+	}
+
+	header("From", m.From)
+	header("To", strings.Join(m.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", messageID(m.From))
+	header("MIME-Version", "1.0")
+
+	if m.HTML == "" {
+		header("Content-Type", `text/plain; charset="utf-8"`)
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, m.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	header("Content-Type", `multipart/alternative; boundary="`+mw.Boundary()+`"`)
+	buf.WriteString("\r\n")
+
+	parts := []struct{ contentType, body string }{
+		{`text/plain; charset="utf-8"`, m.Text},
+		{`text/html; charset="utf-8"`, m.HTML},
+	}
+	for _, part := range parts {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w interface{ Write([]byte) (int, error) }, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func messageID(from string) string {
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = strings.Trim(from[at+1:], "> ")
+	}
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain)
+}
+
+// PermanentError marks a delivery failure that won't succeed on retry, such
+// as a rejected recipient.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return "permanent delivery failure: " + e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// IsPermanent reports whether err is a PermanentError.
+func IsPermanent(err error) bool {
+	var perm *PermanentError
+	return errors.As(err, &perm)
+}
@@ -0,0 +1,225 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"time"
+)
+
+const (
+	SecurityNone     = "none"
+	SecuritySTARTTLS = "starttls"
+	SecurityTLS      = "tls"
+
+	AuthNone    = "none"
+	AuthPlain   = "plain"
+	AuthLogin   = "login"
+	AuthCRAMMD5 = "cram-md5"
+)
+
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	// Security is "tls" for implicit TLS (usually port 465), "starttls" to
+	// upgrade a plain connection, or "none".
+	Security string
+	// Auth is "plain", "login", "cram-md5" or "none".
+	Auth    string
+	Timeout time.Duration
+}
+
+// SMTPMailer sends messages through an SMTP server, opening a new connection
+// for every message.
+type SMTPMailer struct {
+	cfg SMTPConfig
+}
+
+func NewSMTPMailer(cfg SMTPConfig) (*SMTPMailer, error) {
+	if cfg.Host == "" || cfg.Port == "" {
+		return nil, errors.New("smtp host and port are required")
+	}
+	if cfg.Security == "" {
+		cfg.Security = SecuritySTARTTLS
+		if cfg.Port == "465" {
+			cfg.Security = SecurityTLS
+		}
+	}
+	if cfg.Auth == "" {
+		cfg.Auth = AuthPlain
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+
+	switch cfg.Security {
+	case SecurityNone, SecuritySTARTTLS, SecurityTLS:
+	default:
+		return nil, fmt.Errorf("unknown smtp security mode %q", cfg.Security)
+	}
+	switch cfg.Auth {
+	case AuthNone, AuthPlain, AuthLogin, AuthCRAMMD5:
+	default:
+		return nil, fmt.Errorf("unknown smtp auth mechanism %q", cfg.Auth)
+	}
+
+	return &SMTPMailer{cfg: cfg}, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if msg.From == "" {
+		msg.From = m.cfg.From
+	}
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	client, err := m.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := m.authenticate(client); err != nil {
+		return err
+	}
+
+	if err := client.Mail(m.cfg.From); err != nil {
+		return classify(err)
+	}
+	for _, to := range msg.To {
+		if err := client.Rcpt(to); err != nil {
+			return classify(err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return classify(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return classify(err)
+	}
+
+	return client.Quit()
+}
+
+// Ping connects and authenticates to the SMTP server, then hangs up.
+func (m *SMTPMailer) Ping(ctx context.Context) error {
+	client, err := m.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := m.authenticate(client); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// classify marks 5xx replies to the envelope and data commands as permanent.
+// Network errors and 4xx replies are worth retrying.
+func classify(err error) error {
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) && tpErr.Code >= 500 {
+		return &PermanentError{Err: err}
+	}
+	return err
+}
+
+func (m *SMTPMailer) dial(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(m.cfg.Host, m.cfg.Port)
+	tlsConfig := &tls.Config{ServerName: m.cfg.Host}
+
+	dialer := &net.Dialer{Timeout: m.cfg.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(m.cfg.Timeout))
+	}
+
+	if m.cfg.Security == SecurityTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if m.cfg.Security == SecuritySTARTTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, errors.New("smtp server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
+
+func (m *SMTPMailer) authenticate(client *smtp.Client) error {
+	username := m.cfg.Username
+	if username == "" {
+		username = m.cfg.From
+	}
+
+	var auth smtp.Auth
+	switch m.cfg.Auth {
+	case AuthNone:
+		return nil
+	case AuthPlain:
+		auth = smtp.PlainAuth("", username, m.cfg.Password, m.cfg.Host)
+	case AuthLogin:
+		auth = &loginAuth{username: username, password: m.cfg.Password}
+	case AuthCRAMMD5:
+		auth = smtp.CRAMMD5Auth(username, m.cfg.Password)
+	}
+
+	return client.Auth(auth)
+}
+
+// loginAuth implements the non-standard but widely deployed LOGIN mechanism.
+type loginAuth struct {
+	username, password string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS {
+		return "", nil, errors.New("refusing LOGIN auth over an unencrypted connection")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch string(fromServer) {
+	case "Username:":
+		return []byte(a.username), nil
+	case "Password:":
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("unexpected LOGIN challenge %q", fromServer)
+}
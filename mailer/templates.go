@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+//go:embed templates/*.txt templates/*.html
+var templateFS embed.FS
+
+var (
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/*.txt"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/*.html"))
+)
+
+// Render builds a message from the named template pair. name.txt provides the
+// plain-text body and must define a "subject" block; name.html provides the
+// HTML alternative and is rendered inside the shared layout.
+func Render(name string, to string, data interface{}) (Message, error) {
+	var subject, text, html bytes.Buffer
+
+	if err := textTemplates.ExecuteTemplate(&subject, name+".subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := textTemplates.ExecuteTemplate(&text, name+".txt", data); err != nil {
+		return Message{}, err
+	}
+	if err := htmlTemplates.ExecuteTemplate(&html, name+".html", data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		To:      []string{to},
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
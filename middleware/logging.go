@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"time"
+
+	"github.com/cheeszy/journaling/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDPattern limits the IDs accepted from clients, so a header can't
+// smuggle arbitrary text into the logs.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:\-]{1,128}$`)
+
+// RequestID keeps the X-Request-ID sent by the client or a proxy in front of
+// us, or makes one up, echoes it in the response and stores it in the
+// request context for the logs.
+func RequestID(c *gin.Context) {
+	id := c.GetHeader(RequestIDHeader)
+	if !requestIDPattern.MatchString(id) {
+		id = uuid.NewString()
+	}
+	c.Header(RequestIDHeader, id)
+	c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+	c.Next()
+}
+
+// AccessLog logs every request once it's been handled. It leaves out the
+// query string, which may hold tokens.
+func AccessLog(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	status := c.Writer.Status()
+	level := slog.LevelInfo
+	switch {
+	case status >= http.StatusInternalServerError:
+		level = slog.LevelError
+	case status >= http.StatusBadRequest:
+		level = slog.LevelWarn
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", c.Request.Method),
+		slog.String("path", c.Request.URL.Path),
+		slog.String("route", c.FullPath()),
+		slog.Int("status", status),
+		slog.Int("bytes", c.Writer.Size()),
+		slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+		slog.String("client_ip", c.ClientIP()),
+	}
+	if len(c.Errors) > 0 {
+		attrs = append(attrs, slog.String("error", c.Errors.String()))
+	}
+	// c.Request is the one handlers saw, so it carries the user ID once
+	// RequireAuth ran.
+	slog.LogAttrs(c.Request.Context(), level, "Request", attrs...)
+}
+
+// Recover turns a panic in a handler into a 500 and logs it with the stack.
+func Recover(c *gin.Context, err interface{}) {
+	slog.ErrorContext(c.Request.Context(), "Panic while handling request",
+		"panic", err, "stack", string(debug.Stack()))
+	c.AbortWithStatus(http.StatusInternalServerError)
+}
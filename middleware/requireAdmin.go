@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/cheeszy/journaling/models"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAdmin must run after RequireAuth.
+func RequireAdmin(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Unauthorized: User not found in context",
+		})
+		return
+	}
+
+	if !user.(models.User).IsAdmin {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "Forbidden: Admin access required",
+		})
+		return
+	}
+
+	c.Next()
+}
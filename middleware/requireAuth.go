@@ -3,17 +3,24 @@ package middleware
 import (
 	"fmt"
 	"net/http"
-	"os"
 	"strings"
 
-	"github.com/cheeszy/journaling/initializers"
-	"github.com/cheeszy/journaling/models"
+	"github.com/cheeszy/journaling/app"
+	"github.com/cheeszy/journaling/logging"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
-func RequireAuth(c *gin.Context) {
+// RequireAuth loads the user named by the JWT in the Authorization header or
+// the token cookie into the context.
+func RequireAuth(a *app.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requireAuth(a, c)
+	}
+}
+
+func requireAuth(a *app.App, c *gin.Context) {
 	var tokenString string
 
 	// Coba ambil dari Authorization header
@@ -41,8 +48,8 @@ func RequireAuth(c *gin.Context) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method")
 		}
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
+		return []byte(a.Config.JWTSecret.Value()), nil
+	}, jwt.WithTimeFunc(a.Clock.Now))
 
 	if err != nil || !token.Valid {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
@@ -68,16 +75,26 @@ func RequireAuth(c *gin.Context) {
 			return
 		}
 
-		var user models.User
-		if err := initializers.DB.First(&user, "id = ?", userID).Error; err != nil {
+		user, err := a.Users.FindByID(userID)
+		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error": "Unauthorized: User not found",
 			})
 			return
 		}
 
-		c.Set("user", user)
+		// Tokens issued before the account was scheduled for deletion stop
+		// working; logging in again cancels the deletion.
+		if user.DeletionScheduledAt != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Unauthorized: Account is scheduled for deletion, log in again to cancel",
+			})
+			return
+		}
+
+		c.Set("user", *user)
 		c.Set("userID", userID)
+		c.Request = c.Request.WithContext(logging.WithUserID(c.Request.Context(), userID.String()))
 		c.Next()
 		return
 	}
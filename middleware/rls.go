@@ -5,7 +5,7 @@ import (
 
 	"fmt"
 
-	"github.com/cheeszy/journaling/initializers"
+	"github.com/cheeszy/journaling/app"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -16,7 +16,19 @@ func SetCurrentUserDB(db *gorm.DB, userID uuid.UUID) *gorm.DB {
 	return db
 }
 
-func RequireRLS(c *gin.Context) {
+// RequireRLS must run after RequireAuth. It's a no-op without a database,
+// as with the in-memory repositories.
+func RequireRLS(a *app.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if a.DB == nil {
+			c.Next()
+			return
+		}
+		requireRLS(a, c)
+	}
+}
+
+func requireRLS(a *app.App, c *gin.Context) {
 	// grab userID from the context
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -36,7 +48,7 @@ func RequireRLS(c *gin.Context) {
 	}
 
 	// set the current user in the database session
-	db := SetCurrentUserDB(initializers.DB.Session(&gorm.Session{}), userUUID)
+	db := SetCurrentUserDB(a.DB.Session(&gorm.Session{}), userUUID)
 
 	c.Set("db", db)
 	c.Next()
@@ -1,15 +1,148 @@
 package main
 
 import (
-	"github.com/cheeszy/journaling/initializers"
-	"github.com/cheeszy/journaling/models"
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/cheeszy/journaling/app"
+	"github.com/cheeszy/journaling/config"
+	"github.com/cheeszy/journaling/migrations"
 )
 
-func init() {
-	initializers.LoadEnvVariables()
-	initializers.ConnectToDB()
-}
+const usage = `Usage: migrate [flags] <command>
+
+Commands:
+  up             apply every pending migration, then check the schema
+  down [n]       revert the n most recent migrations (default 1)
+  status         list migrations and whether they're applied
+  create <name>  add an empty migration to the migrations directory
+  check          compare the models with the database schema
+
+Flags:
+`
 
 func main() {
-	initializers.DB.AutoMigrate(&models.User{}, &models.Post{}, &models.Comment{})
+	configPath := flag.String("config", "", "path to a YAML config file")
+	dir := flag.String("dir", "migrations", "migrations directory used by create")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// create only writes files, so it works without a database.
+	if args[0] == "create" {
+		if len(args) != 2 {
+			log.Fatal("usage: migrate create <name>")
+		}
+		up, down, err := migrations.Create(*dir, args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("Created", up)
+		fmt.Println("Created", down)
+		return
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := app.OpenDB(cfg.DatabaseURL.Value())
+	if err != nil {
+		log.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	migrator, err := migrations.New(sqlDB)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Println("Applied", m)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("Already up to date")
+		}
+		check(ctx, sqlDB)
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				log.Fatalf("down: %q isn't a positive number", args[1])
+			}
+		}
+		reverted, err := migrator.Down(ctx, n)
+		for _, m := range reverted {
+			fmt.Println("Reverted", m)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			switch {
+			case s.Missing:
+				applied += " (no migration files)"
+			case s.Modified:
+				applied += " (modified since applied)"
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		w.Flush()
+	case "check":
+		check(ctx, sqlDB)
+		fmt.Println("The models match the schema")
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// check exits with an error when the models and the schema differ.
+func check(ctx context.Context, db *sql.DB) {
+	problems, err := migrations.CheckSchema(ctx, db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(problems) == 0 {
+		return
+	}
+	for _, problem := range problems {
+		fmt.Fprintln(os.Stderr, problem)
+	}
+	log.Fatalf("The schema doesn't match the models (%d problems)", len(problems))
 }
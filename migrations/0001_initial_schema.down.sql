@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS attachments;
+DROP TABLE IF EXISTS import_jobs;
+DROP TABLE IF EXISTS data_exports;
+DROP TABLE IF EXISTS username_history;
+DROP TABLE IF EXISTS email_changes;
+DROP TABLE IF EXISTS email_outbox;
+DROP TABLE IF EXISTS metric_values;
+DROP TABLE IF EXISTS metrics;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS posts;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,246 @@
+-- The schema as the old AutoMigrate-based migrate command left it. Every
+-- statement is guarded so databases created that way adopt this migration,
+-- whichever release created them: tables they lack are created, and the
+-- users, posts and attachments tables they have gain the columns added
+-- since.
+
+CREATE TABLE IF NOT EXISTS users (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    username text NOT NULL,
+    username_changed_at timestamptz,
+    email text NOT NULL,
+    password text NOT NULL,
+    recovery_key text DEFAULT NULL,
+    recovery_key_pending boolean DEFAULT false,
+    encrypted_content_key_by_password text,
+    encrypted_content_key_by_recovery text,
+    encrypted_content_key_by_server text DEFAULT NULL,
+    resend_count bigint DEFAULT 0,
+    verification_token text DEFAULT NULL,
+    last_verification_sent_at timestamptz DEFAULT NULL,
+    verification_expires_at timestamptz DEFAULT NULL,
+    is_verified boolean DEFAULT false,
+    is_admin boolean DEFAULT false,
+    timezone text NOT NULL DEFAULT 'UTC',
+    plan varchar(16) NOT NULL DEFAULT 'free',
+    post_count bigint NOT NULL DEFAULT 0,
+    stored_bytes bigint NOT NULL DEFAULT 0,
+    digest_enabled boolean DEFAULT false,
+    digest_hour bigint DEFAULT 8,
+    last_digest_date text DEFAULT NULL,
+    deletion_scheduled_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz
+);
+-- Columns added to users since the first release.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS username_changed_at timestamptz;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS recovery_key_pending boolean DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS encrypted_content_key_by_server text DEFAULT NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin boolean DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone text NOT NULL DEFAULT 'UTC';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS plan varchar(16) NOT NULL DEFAULT 'free';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS post_count bigint NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS stored_bytes bigint NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS digest_enabled boolean DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS digest_hour bigint DEFAULT 8;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_digest_date text DEFAULT NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_scheduled_at timestamptz;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users (username);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+CREATE INDEX IF NOT EXISTS idx_users_deletion_scheduled_at ON users (deletion_scheduled_at);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS posts (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    title text NOT NULL,
+    body text,
+    user_id uuid NOT NULL CONSTRAINT fk_posts_user REFERENCES users (id),
+    kind varchar(16) NOT NULL DEFAULT 'text',
+    transcript text NOT NULL DEFAULT '',
+    audio_attachment_id uuid,
+    audio_duration_ms bigint DEFAULT 0,
+    status varchar(16) NOT NULL DEFAULT 'published',
+    publish_at timestamptz,
+    autosaved_at timestamptz,
+    sealed_until timestamptz,
+    unseal_notified_at timestamptz,
+    cover_key text DEFAULT NULL,
+    cover_content_type text DEFAULT NULL,
+    cover_width bigint DEFAULT 0,
+    cover_height bigint DEFAULT 0,
+    cover_updated_at timestamptz
+);
+-- Columns added to posts since the first release.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS kind varchar(16) NOT NULL DEFAULT 'text';
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS transcript text NOT NULL DEFAULT '';
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS audio_attachment_id uuid;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS audio_duration_ms bigint DEFAULT 0;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS status varchar(16) NOT NULL DEFAULT 'published';
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS publish_at timestamptz;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS autosaved_at timestamptz;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS sealed_until timestamptz;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS unseal_notified_at timestamptz;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS cover_key text DEFAULT NULL;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS cover_content_type text DEFAULT NULL;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS cover_width bigint DEFAULT 0;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS cover_height bigint DEFAULT 0;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS cover_updated_at timestamptz;
+CREATE INDEX IF NOT EXISTS idx_posts_deleted_at ON posts (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_posts_status ON posts (status);
+CREATE INDEX IF NOT EXISTS idx_posts_publish_at ON posts (publish_at);
+CREATE INDEX IF NOT EXISTS idx_posts_sealed_until ON posts (sealed_until);
+-- idx_posts_search is created by 0002_encrypted_post_bodies, since it
+-- leaves encrypted bodies out.
+
+CREATE TABLE IF NOT EXISTS comments (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    content text NOT NULL,
+    user_id uuid NOT NULL CONSTRAINT fk_comments_user REFERENCES users (id),
+    post_id uuid NOT NULL CONSTRAINT fk_comments_post REFERENCES posts (id),
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_comments_deleted_at ON comments (deleted_at);
+
+CREATE TABLE IF NOT EXISTS metrics (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at timestamptz,
+    updated_at timestamptz,
+    user_id uuid NOT NULL,
+    name text NOT NULL,
+    kind varchar(16) NOT NULL,
+    unit text,
+    min decimal,
+    max decimal
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_metrics_user_name ON metrics (user_id, name);
+
+CREATE TABLE IF NOT EXISTS metric_values (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at timestamptz,
+    updated_at timestamptz,
+    user_id uuid NOT NULL,
+    metric_id uuid NOT NULL CONSTRAINT fk_metric_values_metric REFERENCES metrics (id) ON DELETE CASCADE,
+    post_id uuid NOT NULL CONSTRAINT fk_posts_metric_values REFERENCES posts (id),
+    value decimal NOT NULL,
+    recorded_at timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_metric_values_user_id ON metric_values (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_metric_values_metric_post ON metric_values (metric_id, post_id);
+CREATE INDEX IF NOT EXISTS idx_metric_values_post_id ON metric_values (post_id);
+CREATE INDEX IF NOT EXISTS idx_metric_values_recorded_at ON metric_values (recorded_at);
+
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at timestamptz,
+    updated_at timestamptz,
+    user_id uuid,
+    template text NOT NULL,
+    to_address text NOT NULL,
+    subject text NOT NULL,
+    text_body text,
+    html_body text,
+    status varchar(16) NOT NULL DEFAULT 'pending',
+    attempts bigint NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL,
+    last_error text,
+    sent_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_email_outbox_user_id ON email_outbox (user_id);
+CREATE INDEX IF NOT EXISTS idx_email_outbox_template ON email_outbox (template);
+CREATE INDEX IF NOT EXISTS idx_email_outbox_status ON email_outbox (status);
+CREATE INDEX IF NOT EXISTS idx_email_outbox_next_attempt_at ON email_outbox (next_attempt_at);
+
+CREATE TABLE IF NOT EXISTS email_changes (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at timestamptz,
+    updated_at timestamptz,
+    user_id uuid NOT NULL,
+    old_email text NOT NULL,
+    new_email text NOT NULL,
+    confirm_token text NOT NULL,
+    cancel_token text NOT NULL,
+    expires_at timestamptz NOT NULL,
+    confirmed_at timestamptz,
+    cancelled_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_email_changes_user_id ON email_changes (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_email_changes_confirm_token ON email_changes (confirm_token);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_email_changes_cancel_token ON email_changes (cancel_token);
+
+CREATE TABLE IF NOT EXISTS username_history (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at timestamptz,
+    user_id uuid NOT NULL,
+    old_username text NOT NULL,
+    new_username text NOT NULL,
+    reserved_until timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_username_history_user_id ON username_history (user_id);
+CREATE INDEX IF NOT EXISTS idx_username_history_old_username ON username_history (old_username);
+CREATE INDEX IF NOT EXISTS idx_username_history_reserved_until ON username_history (reserved_until);
+
+CREATE TABLE IF NOT EXISTS data_exports (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at timestamptz,
+    updated_at timestamptz,
+    user_id uuid NOT NULL,
+    status varchar(16) NOT NULL DEFAULT 'pending',
+    file_path text,
+    size bigint,
+    download_token text,
+    expires_at timestamptz,
+    completed_at timestamptz,
+    error text
+);
+CREATE INDEX IF NOT EXISTS idx_data_exports_user_id ON data_exports (user_id);
+CREATE INDEX IF NOT EXISTS idx_data_exports_status ON data_exports (status);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_data_exports_download_token ON data_exports (download_token);
+
+CREATE TABLE IF NOT EXISTS import_jobs (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at timestamptz,
+    updated_at timestamptz,
+    user_id uuid NOT NULL,
+    status varchar(16) NOT NULL DEFAULT 'pending',
+    format varchar(16),
+    file_path text,
+    total bigint NOT NULL DEFAULT 0,
+    imported bigint NOT NULL DEFAULT 0,
+    failed bigint NOT NULL DEFAULT 0,
+    errors text,
+    error text,
+    completed_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_import_jobs_user_id ON import_jobs (user_id);
+CREATE INDEX IF NOT EXISTS idx_import_jobs_status ON import_jobs (status);
+
+CREATE TABLE IF NOT EXISTS attachments (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at timestamptz,
+    post_id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    filename text NOT NULL,
+    content_type text NOT NULL,
+    size bigint NOT NULL,
+    storage_key text NOT NULL,
+    duration_ms bigint DEFAULT 0
+);
+-- Voice notes added duration_ms after attachments existed.
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS duration_ms bigint DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_attachments_post_id ON attachments (post_id);
+CREATE INDEX IF NOT EXISTS idx_attachments_user_id ON attachments (user_id);
+
+-- The usage counters were added after posts existed and the old migrate
+-- command recomputed them on every run. Do it once more so adopted
+-- databases start out consistent.
+UPDATE users SET
+    post_count = (SELECT COUNT(*) FROM posts WHERE posts.user_id = users.id AND posts.deleted_at IS NULL),
+    stored_bytes = (SELECT COALESCE(SUM(OCTET_LENGTH(posts.title) + OCTET_LENGTH(COALESCE(posts.body, '')) + OCTET_LENGTH(COALESCE(posts.transcript, ''))), 0)
+            FROM posts WHERE posts.user_id = users.id AND posts.deleted_at IS NULL)
+        + (SELECT COALESCE(SUM(attachments.size), 0) FROM attachments WHERE attachments.user_id = users.id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_posts_search;
+CREATE INDEX idx_posts_search ON posts
+    USING GIN (to_tsvector('simple', title || ' ' || COALESCE(body, '') || ' ' || transcript));
+ALTER TABLE posts DROP COLUMN IF EXISTS body_encrypted;
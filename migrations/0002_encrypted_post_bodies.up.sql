@@ -0,0 +1,8 @@
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS body_encrypted boolean NOT NULL DEFAULT false;
+
+-- Search skips encrypted bodies. Databases created by the old migrate
+-- command have an index over every body, which is replaced. Must index the
+-- same expression as postSearchDocument in repositories/post_repositories.go.
+DROP INDEX IF EXISTS idx_posts_search;
+CREATE INDEX idx_posts_search ON posts
+    USING GIN (to_tsvector('simple', title || ' ' || CASE WHEN body_encrypted THEN '' ELSE COALESCE(body, '') END || ' ' || transcript));
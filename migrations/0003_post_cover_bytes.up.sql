@@ -0,0 +1,3 @@
+-- Cover photos count toward the owner's storage from now on. Covers
+-- uploaded before start counting once they're replaced.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS cover_bytes bigint NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_username_history_old_username_lower;
+CREATE INDEX IF NOT EXISTS idx_username_history_old_username ON username_history (old_username);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users (username);
+DROP INDEX IF EXISTS idx_users_username_lower;
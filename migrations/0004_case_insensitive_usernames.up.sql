@@ -0,0 +1,8 @@
+-- Usernames are looked up ignoring case, so they must be unique ignoring
+-- case too. This fails if two accounts' usernames differ only in case;
+-- rename one of them first.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_lower ON users (LOWER(username));
+DROP INDEX IF EXISTS idx_users_username;
+
+DROP INDEX IF EXISTS idx_username_history_old_username;
+CREATE INDEX IF NOT EXISTS idx_username_history_old_username_lower ON username_history (LOWER(old_username));
@@ -0,0 +1,372 @@
+// Package migrations holds the versioned SQL migrations of the database
+// schema and applies them.
+//
+// Each migration is a pair of files, NNNN_name.up.sql and NNNN_name.down.sql,
+// embedded into the binary. Applied versions are recorded in the
+// schema_migrations table together with a checksum of the up script.
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// lockKey is the Postgres advisory lock held while migrating, so two deploys
+// starting at the same time apply each migration once.
+const lockKey = 4_821_735_190
+
+var (
+	filePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+	namePattern = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// Migration is one step of the schema.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+func (m Migration) checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+// All returns the migrations embedded in the binary, oldest first.
+func All() ([]Migration, error) {
+	return Parse(files)
+}
+
+// Parse reads the migrations in the root of fsys, oldest first. Files that
+// don't end in .sql are ignored.
+func Parse(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		match := filePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("%s: migration files must be named NNNN_name.up.sql or NNNN_name.down.sql", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		if version == 0 {
+			return nil, fmt.Errorf("%s: versions start at 1", entry.Name())
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("%s: version %d is also used by %s", entry.Name(), version, m)
+		}
+
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("%s: both an up and a down file are required", m)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Create writes an empty up and down file for a new migration in dir,
+// numbered after the newest one there, and returns their paths.
+func Create(dir, name string) (string, string, error) {
+	name = strings.Trim(namePattern.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return "", "", errors.New("migration name must contain letters or digits")
+	}
+
+	existing, err := Parse(os.DirFS(dir))
+	if err != nil {
+		return "", "", err
+	}
+	version := 1
+	if len(existing) > 0 {
+		version = existing[len(existing)-1].Version + 1
+	}
+
+	base := filepath.Join(dir, Migration{Version: version, Name: name}.String())
+	up, down := base+".up.sql", base+".down.sql"
+	if err := os.WriteFile(up, []byte("-- "+name+"\n"), 0o644); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(down, []byte("-- Revert "+name+"\n"), 0o644); err != nil {
+		os.Remove(up)
+		return "", "", err
+	}
+	return up, down, nil
+}
+
+// Status is a migration and whether it's been applied. Modified is set when
+// the up file changed after it was applied, and Missing for versions
+// recorded in the database that this binary doesn't know.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+	Modified  bool
+	Missing   bool
+}
+
+type applied struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// querier is what *sql.DB, *sql.Conn and *sql.Tx have in common.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Migrator applies migrations to a Postgres database.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New returns a Migrator for the embedded migrations.
+func New(db *sql.DB) (*Migrator, error) {
+	migrations, err := All()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Up applies every migration that hasn't been yet, each in its own
+// transaction, and returns the ones it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+			err := inTx(ctx, conn, migration.Up, `INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+				migration.Version, migration.Name, migration.checksum())
+			if err != nil {
+				return fmt.Errorf("applying %s: %w", migration, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the n most recently applied migrations, newest first, and
+// returns the ones it reverted.
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	byVersion := make(map[int]Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		byVersion[migration.Version] = migration
+	}
+
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		newest := make([]int, 0, len(versions))
+		for version := range versions {
+			newest = append(newest, version)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(newest)))
+		if n < len(newest) {
+			newest = newest[:n]
+		}
+
+		for _, version := range newest {
+			migration, ok := byVersion[version]
+			if !ok {
+				return fmt.Errorf("version %d (%s) is applied but has no migration files", version, versions[version].name)
+			}
+			err := inTx(ctx, conn, migration.Down, `DELETE FROM schema_migrations WHERE version = $1`, version)
+			if err != nil {
+				return fmt.Errorf("reverting %s: %w", migration, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status lists every known or applied migration, oldest first.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	versions, err := appliedVersions(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Migration: migration}
+		if a, ok := versions[migration.Version]; ok {
+			appliedAt := a.appliedAt
+			status.AppliedAt = &appliedAt
+			status.Modified = a.checksum != migration.checksum()
+			delete(versions, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for version, a := range versions {
+		appliedAt := a.appliedAt
+		statuses = append(statuses, Status{
+			Migration: Migration{Version: version, Name: a.name},
+			AppliedAt: &appliedAt,
+			Missing:   true,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, nil
+}
+
+// Pending returns the migrations that haven't been applied yet.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending = append(pending, status.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// withLock runs fn on a single connection holding the migration lock, after
+// making sure schema_migrations exists. Session advisory locks belong to a
+// connection, so fn must not use the pool.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return fmt.Errorf("taking the migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		checksum text NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// appliedVersions reads schema_migrations, which counts as empty until the
+// first migration run creates it.
+func appliedVersions(ctx context.Context, q querier) (map[int]applied, error) {
+	var exists bool
+	rows, err := q.QueryContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+	if rows.Next() {
+		err = rows.Scan(&exists)
+	}
+	rows.Close()
+	if err != nil || !exists {
+		return map[int]applied{}, err
+	}
+
+	rows, err = q.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[int]applied)
+	for rows.Next() {
+		var version int
+		var a applied
+		if err := rows.Scan(&version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		versions[version] = a
+	}
+	return versions, rows.Err()
+}
+
+// inTx runs a migration script and the statement that records it in one
+// transaction. The script may hold several statements, so it's sent
+// without parameters.
+func inTx(ctx context.Context, conn *sql.Conn, script, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if strings.TrimSpace(script) != "" {
+		if _, err := tx.ExecContext(ctx, script); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,333 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/uuid"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm/schema"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	all, err := All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, m := range all {
+		if m.Version != i+1 {
+			t.Errorf("%s: want version %d, versions must have no gaps", m, i+1)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		err   string
+	}{
+		{"bad name", fstest.MapFS{"1_Init.up.sql": {}}, "must be named"},
+		{"version zero", fstest.MapFS{"0000_init.up.sql": {}}, "start at 1"},
+		{"duplicate version", fstest.MapFS{
+			"0001_init.up.sql":   {Data: []byte("SELECT 1;")},
+			"0001_init.down.sql": {Data: []byte("SELECT 1;")},
+			"0001_other.up.sql":  {Data: []byte("SELECT 1;")},
+		}, "also used by"},
+		{"missing down", fstest.MapFS{"0001_init.up.sql": {Data: []byte("SELECT 1;")}}, "both an up and a down"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.files)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Parse() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+
+	migrations, err := Parse(fstest.MapFS{
+		"0002_second.up.sql":   {Data: []byte("SELECT 2;")},
+		"0002_second.down.sql": {Data: []byte("SELECT -2;")},
+		"0001_first.up.sql":    {Data: []byte("SELECT 1;")},
+		"0001_first.down.sql":  {Data: []byte("SELECT -1;")},
+		"README.md":            {Data: []byte("ignored")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 || migrations[0].String() != "0001_first" || migrations[1].Down != "SELECT -2;" {
+		t.Errorf("migrations = %+v", migrations)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	up, down, err := Create(dir, "Add tags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(up) != "0001_add_tags.up.sql" || filepath.Base(down) != "0001_add_tags.down.sql" {
+		t.Errorf("created %s and %s", up, down)
+	}
+
+	up, _, err = Create(dir, "post-tags index!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(up) != "0002_post_tags_index.up.sql" {
+		t.Errorf("created %s", up)
+	}
+
+	if _, _, err := Create(dir, "--"); err == nil {
+		t.Error("Create accepted a name without letters")
+	}
+	if migrations, err := Parse(os.DirFS(dir)); err != nil || len(migrations) != 2 {
+		t.Errorf("Parse() = %d migrations, %v", len(migrations), err)
+	}
+}
+
+var (
+	createTable = regexp.MustCompile(`(?s)CREATE TABLE IF NOT EXISTS (\w+) \((.*?)\n\);`)
+	addColumn   = regexp.MustCompile(`ALTER TABLE (\w+) ADD COLUMN IF NOT EXISTS (\w+)`)
+	dropColumn  = regexp.MustCompile(`ALTER TABLE (\w+) DROP COLUMN IF EXISTS (\w+)`)
+)
+
+// TestModelsMatchMigrations catches a model changed without a migration.
+// It only compares column names; CheckSchema compares types against a live
+// database.
+func TestModelsMatchMigrations(t *testing.T) {
+	checkColumns(t, replay(t, map[string]map[string]bool{}))
+}
+
+// baselineTables are the tables of the first release, before versioned
+// migrations, as AutoMigrate created them.
+var baselineTables = map[string][]string{
+	"users": {"id", "username", "email", "password", "recovery_key",
+		"encrypted_content_key_by_password", "encrypted_content_key_by_recovery",
+		"resend_count", "verification_token", "last_verification_sent_at",
+		"verification_expires_at", "is_verified", "created_at", "updated_at", "deleted_at"},
+	"posts":    {"id", "created_at", "updated_at", "deleted_at", "title", "body", "user_id"},
+	"comments": {"id", "content", "user_id", "post_id", "created_at", "updated_at", "deleted_at"},
+}
+
+// TestBaselineUpgrade checks that a database from the first release, whose
+// tables the CREATE TABLE IF NOT EXISTS statements skip, still ends up with
+// every column.
+func TestBaselineUpgrade(t *testing.T) {
+	tables := make(map[string]map[string]bool)
+	for table, columns := range baselineTables {
+		tables[table] = make(map[string]bool)
+		for _, column := range columns {
+			tables[table][column] = true
+		}
+	}
+	checkColumns(t, replay(t, tables))
+}
+
+// replay applies the migrations' table and column changes, in order, to
+// tables.
+func replay(t *testing.T, tables map[string]map[string]bool) map[string]map[string]bool {
+	t.Helper()
+	all, err := All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range all {
+		for _, match := range createTable.FindAllStringSubmatch(m.Up, -1) {
+			if tables[match[1]] != nil {
+				continue
+			}
+			tables[match[1]] = make(map[string]bool)
+			for _, line := range strings.Split(strings.TrimSpace(match[2]), "\n") {
+				tables[match[1]][strings.Fields(line)[0]] = true
+			}
+		}
+		for _, match := range addColumn.FindAllStringSubmatch(m.Up, -1) {
+			tables[match[1]][match[2]] = true
+		}
+		for _, match := range dropColumn.FindAllStringSubmatch(m.Up, -1) {
+			delete(tables[match[1]], match[2])
+		}
+	}
+	return tables
+}
+
+func checkColumns(t *testing.T, tables map[string]map[string]bool) {
+	t.Helper()
+	cache := &sync.Map{}
+	for _, model := range Models {
+		s, err := schema.Parse(model, cache, schema.NamingStrategy{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		created, ok := tables[s.Table]
+		if !ok {
+			t.Errorf("no migration creates %s", s.Table)
+			continue
+		}
+		columns := make([]string, 0, len(created))
+		for column := range created {
+			columns = append(columns, column)
+		}
+		want := append([]string(nil), s.DBNames...)
+		sort.Strings(want)
+		sort.Strings(columns)
+		if strings.Join(columns, ",") != strings.Join(want, ",") {
+			t.Errorf("%s columns = %v, model has %v", s.Table, columns, want)
+		}
+	}
+}
+
+// baselineSchema is the first release's schema as AutoMigrate created it.
+const baselineSchema = `
+CREATE TABLE users (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    username text NOT NULL,
+    email text NOT NULL,
+    password text NOT NULL,
+    recovery_key text DEFAULT NULL,
+    encrypted_content_key_by_password text,
+    encrypted_content_key_by_recovery text,
+    resend_count bigint DEFAULT 0,
+    verification_token text DEFAULT NULL,
+    last_verification_sent_at timestamptz DEFAULT NULL,
+    verification_expires_at timestamptz DEFAULT NULL,
+    is_verified boolean DEFAULT false,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz
+);
+CREATE TABLE posts (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    title text NOT NULL,
+    body text,
+    user_id uuid NOT NULL CONSTRAINT fk_users_posts REFERENCES users (id)
+);
+CREATE TABLE comments (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    content text NOT NULL,
+    user_id uuid NOT NULL,
+    post_id uuid NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz
+);`
+
+// testDB returns a database in a schema of its own on the Postgres server
+// at TEST_DB_URL, skipping the test when it isn't set.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DB_URL")
+	if dsn == "" {
+		t.Skip("TEST_DB_URL not set")
+	}
+
+	admin, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	name := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := admin.Exec("CREATE SCHEMA " + name); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + name + " CASCADE") })
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", name)
+	u.RawQuery = q.Encode()
+	db, err := sql.Open("pgx", u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// TestUpgradeBaselineDatabase runs the migrations against a database from
+// the first release and checks the usage counters are backfilled.
+func TestUpgradeBaselineDatabase(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	if _, err := db.Exec(baselineSchema); err != nil {
+		t.Fatal(err)
+	}
+	var userID string
+	err := db.QueryRow(`INSERT INTO users (username, email, password) VALUES ('alice', 'alice@example.com', 'x') RETURNING id`).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`INSERT INTO posts (title, body, user_id, deleted_at) VALUES
+		('Day one', 'Hello', $1, NULL),
+		('Day two', NULL, $1, NULL),
+		('Gone', 'Deleted', $1, now())`, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all, _ := All(); len(applied) != len(all) {
+		t.Errorf("applied %d of %d migrations", len(applied), len(all))
+	}
+
+	problems, err := CheckSchema(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) > 0 {
+		t.Errorf("schema problems after upgrade: %v", problems)
+	}
+
+	var posts, bytes int64
+	if err := db.QueryRow(`SELECT post_count, stored_bytes FROM users WHERE id = $1`, userID).Scan(&posts, &bytes); err != nil {
+		t.Fatal(err)
+	}
+	want := int64(len("Day one") + len("Hello") + len("Day two"))
+	if posts != 2 || bytes != want {
+		t.Errorf("usage = %d posts, %d bytes; want 2 posts, %d bytes", posts, bytes, want)
+	}
+
+	_, err = db.Exec(`INSERT INTO users (username, email, password) VALUES ('ALICE', 'other@example.com', 'x')`)
+	if err == nil {
+		t.Error("usernames differing only in case were both accepted")
+	}
+
+	var searchIndex string
+	if err := db.QueryRow(`SELECT indexdef FROM pg_indexes WHERE indexname = 'idx_posts_search'`).Scan(&searchIndex); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(searchIndex, "body_encrypted") {
+		t.Errorf("idx_posts_search = %s, want encrypted bodies left out", searchIndex)
+	}
+
+	if pending, err := m.Pending(ctx); err != nil || len(pending) != 0 {
+		t.Errorf("Pending() = %v, %v", pending, err)
+	}
+}
@@ -0,0 +1,133 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cheeszy/journaling/models"
+	"gorm.io/gorm/schema"
+)
+
+// Models are the tables the application reads and writes. CheckSchema
+// compares them against the database.
+var Models = []interface{}{
+	&models.User{}, &models.Post{}, &models.Comment{}, &models.Metric{}, &models.MetricValue{},
+	&models.EmailOutbox{}, &models.EmailChange{}, &models.UsernameHistory{}, &models.DataExport{},
+	&models.ImportJob{}, &models.Attachment{},
+}
+
+// columnTypes maps GORM data types to the information_schema data types a
+// column may have to hold them.
+var columnTypes = map[string][]string{
+	string(schema.Bool):   {"boolean"},
+	string(schema.Int):    {"smallint", "integer", "bigint"},
+	string(schema.Uint):   {"smallint", "integer", "bigint"},
+	string(schema.Float):  {"real", "double precision", "numeric"},
+	string(schema.String): {"text", "character varying"},
+	string(schema.Time):   {"timestamp with time zone", "timestamp without time zone"},
+	string(schema.Bytes):  {"bytea"},
+	"uuid":                {"uuid"},
+	"text":                {"text"},
+	"varchar":             {"character varying"},
+	"decimal":             {"numeric"},
+	"numeric":             {"numeric"},
+}
+
+type column struct {
+	dataType string
+	nullable bool
+}
+
+// CheckSchema reports every way the database differs from Models: missing
+// tables and columns, columns the models don't know, column types that
+// can't hold the field and nullable columns for NOT NULL fields. An empty
+// result means the models match.
+func CheckSchema(ctx context.Context, db *sql.DB) ([]string, error) {
+	tables, err := readColumns(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	cache := &sync.Map{}
+	for _, model := range Models {
+		s, err := schema.Parse(model, cache, schema.NamingStrategy{})
+		if err != nil {
+			return nil, err
+		}
+		columns, ok := tables[s.Table]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("table %s is missing", s.Table))
+			continue
+		}
+
+		for _, name := range s.DBNames {
+			field := s.FieldsByDBName[name]
+			col, ok := columns[name]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("column %s.%s is missing", s.Table, name))
+				continue
+			}
+			delete(columns, name)
+
+			dataType := strings.ToLower(string(field.DataType))
+			if i := strings.IndexByte(dataType, '('); i >= 0 {
+				dataType = dataType[:i]
+			}
+			if allowed, ok := columnTypes[dataType]; ok && !contains(allowed, col.dataType) {
+				problems = append(problems, fmt.Sprintf("column %s.%s is %s, the model needs %s", s.Table, name, col.dataType, field.DataType))
+			}
+			if (field.NotNull || field.PrimaryKey) && col.nullable {
+				problems = append(problems, fmt.Sprintf("column %s.%s is nullable, the model requires NOT NULL", s.Table, name))
+			}
+		}
+
+		extra := make([]string, 0, len(columns))
+		for name := range columns {
+			extra = append(extra, name)
+		}
+		sort.Strings(extra)
+		for _, name := range extra {
+			problems = append(problems, fmt.Sprintf("column %s.%s isn't in the model", s.Table, name))
+		}
+	}
+	return problems, nil
+}
+
+// readColumns returns the columns of every table in the current schema,
+// keyed by table and column name.
+func readColumns(ctx context.Context, db *sql.DB) (map[string]map[string]column, error) {
+	rows, err := db.QueryContext(ctx, `SELECT table_name, column_name, data_type, is_nullable = 'YES'
+		FROM information_schema.columns WHERE table_schema = current_schema()`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tables := make(map[string]map[string]column)
+	for rows.Next() {
+		var table, name string
+		var col column
+		if err := rows.Scan(&table, &name, &col.dataType, &col.nullable); err != nil {
+			return nil, err
+		}
+		if tables[table] == nil {
+			tables[table] = make(map[string]column)
+		}
+		tables[table][name] = col
+	}
+	return tables, rows.Err()
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Attachment is a file uploaded to a post. The file itself is encrypted with
+// the owner's content key and kept in blob storage under StorageKey.
+type Attachment struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	PostID      uuid.UUID `gorm:"type:uuid;not null;index" json:"postId"`
+	UserID      uuid.UUID `gorm:"type:uuid;not null;index" json:"-"`
+	Filename    string    `gorm:"not null" json:"filename"`
+	ContentType string    `gorm:"not null" json:"contentType"`
+	Size        int64     `gorm:"not null" json:"size"`
+	StorageKey  string    `gorm:"not null" json:"-"`
+
+	// DurationMs is set for audio files.
+	DurationMs int64 `gorm:"default:0" json:"durationMs,omitempty"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ExportStatusPending    = "pending"
+	ExportStatusProcessing = "processing"
+	ExportStatusReady      = "ready"
+	ExportStatusFailed     = "failed"
+	ExportStatusExpired    = "expired"
+)
+
+// DataExport is a requested archive of everything a user has stored. It's
+// built in the background and downloadable through a time-limited token.
+type DataExport struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	UserID        uuid.UUID  `gorm:"type:uuid;not null;index" json:"userId"`
+	Status        string     `gorm:"type:varchar(16);not null;default:pending;index" json:"status"`
+	FilePath      string     `json:"-"`
+	Size          int64      `json:"size,omitempty"`
+	DownloadToken *string    `gorm:"uniqueIndex" json:"-"`
+	ExpiresAt     *time.Time `json:"expiresAt,omitempty"`
+	CompletedAt   *time.Time `json:"completedAt,omitempty"`
+	Error         string     `json:"error,omitempty"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EmailChange is a requested change of a user's email address. It only takes
+// effect once the new address confirms it, and the old address can cancel it
+// until then.
+type EmailChange struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	UserID       uuid.UUID  `gorm:"type:uuid;not null;index" json:"userId"`
+	OldEmail     string     `gorm:"not null" json:"oldEmail"`
+	NewEmail     string     `gorm:"not null" json:"newEmail"`
+	ConfirmToken string     `gorm:"not null;uniqueIndex" json:"-"`
+	CancelToken  string     `gorm:"not null;uniqueIndex" json:"-"`
+	ExpiresAt    time.Time  `gorm:"not null" json:"expiresAt"`
+	ConfirmedAt  *time.Time `json:"confirmedAt,omitempty"`
+	CancelledAt  *time.Time `json:"cancelledAt,omitempty"`
+}
+
+// IsPending reports whether the change can still be confirmed or cancelled.
+func (e *EmailChange) IsPending(now time.Time) bool {
+	return e.ConfirmedAt == nil && e.CancelledAt == nil && now.Before(e.ExpiresAt)
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	OutboxStatusPending = "pending"
+	OutboxStatusSent    = "sent"
+	OutboxStatusDead    = "dead"
+)
+
+// EmailOutbox is a rendered email waiting to be delivered by the outbox
+// worker. Rows are written in the same transaction as the change that
+// triggers the email, so an email is never lost or sent for a rolled-back
+// change.
+type EmailOutbox struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	UserID   *uuid.UUID `gorm:"type:uuid;index" json:"userId,omitempty"`
+	Template string     `gorm:"not null;index" json:"template"`
+	To       string     `gorm:"column:to_address;not null" json:"to"`
+	Subject  string     `gorm:"not null" json:"subject"`
+	TextBody string     `gorm:"type:text" json:"-"`
+	HTMLBody string     `gorm:"type:text" json:"-"`
+
+	Status        string     `gorm:"type:varchar(16);not null;default:pending;index" json:"status"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"not null;index" json:"nextAttemptAt"`
+	LastError     string     `gorm:"type:text" json:"lastError,omitempty"`
+	SentAt        *time.Time `json:"sentAt,omitempty"`
+}
+
+func (EmailOutbox) TableName() string {
+	return "email_outbox"
+}
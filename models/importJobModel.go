@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ImportStatusPending    = "pending"
+	ImportStatusProcessing = "processing"
+	ImportStatusCompleted  = "completed"
+	ImportStatusFailed     = "failed"
+
+	ImportFormatDayOne   = "dayone"
+	ImportFormatJourney  = "journey"
+	ImportFormatMarkdown = "markdown"
+)
+
+// ImportEntryError describes one entry of an import that couldn't be imported.
+type ImportEntryError struct {
+	Entry string `json:"entry"`
+	Error string `json:"error"`
+}
+
+// ImportJob tracks an uploaded archive from another journaling app while it's
+// imported in the background.
+type ImportJob struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	UserID   uuid.UUID          `gorm:"type:uuid;not null;index" json:"userId"`
+	Status   string             `gorm:"type:varchar(16);not null;default:pending;index" json:"status"`
+	Format   string             `gorm:"type:varchar(16)" json:"format,omitempty"`
+	FilePath string             `json:"-"`
+	Total    int                `gorm:"not null;default:0" json:"total"`
+	Imported int                `gorm:"not null;default:0" json:"imported"`
+	Failed   int                `gorm:"not null;default:0" json:"failed"`
+	Errors   []ImportEntryError `gorm:"type:text;serializer:json" json:"errors"`
+	Error    string             `json:"error,omitempty"`
+
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+}
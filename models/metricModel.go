@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MetricKindScale   = "scale"
+	MetricKindNumber  = "number"
+	MetricKindBoolean = "boolean"
+)
+
+// Metric is a user-defined value tracked alongside entries, e.g. mood on a
+// 1-5 scale, hours of sleep or a yes/no habit.
+type Metric struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	UserID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_metrics_user_name" json:"userId"`
+	Name   string    `gorm:"not null;uniqueIndex:idx_metrics_user_name" json:"name"`
+	Kind   string    `gorm:"type:varchar(16);not null" json:"kind"`
+	Unit   string    `json:"unit,omitempty"`
+	Min    *float64  `json:"min,omitempty"`
+	Max    *float64  `json:"max,omitempty"`
+}
+
+// MetricValue is the value of a metric recorded on a single post.
+type MetricValue struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	UserID     uuid.UUID `gorm:"type:uuid;not null;index" json:"userId"`
+	MetricID   uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_metric_values_metric_post" json:"metricId"`
+	PostID     uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_metric_values_metric_post;index" json:"postId"`
+	Value      float64   `gorm:"not null" json:"value"`
+	RecordedAt time.Time `gorm:"not null;index" json:"recordedAt"`
+
+	Metric Metric `gorm:"foreignKey:MetricID;constraint:OnDelete:CASCADE" json:"-"`
+}
@@ -7,6 +7,17 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	PostStatusDraft     = "draft"
+	PostStatusPublished = "published"
+	PostStatusScheduled = "scheduled"
+)
+
+const (
+	PostKindText  = "text"
+	PostKindVoice = "voice"
+)
+
 type Post struct {
 	ID        uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
 	CreatedAt time.Time      `gorm:"autoCreateTime" json:"createdAt"`
@@ -17,7 +28,43 @@ type Post struct {
 	Body   string    `gorm:"type:text" json:"body"`
 	UserID uuid.UUID `gorm:"type:uuid;not null" json:"userId"`
 
-	User User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	// BodyEncrypted is set when Body holds the body encrypted with the
+	// owner's content key, as for imported entries. Such bodies can't be
+	// searched.
+	BodyEncrypted bool `gorm:"not null;default:false" json:"-"`
+
+	// Voice entries keep their recording as an attachment. Its duration is
+	// copied here so listing entries doesn't need to load attachments.
+	Kind              string     `gorm:"type:varchar(16);not null;default:text" json:"kind"`
+	Transcript        string     `gorm:"type:text;not null;default:''" json:"transcript,omitempty"`
+	AudioAttachmentID *uuid.UUID `gorm:"type:uuid" json:"-"`
+	AudioDurationMs   int64      `gorm:"default:0" json:"-"`
+
+	Status      string     `gorm:"type:varchar(16);not null;default:published;index" json:"status"`
+	PublishAt   *time.Time `gorm:"index" json:"publishAt,omitempty"`
+	AutosavedAt *time.Time `json:"autosavedAt,omitempty"`
+
+	SealedUntil      *time.Time `gorm:"index" json:"sealedUntil,omitempty"`
+	UnsealNotifiedAt *time.Time `json:"-"`
+
+	// CoverKey names the cover photo's files in the cover directory; it
+	// changes with every upload. Width and height are of the upright image.
+	// CoverBytes is the size of its files, thumbnails included, counted
+	// toward the owner's storage.
+	CoverKey         string     `gorm:"default:null" json:"-"`
+	CoverContentType string     `gorm:"default:null" json:"-"`
+	CoverWidth       int        `gorm:"default:0" json:"-"`
+	CoverHeight      int        `gorm:"default:0" json:"-"`
+	CoverBytes       int64      `gorm:"not null;default:0" json:"-"`
+	CoverUpdatedAt   *time.Time `json:"-"`
+
+	User         User          `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	MetricValues []MetricValue `gorm:"foreignKey:PostID" json:"metrics,omitempty"`
+}
+
+// IsSealed reports whether the post is a time capsule that hasn't unlocked yet.
+func (p *Post) IsSealed(now time.Time) bool {
+	return p.SealedUntil != nil && now.Before(*p.SealedUntil)
 }
 
 func GetPostsByUserID(db *gorm.DB, userID uuid.UUID) ([]Post, error) {
@@ -7,21 +7,51 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	PlanFree = "free"
+	PlanPro  = "pro"
+)
+
 type User struct {
-	ID          uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
-	Username    string    `gorm:"uniqueIndex;not null" json:"username"`
-	Email       string    `gorm:"uniqueIndex;not null" json:"email" binding:"required,email"`
-	Password    string    `gorm:"not null" json:"password" binding:"required"`
-	RecoveryKey string    `gorm:"default:null" json:"recoveryKey,omitempty"`
+	ID       uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Username string    `gorm:"uniqueIndex;not null" json:"username"`
+	// UsernameChangedAt is used to enforce the cooldown between changes.
+	UsernameChangedAt *time.Time `json:"usernameChangedAt,omitempty"`
+	Email             string     `gorm:"uniqueIndex;not null" json:"email" binding:"required,email"`
+	Password          string     `gorm:"not null" json:"password" binding:"required"`
+	RecoveryKey       string     `gorm:"default:null" json:"-"`
+	// RecoveryKeyPending is set until the user proves they saved the recovery
+	// key shown at registration; the account can't log in before that.
+	RecoveryKeyPending bool `gorm:"default:false" json:"recoveryKeyPending"`
 
 	EncryptedContentKeyByPassword string `gorm:"column:encrypted_content_key_by_password" json:"-"`
 	EncryptedContentKeyByRecovery string `gorm:"column:encrypted_content_key_by_recovery" json:"-"`
+	// EncryptedContentKeyByServer is the content key encrypted with the
+	// server's master key, so background jobs can read the user's files.
+	EncryptedContentKeyByServer string `gorm:"column:encrypted_content_key_by_server;default:null" json:"-"`
 
 	ResendCount            int       `gorm:"default:0" json:"resendCount,omitempty"`
 	VerificationToken      string    `gorm:"default:null" json:"verificationToken,omitempty"`
 	LastVerificationSentAt time.Time `gorm:"default:null" json:"lastVerificationSentAt,omitempty"`
 	VerificationExpiresAt  time.Time `gorm:"default:null" json:"verificationExpiresAt,omitempty"`
 	IsVerified             bool      `gorm:"default:false" json:"isVerified"`
+	IsAdmin                bool      `gorm:"default:false" json:"isAdmin"`
+
+	Timezone string `gorm:"not null;default:UTC" json:"timezone"`
+
+	// Plan sets the user's limits. PostCount and StoredBytes are kept up to
+	// date with every change to the user's posts and attachments.
+	Plan        string `gorm:"type:varchar(16);not null;default:free" json:"plan"`
+	PostCount   int64  `gorm:"not null;default:0" json:"-"`
+	StoredBytes int64  `gorm:"not null;default:0" json:"-"`
+
+	DigestEnabled  bool   `gorm:"default:false" json:"digestEnabled"`
+	DigestHour     int    `gorm:"default:8" json:"digestHour"`
+	LastDigestDate string `gorm:"default:null" json:"-"`
+
+	// DeletionScheduledAt is when the account will be permanently deleted.
+	// Logging in before then cancels the deletion.
+	DeletionScheduledAt *time.Time `gorm:"index" json:"deletionScheduledAt,omitempty"`
 
 	CreatedAt time.Time      `json:"-"`
 	UpdatedAt time.Time      `json:"-"`
@@ -30,6 +60,19 @@ type User struct {
 	Posts []Post `gorm:"foreignKey:UserID" json:"posts,omitempty"`
 }
 
+// Location returns the user's time zone, falling back to UTC when it's unset
+// or unknown.
+func (u *User) Location() *time.Location {
+	if u.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
 func GetUserByEmail(db *gorm.DB, email string) (User, error) {
 	var user User
 	err := db.Where("email = ?", email).First(&user).Error
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UsernameHistory records a username change. Until ReservedUntil the old
+// username redirects to the user and can't be claimed by anyone else.
+type UsernameHistory struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	UserID        uuid.UUID `gorm:"type:uuid;not null;index" json:"userId"`
+	OldUsername   string    `gorm:"not null;index" json:"oldUsername"`
+	NewUsername   string    `gorm:"not null" json:"newUsername"`
+	ReservedUntil time.Time `gorm:"not null;index" json:"reservedUntil"`
+}
+
+func (UsernameHistory) TableName() string {
+	return "username_history"
+}
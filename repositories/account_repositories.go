@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/cheeszy/journaling/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AccountRepository handles scheduled account deletion, which spans every
+// table holding user data.
+type AccountRepository interface {
+	ScheduleDeletion(userID uuid.UUID, at time.Time) error
+	CancelDeletion(userID uuid.UUID) error
+	FindDueForDeletion(now time.Time) ([]models.User, error)
+	// HardDelete permanently removes the user and everything they wrote,
+	// bypassing soft deletes. Run it inside a transaction.
+	HardDelete(userID uuid.UUID) error
+}
+
+type accountRepository struct {
+	db *gorm.DB
+}
+
+func NewAccountRepository(db *gorm.DB) AccountRepository {
+	return &accountRepository{db: db}
+}
+
+func (r *accountRepository) ScheduleDeletion(userID uuid.UUID, at time.Time) error {
+	return r.db.Model(&models.User{}).Where("id = ?", userID).Update("deletion_scheduled_at", at).Error
+}
+
+func (r *accountRepository) CancelDeletion(userID uuid.UUID) error {
+	return r.db.Model(&models.User{}).Where("id = ?", userID).Update("deletion_scheduled_at", nil).Error
+}
+
+func (r *accountRepository) FindDueForDeletion(now time.Time) ([]models.User, error) {
+	var users []models.User
+	err := r.db.Where("deletion_scheduled_at <= ?", now).Find(&users).Error
+	return users, err
+}
+
+func (r *accountRepository) HardDelete(userID uuid.UUID) error {
+	db := r.db
+	postIDs := db.Unscoped().Model(&models.Post{}).Select("id").Where("user_id = ?", userID)
+
+	steps := []func() error{
+		func() error {
+			return db.Unscoped().Where("user_id = ? OR post_id IN (?)", userID, postIDs).Delete(&models.Comment{}).Error
+		},
+		func() error { return db.Where("user_id = ?", userID).Delete(&models.MetricValue{}).Error },
+		func() error { return db.Where("user_id = ?", userID).Delete(&models.Metric{}).Error },
+		func() error { return db.Where("user_id = ?", userID).Delete(&models.Attachment{}).Error },
+		func() error { return db.Unscoped().Where("user_id = ?", userID).Delete(&models.Post{}).Error },
+		func() error { return db.Where("user_id = ?", userID).Delete(&models.EmailChange{}).Error },
+		func() error { return db.Where("user_id = ?", userID).Delete(&models.UsernameHistory{}).Error },
+		func() error { return db.Where("user_id = ?", userID).Delete(&models.EmailOutbox{}).Error },
+		func() error { return db.Where("user_id = ?", userID).Delete(&models.DataExport{}).Error },
+		func() error { return db.Where("user_id = ?", userID).Delete(&models.ImportJob{}).Error },
+		func() error { return db.Unscoped().Where("id = ?", userID).Delete(&models.User{}).Error },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package repositories
+
+import (
+	"github.com/cheeszy/journaling/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AttachmentRepository stores the rows describing attachments; their
+// content lives in the blob store.
+type AttachmentRepository interface {
+	Create(attachment *models.Attachment) error
+	// FindByPostID returns the post's attachments, oldest first.
+	FindByPostID(postID uuid.UUID) ([]models.Attachment, error)
+	FindByIDAndPostID(id string, postID uuid.UUID) (*models.Attachment, error)
+	// FindByUserID returns the user's attachments, oldest first.
+	FindByUserID(userID uuid.UUID) ([]models.Attachment, error)
+	DeleteByID(id uuid.UUID) error
+	DeleteByPostID(postID uuid.UUID) error
+}
+
+type attachmentRepository struct {
+	db *gorm.DB
+}
+
+func NewAttachmentRepository(db *gorm.DB) AttachmentRepository {
+	return &attachmentRepository{db: db}
+}
+
+func (r *attachmentRepository) Create(attachment *models.Attachment) error {
+	return r.db.Create(attachment).Error
+}
+
+func (r *attachmentRepository) FindByPostID(postID uuid.UUID) ([]models.Attachment, error) {
+	var attachments []models.Attachment
+	err := r.db.Where("post_id = ?", postID).Order("created_at").Find(&attachments).Error
+	return attachments, err
+}
+
+func (r *attachmentRepository) FindByIDAndPostID(id string, postID uuid.UUID) (*models.Attachment, error) {
+	var attachment models.Attachment
+	if err := r.db.First(&attachment, "id = ? AND post_id = ?", id, postID).Error; err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+func (r *attachmentRepository) FindByUserID(userID uuid.UUID) ([]models.Attachment, error) {
+	var attachments []models.Attachment
+	err := r.db.Where("user_id = ?", userID).Order("created_at").Find(&attachments).Error
+	return attachments, err
+}
+
+func (r *attachmentRepository) DeleteByID(id uuid.UUID) error {
+	return r.db.Delete(&models.Attachment{}, "id = ?", id).Error
+}
+
+func (r *attachmentRepository) DeleteByPostID(postID uuid.UUID) error {
+	return r.db.Where("post_id = ?", postID).Delete(&models.Attachment{}).Error
+}
@@ -0,0 +1,26 @@
+package repositories
+
+import (
+	"github.com/cheeszy/journaling/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type CommentRepository interface {
+	// FindByUserID returns the comments the user wrote, oldest first.
+	FindByUserID(userID uuid.UUID) ([]models.Comment, error)
+}
+
+type commentRepository struct {
+	db *gorm.DB
+}
+
+func NewCommentRepository(db *gorm.DB) CommentRepository {
+	return &commentRepository{db: db}
+}
+
+func (r *commentRepository) FindByUserID(userID uuid.UUID) ([]models.Comment, error) {
+	var comments []models.Comment
+	err := r.db.Where("user_id = ?", userID).Order("created_at").Find(&comments).Error
+	return comments, err
+}
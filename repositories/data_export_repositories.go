@@ -0,0 +1,102 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/cheeszy/journaling/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DataExportRepository interface {
+	Create(export *models.DataExport) error
+	// FindActive returns the user's pending or processing export.
+	FindActive(userID uuid.UUID) (*models.DataExport, error)
+	FindByIDAndUserID(id string, userID uuid.UUID) (*models.DataExport, error)
+	FindByToken(token string) (*models.DataExport, error)
+	// Claim marks the oldest pending export as processing and returns it.
+	// Exports stuck in processing for longer than stale are picked up again.
+	Claim(now time.Time, stale time.Duration) (*models.DataExport, error)
+	Update(export *models.DataExport) error
+	FindExpired(now time.Time) ([]models.DataExport, error)
+	FindByUserID(userID uuid.UUID) ([]models.DataExport, error)
+}
+
+type dataExportRepository struct {
+	db *gorm.DB
+}
+
+func NewDataExportRepository(db *gorm.DB) DataExportRepository {
+	return &dataExportRepository{db: db}
+}
+
+func (r *dataExportRepository) Create(export *models.DataExport) error {
+	return r.db.Create(export).Error
+}
+
+func (r *dataExportRepository) FindActive(userID uuid.UUID) (*models.DataExport, error) {
+	var export models.DataExport
+	err := r.db.Where("user_id = ? AND status IN ?", userID,
+		[]string{models.ExportStatusPending, models.ExportStatusProcessing}).
+		First(&export).Error
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (r *dataExportRepository) FindByIDAndUserID(id string, userID uuid.UUID) (*models.DataExport, error) {
+	var export models.DataExport
+	if err := r.db.First(&export, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (r *dataExportRepository) FindByToken(token string) (*models.DataExport, error) {
+	var export models.DataExport
+	if err := r.db.First(&export, "download_token = ?", token).Error; err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (r *dataExportRepository) Claim(now time.Time, stale time.Duration) (*models.DataExport, error) {
+	var export models.DataExport
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? OR (status = ? AND updated_at < ?)",
+				models.ExportStatusPending, models.ExportStatusProcessing, now.Add(-stale)).
+			Order("created_at").
+			First(&export).Error
+		if err != nil {
+			return err
+		}
+		export.Status = models.ExportStatusProcessing
+		return tx.Model(&export).Updates(map[string]interface{}{
+			"status":     models.ExportStatusProcessing,
+			"updated_at": now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (r *dataExportRepository) Update(export *models.DataExport) error {
+	return r.db.Save(export).Error
+}
+
+func (r *dataExportRepository) FindExpired(now time.Time) ([]models.DataExport, error) {
+	var exports []models.DataExport
+	err := r.db.Where("status = ? AND expires_at <= ?", models.ExportStatusReady, now).Find(&exports).Error
+	return exports, err
+}
+
+func (r *dataExportRepository) FindByUserID(userID uuid.UUID) ([]models.DataExport, error) {
+	var exports []models.DataExport
+	err := r.db.Where("user_id = ?", userID).Find(&exports).Error
+	return exports, err
+}
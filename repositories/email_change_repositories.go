@@ -0,0 +1,61 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/cheeszy/journaling/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type EmailChangeRepository interface {
+	Create(change *models.EmailChange) error
+	FindByConfirmToken(token string) (*models.EmailChange, error)
+	FindByCancelToken(token string) (*models.EmailChange, error)
+	// CancelPending cancels every open change request of the user.
+	CancelPending(userID uuid.UUID, now time.Time) error
+	MarkConfirmed(id uuid.UUID, now time.Time) error
+	MarkCancelled(id uuid.UUID, now time.Time) error
+}
+
+type emailChangeRepository struct {
+	db *gorm.DB
+}
+
+func NewEmailChangeRepository(db *gorm.DB) EmailChangeRepository {
+	return &emailChangeRepository{db: db}
+}
+
+func (r *emailChangeRepository) Create(change *models.EmailChange) error {
+	return r.db.Create(change).Error
+}
+
+func (r *emailChangeRepository) FindByConfirmToken(token string) (*models.EmailChange, error) {
+	var change models.EmailChange
+	if err := r.db.Where("confirm_token = ?", token).First(&change).Error; err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+func (r *emailChangeRepository) FindByCancelToken(token string) (*models.EmailChange, error) {
+	var change models.EmailChange
+	if err := r.db.Where("cancel_token = ?", token).First(&change).Error; err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+func (r *emailChangeRepository) CancelPending(userID uuid.UUID, now time.Time) error {
+	return r.db.Model(&models.EmailChange{}).
+		Where("user_id = ? AND confirmed_at IS NULL AND cancelled_at IS NULL", userID).
+		Update("cancelled_at", now).Error
+}
+
+func (r *emailChangeRepository) MarkConfirmed(id uuid.UUID, now time.Time) error {
+	return r.db.Model(&models.EmailChange{}).Where("id = ?", id).Update("confirmed_at", now).Error
+}
+
+func (r *emailChangeRepository) MarkCancelled(id uuid.UUID, now time.Time) error {
+	return r.db.Model(&models.EmailChange{}).Where("id = ?", id).Update("cancelled_at", now).Error
+}
@@ -0,0 +1,121 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/cheeszy/journaling/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OutboxRepository interface {
+	Create(email *models.EmailOutbox) error
+	// ClaimDue locks up to limit pending emails that are due and pushes
+	// their next attempt out by lease, so other workers skip them while
+	// they're being delivered. If the worker dies, they become due again
+	// once the lease runs out.
+	ClaimDue(now time.Time, lease time.Duration, limit int) ([]models.EmailOutbox, error)
+	MarkSent(id uuid.UUID, attempts int, at time.Time) error
+	MarkFailed(id uuid.UUID, status string, attempts int, next time.Time, lastError string) error
+	// Find returns the newest emails, optionally filtered by status.
+	Find(status string, limit int) ([]models.EmailOutbox, error)
+	FindByID(id string) (*models.EmailOutbox, error)
+	FindLatest(userID uuid.UUID, template string) (*models.EmailOutbox, error)
+	// Requeue puts a dead-lettered email back in the queue with a fresh
+	// attempt budget. It reports how many emails were requeued.
+	Requeue(id string, now time.Time) (int64, error)
+}
+
+type outboxRepository struct {
+	db *gorm.DB
+}
+
+func NewOutboxRepository(db *gorm.DB) OutboxRepository {
+	return &outboxRepository{db: db}
+}
+
+func (r *outboxRepository) Create(email *models.EmailOutbox) error {
+	return r.db.Create(email).Error
+}
+
+func (r *outboxRepository) ClaimDue(now time.Time, lease time.Duration, limit int) ([]models.EmailOutbox, error) {
+	var emails []models.EmailOutbox
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.OutboxStatusPending, now).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&emails).Error
+		if err != nil || len(emails) == 0 {
+			return err
+		}
+
+		ids := make([]uuid.UUID, 0, len(emails))
+		for _, email := range emails {
+			ids = append(ids, email.ID)
+		}
+		return tx.Model(&models.EmailOutbox{}).
+			Where("id IN ?", ids).
+			Update("next_attempt_at", now.Add(lease)).Error
+	})
+	return emails, err
+}
+
+func (r *outboxRepository) MarkSent(id uuid.UUID, attempts int, at time.Time) error {
+	return r.db.Model(&models.EmailOutbox{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":     models.OutboxStatusSent,
+		"attempts":   attempts,
+		"sent_at":    at,
+		"last_error": "",
+	}).Error
+}
+
+func (r *outboxRepository) MarkFailed(id uuid.UUID, status string, attempts int, next time.Time, lastError string) error {
+	return r.db.Model(&models.EmailOutbox{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":          status,
+		"attempts":        attempts,
+		"next_attempt_at": next,
+		"last_error":      lastError,
+	}).Error
+}
+
+func (r *outboxRepository) Find(status string, limit int) ([]models.EmailOutbox, error) {
+	var emails []models.EmailOutbox
+	query := r.db.Order("created_at DESC").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Find(&emails).Error
+	return emails, err
+}
+
+func (r *outboxRepository) FindByID(id string) (*models.EmailOutbox, error) {
+	var email models.EmailOutbox
+	if err := r.db.First(&email, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &email, nil
+}
+
+func (r *outboxRepository) FindLatest(userID uuid.UUID, template string) (*models.EmailOutbox, error) {
+	var email models.EmailOutbox
+	err := r.db.Where("user_id = ? AND template = ?", userID, template).
+		Order("created_at DESC").
+		First(&email).Error
+	if err != nil {
+		return nil, err
+	}
+	return &email, nil
+}
+
+func (r *outboxRepository) Requeue(id string, now time.Time) (int64, error) {
+	res := r.db.Model(&models.EmailOutbox{}).
+		Where("id = ? AND status = ?", id, models.OutboxStatusDead).
+		Updates(map[string]interface{}{
+			"status":          models.OutboxStatusPending,
+			"attempts":        0,
+			"next_attempt_at": now,
+		})
+	return res.RowsAffected, res.Error
+}
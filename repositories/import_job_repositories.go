@@ -0,0 +1,73 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/cheeszy/journaling/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ImportJobRepository interface {
+	Create(job *models.ImportJob) error
+	FindByIDAndUserID(id string, userID uuid.UUID) (*models.ImportJob, error)
+	// Claim marks the oldest pending import as processing and returns it.
+	// Jobs stuck in processing for longer than stale are picked up again.
+	Claim(now time.Time, stale time.Duration) (*models.ImportJob, error)
+	Update(job *models.ImportJob) error
+	FindByUserID(userID uuid.UUID) ([]models.ImportJob, error)
+}
+
+type importJobRepository struct {
+	db *gorm.DB
+}
+
+func NewImportJobRepository(db *gorm.DB) ImportJobRepository {
+	return &importJobRepository{db: db}
+}
+
+func (r *importJobRepository) Create(job *models.ImportJob) error {
+	return r.db.Create(job).Error
+}
+
+func (r *importJobRepository) FindByIDAndUserID(id string, userID uuid.UUID) (*models.ImportJob, error) {
+	var job models.ImportJob
+	if err := r.db.First(&job, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *importJobRepository) Claim(now time.Time, stale time.Duration) (*models.ImportJob, error) {
+	var job models.ImportJob
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? OR (status = ? AND updated_at < ?)",
+				models.ImportStatusPending, models.ImportStatusProcessing, now.Add(-stale)).
+			Order("created_at").
+			First(&job).Error
+		if err != nil {
+			return err
+		}
+		job.Status = models.ImportStatusProcessing
+		return tx.Model(&job).Updates(map[string]interface{}{
+			"status":     models.ImportStatusProcessing,
+			"updated_at": now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *importJobRepository) Update(job *models.ImportJob) error {
+	return r.db.Save(job).Error
+}
+
+func (r *importJobRepository) FindByUserID(userID uuid.UUID) ([]models.ImportJob, error) {
+	var jobs []models.ImportJob
+	err := r.db.Where("user_id = ?", userID).Find(&jobs).Error
+	return jobs, err
+}
@@ -0,0 +1,72 @@
+package memory
+
+import (
+	"time"
+
+	"github.com/cheeszy/journaling/models"
+	"github.com/cheeszy/journaling/repositories"
+	"github.com/google/uuid"
+)
+
+var _ repositories.AccountRepository = (*AccountRepository)(nil)
+
+type AccountRepository struct {
+	*Store
+}
+
+func (r *AccountRepository) ScheduleDeletion(userID uuid.UUID, at time.Time) error {
+	return (&UserRepository{r.Store}).update(userID, func(u *models.User) { u.DeletionScheduledAt = &at })
+}
+
+func (r *AccountRepository) CancelDeletion(userID uuid.UUID) error {
+	return (&UserRepository{r.Store}).update(userID, func(u *models.User) { u.DeletionScheduledAt = nil })
+}
+
+func (r *AccountRepository) FindDueForDeletion(now time.Time) ([]models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var users []models.User
+	for _, user := range r.users {
+		if user.DeletionScheduledAt != nil && !user.DeletionScheduledAt.After(now) {
+			users = append(users, *cloneUser(user))
+		}
+	}
+	return users, nil
+}
+
+func (r *AccountRepository) HardDelete(userID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, comment := range r.comments {
+		post, onOwnPost := r.posts[comment.PostID]
+		if comment.UserID == userID || (onOwnPost && post.UserID == userID) {
+			delete(r.comments, id)
+		}
+	}
+	deleteOwned(r.metricValues, userID, func(v *models.MetricValue) uuid.UUID { return v.UserID })
+	deleteOwned(r.metrics, userID, func(m *models.Metric) uuid.UUID { return m.UserID })
+	deleteOwned(r.attachments, userID, func(a *models.Attachment) uuid.UUID { return a.UserID })
+	deleteOwned(r.posts, userID, func(p *models.Post) uuid.UUID { return p.UserID })
+	deleteOwned(r.emailChanges, userID, func(e *models.EmailChange) uuid.UUID { return e.UserID })
+	deleteOwned(r.usernameHistory, userID, func(h *models.UsernameHistory) uuid.UUID { return h.UserID })
+	deleteOwned(r.outbox, userID, func(e *models.EmailOutbox) uuid.UUID {
+		if e.UserID == nil {
+			return uuid.Nil
+		}
+		return *e.UserID
+	})
+	deleteOwned(r.dataExports, userID, func(e *models.DataExport) uuid.UUID { return e.UserID })
+	deleteOwned(r.importJobs, userID, func(j *models.ImportJob) uuid.UUID { return j.UserID })
+	delete(r.users, userID)
+	return nil
+}
+
+func deleteOwned[T any](rows map[uuid.UUID]*T, userID uuid.UUID, owner func(*T) uuid.UUID) {
+	for id, row := range rows {
+		if owner(row) == userID {
+			delete(rows, id)
+		}
+	}
+}
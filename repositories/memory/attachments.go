@@ -0,0 +1,92 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/cheeszy/journaling/models"
+	"github.com/cheeszy/journaling/repositories"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var _ repositories.AttachmentRepository = (*AttachmentRepository)(nil)
+
+type AttachmentRepository struct {
+	*Store
+}
+
+func (r *AttachmentRepository) Create(attachment *models.Attachment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	newID(&attachment.ID)
+	if attachment.CreatedAt.IsZero() {
+		attachment.CreatedAt = time.Now()
+	}
+	c := *attachment
+	r.attachments[c.ID] = &c
+	return nil
+}
+
+// attachmentsWhere returns copies of the matching attachments, oldest first.
+func (r *AttachmentRepository) attachmentsWhere(match func(*models.Attachment) bool) []models.Attachment {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var attachments []models.Attachment
+	for _, attachment := range r.attachments {
+		if match(attachment) {
+			attachments = append(attachments, *attachment)
+		}
+	}
+	sort.Slice(attachments, func(i, j int) bool {
+		return attachments[i].CreatedAt.Before(attachments[j].CreatedAt)
+	})
+	return attachments
+}
+
+func (r *AttachmentRepository) FindByPostID(postID uuid.UUID) ([]models.Attachment, error) {
+	return r.attachmentsWhere(func(a *models.Attachment) bool { return a.PostID == postID }), nil
+}
+
+func (r *AttachmentRepository) FindByIDAndPostID(id string, postID uuid.UUID) (*models.Attachment, error) {
+	attachmentID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	attachment, ok := r.attachments[attachmentID]
+	if !ok || attachment.PostID != postID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	c := *attachment
+	return &c, nil
+}
+
+func (r *AttachmentRepository) FindByUserID(userID uuid.UUID) ([]models.Attachment, error) {
+	return r.attachmentsWhere(func(a *models.Attachment) bool { return a.UserID == userID }), nil
+}
+
+func (r *AttachmentRepository) DeleteByID(id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.attachments, id)
+	return nil
+}
+
+func (r *AttachmentRepository) DeleteByPostID(postID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, attachment := range r.attachments {
+		if attachment.PostID == postID {
+			delete(r.attachments, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/cheeszy/journaling/models"
+	"github.com/cheeszy/journaling/repositories"
+	"github.com/google/uuid"
+)
+
+var _ repositories.CommentRepository = (*CommentRepository)(nil)
+
+type CommentRepository struct {
+	*Store
+}
+
+// AddComment stores a comment. Comments can't be written through the API
+// yet, so tests seed them here.
+func (s *Store) AddComment(comment *models.Comment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	newID(&comment.ID)
+	now := time.Now()
+	if comment.CreatedAt.IsZero() {
+		comment.CreatedAt = now
+	}
+	comment.UpdatedAt = now
+	c := *comment
+	c.User, c.Post = models.User{}, models.Post{}
+	s.comments[c.ID] = &c
+}
+
+func (r *CommentRepository) FindByUserID(userID uuid.UUID) ([]models.Comment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var comments []models.Comment
+	for _, comment := range r.comments {
+		if comment.UserID == userID && !comment.DeletedAt.Valid {
+			comments = append(comments, *comment)
+		}
+	}
+	sort.Slice(comments, func(i, j int) bool {
+		return comments[i].CreatedAt.Before(comments[j].CreatedAt)
+	})
+	return comments, nil
+}
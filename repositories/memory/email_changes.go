@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"time"
+
+	"github.com/cheeszy/journaling/models"
+	"github.com/cheeszy/journaling/repositories"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var _ repositories.EmailChangeRepository = (*EmailChangeRepository)(nil)
+
+type EmailChangeRepository struct {
+	*Store
+}
+
+func (r *EmailChangeRepository) Create(change *models.EmailChange) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, other := range r.emailChanges {
+		if other.ConfirmToken == change.ConfirmToken || other.CancelToken == change.CancelToken {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	newID(&change.ID)
+	now := time.Now()
+	change.CreatedAt, change.UpdatedAt = now, now
+	c := *change
+	r.emailChanges[c.ID] = &c
+	return nil
+}
+
+func (r *EmailChangeRepository) find(match func(*models.EmailChange) bool) (*models.EmailChange, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, change := range r.emailChanges {
+		if match(change) {
+			c := *change
+			return &c, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *EmailChangeRepository) FindByConfirmToken(token string) (*models.EmailChange, error) {
+	return r.find(func(e *models.EmailChange) bool { return e.ConfirmToken == token })
+}
+
+func (r *EmailChangeRepository) FindByCancelToken(token string) (*models.EmailChange, error) {
+	return r.find(func(e *models.EmailChange) bool { return e.CancelToken == token })
+}
+
+func (r *EmailChangeRepository) CancelPending(userID uuid.UUID, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, change := range r.emailChanges {
+		if change.UserID == userID && change.ConfirmedAt == nil && change.CancelledAt == nil {
+			at := now
+			change.CancelledAt = &at
+		}
+	}
+	return nil
+}
+
+func (r *EmailChangeRepository) MarkConfirmed(id uuid.UUID, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if change, ok := r.emailChanges[id]; ok {
+		change.ConfirmedAt = &now
+	}
+	return nil
+}
+
+func (r *EmailChangeRepository) MarkCancelled(id uuid.UUID, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if change, ok := r.emailChanges[id]; ok {
+		change.CancelledAt = &now
+	}
+	return nil
+}
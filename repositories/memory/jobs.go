@@ -0,0 +1,201 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/cheeszy/journaling/models"
+	"github.com/cheeszy/journaling/repositories"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	_ repositories.DataExportRepository = (*DataExportRepository)(nil)
+	_ repositories.ImportJobRepository  = (*ImportJobRepository)(nil)
+)
+
+type DataExportRepository struct {
+	*Store
+}
+
+func cloneExport(export *models.DataExport) *models.DataExport {
+	c := *export
+	if export.DownloadToken != nil {
+		token := *export.DownloadToken
+		c.DownloadToken = &token
+	}
+	return &c
+}
+
+func (r *DataExportRepository) Create(export *models.DataExport) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	newID(&export.ID)
+	now := time.Now()
+	export.CreatedAt, export.UpdatedAt = now, now
+	if export.Status == "" {
+		export.Status = models.ExportStatusPending
+	}
+	r.dataExports[export.ID] = cloneExport(export)
+	return nil
+}
+
+func (r *DataExportRepository) find(match func(*models.DataExport) bool) (*models.DataExport, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, export := range r.dataExports {
+		if match(export) {
+			return cloneExport(export), nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *DataExportRepository) FindActive(userID uuid.UUID) (*models.DataExport, error) {
+	return r.find(func(e *models.DataExport) bool {
+		return e.UserID == userID &&
+			(e.Status == models.ExportStatusPending || e.Status == models.ExportStatusProcessing)
+	})
+}
+
+func (r *DataExportRepository) FindByIDAndUserID(id string, userID uuid.UUID) (*models.DataExport, error) {
+	return r.find(func(e *models.DataExport) bool { return e.ID.String() == id && e.UserID == userID })
+}
+
+func (r *DataExportRepository) FindByToken(token string) (*models.DataExport, error) {
+	return r.find(func(e *models.DataExport) bool { return e.DownloadToken != nil && *e.DownloadToken == token })
+}
+
+func (r *DataExportRepository) Claim(now time.Time, stale time.Duration) (*models.DataExport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var oldest *models.DataExport
+	for _, export := range r.dataExports {
+		claimable := export.Status == models.ExportStatusPending ||
+			(export.Status == models.ExportStatusProcessing && export.UpdatedAt.Before(now.Add(-stale)))
+		if claimable && (oldest == nil || export.CreatedAt.Before(oldest.CreatedAt)) {
+			oldest = export
+		}
+	}
+	if oldest == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	oldest.Status = models.ExportStatusProcessing
+	oldest.UpdatedAt = now
+	return cloneExport(oldest), nil
+}
+
+func (r *DataExportRepository) Update(export *models.DataExport) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	export.UpdatedAt = time.Now()
+	r.dataExports[export.ID] = cloneExport(export)
+	return nil
+}
+
+func (r *DataExportRepository) findAll(match func(*models.DataExport) bool) []models.DataExport {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var exports []models.DataExport
+	for _, export := range r.dataExports {
+		if match(export) {
+			exports = append(exports, *cloneExport(export))
+		}
+	}
+	sort.Slice(exports, func(i, j int) bool { return exports[i].CreatedAt.Before(exports[j].CreatedAt) })
+	return exports
+}
+
+func (r *DataExportRepository) FindExpired(now time.Time) ([]models.DataExport, error) {
+	return r.findAll(func(e *models.DataExport) bool {
+		return e.Status == models.ExportStatusReady && e.ExpiresAt != nil && !e.ExpiresAt.After(now)
+	}), nil
+}
+
+func (r *DataExportRepository) FindByUserID(userID uuid.UUID) ([]models.DataExport, error) {
+	return r.findAll(func(e *models.DataExport) bool { return e.UserID == userID }), nil
+}
+
+type ImportJobRepository struct {
+	*Store
+}
+
+func cloneImportJob(job *models.ImportJob) *models.ImportJob {
+	c := *job
+	c.Errors = append([]models.ImportEntryError(nil), job.Errors...)
+	return &c
+}
+
+func (r *ImportJobRepository) Create(job *models.ImportJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	newID(&job.ID)
+	now := time.Now()
+	job.CreatedAt, job.UpdatedAt = now, now
+	if job.Status == "" {
+		job.Status = models.ImportStatusPending
+	}
+	r.importJobs[job.ID] = cloneImportJob(job)
+	return nil
+}
+
+func (r *ImportJobRepository) FindByIDAndUserID(id string, userID uuid.UUID) (*models.ImportJob, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, job := range r.importJobs {
+		if job.ID.String() == id && job.UserID == userID {
+			return cloneImportJob(job), nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *ImportJobRepository) Claim(now time.Time, stale time.Duration) (*models.ImportJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var oldest *models.ImportJob
+	for _, job := range r.importJobs {
+		claimable := job.Status == models.ImportStatusPending ||
+			(job.Status == models.ImportStatusProcessing && job.UpdatedAt.Before(now.Add(-stale)))
+		if claimable && (oldest == nil || job.CreatedAt.Before(oldest.CreatedAt)) {
+			oldest = job
+		}
+	}
+	if oldest == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	oldest.Status = models.ImportStatusProcessing
+	oldest.UpdatedAt = now
+	return cloneImportJob(oldest), nil
+}
+
+func (r *ImportJobRepository) Update(job *models.ImportJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job.UpdatedAt = time.Now()
+	r.importJobs[job.ID] = cloneImportJob(job)
+	return nil
+}
+
+func (r *ImportJobRepository) FindByUserID(userID uuid.UUID) ([]models.ImportJob, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var jobs []models.ImportJob
+	for _, job := range r.importJobs {
+		if job.UserID == userID {
+			jobs = append(jobs, *cloneImportJob(job))
+		}
+	}
+	return jobs, nil
+}
@@ -0,0 +1,201 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/cheeszy/journaling/models"
+	"github.com/cheeszy/journaling/repositories"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var _ repositories.MetricRepository = (*MetricRepository)(nil)
+
+type MetricRepository struct {
+	*Store
+}
+
+func (r *MetricRepository) Create(metric *models.Metric) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, other := range r.metrics {
+		if other.UserID == metric.UserID && other.Name == metric.Name {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	newID(&metric.ID)
+	now := time.Now()
+	metric.CreatedAt, metric.UpdatedAt = now, now
+	c := *metric
+	r.metrics[c.ID] = &c
+	return nil
+}
+
+func (r *MetricRepository) FindByUserID(userID uuid.UUID) ([]models.Metric, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var metrics []models.Metric
+	for _, metric := range r.metrics {
+		if metric.UserID == userID {
+			metrics = append(metrics, *metric)
+		}
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Name < metrics[j].Name })
+	return metrics, nil
+}
+
+func (r *MetricRepository) FindByIDAndUserID(id string, userID uuid.UUID) (*models.Metric, error) {
+	metricID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	metric, ok := r.metrics[metricID]
+	if !ok || metric.UserID != userID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	c := *metric
+	return &c, nil
+}
+
+func (r *MetricRepository) FindByIDs(userID uuid.UUID, ids []uuid.UUID) ([]models.Metric, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var metrics []models.Metric
+	for _, id := range ids {
+		if metric, ok := r.metrics[id]; ok && metric.UserID == userID {
+			metrics = append(metrics, *metric)
+		}
+	}
+	return metrics, nil
+}
+
+// DeleteByIDAndUserID also deletes the metric's values, like the foreign
+// key's ON DELETE CASCADE.
+func (r *MetricRepository) DeleteByIDAndUserID(id string, userID uuid.UUID) error {
+	metricID, err := uuid.Parse(id)
+	if err != nil {
+		return repositories.ErrMetricNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	metric, ok := r.metrics[metricID]
+	if !ok || metric.UserID != userID {
+		return repositories.ErrMetricNotFound
+	}
+	delete(r.metrics, metricID)
+	for valueID, value := range r.metricValues {
+		if value.MetricID == metricID {
+			delete(r.metricValues, valueID)
+		}
+	}
+	return nil
+}
+
+func (r *MetricRepository) UpsertValues(values []models.MetricValue) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for i := range values {
+		value := &values[i]
+		for _, stored := range r.metricValues {
+			if stored.MetricID == value.MetricID && stored.PostID == value.PostID {
+				value.ID, value.CreatedAt = stored.ID, stored.CreatedAt
+			}
+		}
+		newID(&value.ID)
+		if value.CreatedAt.IsZero() {
+			value.CreatedAt = now
+		}
+		value.UpdatedAt = now
+		c := *value
+		c.Metric = models.Metric{}
+		r.metricValues[c.ID] = &c
+	}
+	return nil
+}
+
+// valuesOfPost returns the post's values with their metric loaded. Callers
+// hold the lock.
+func (s *Store) valuesOfPost(postID uuid.UUID) []models.MetricValue {
+	var values []models.MetricValue
+	for _, value := range s.metricValues {
+		if value.PostID != postID {
+			continue
+		}
+		c := *value
+		if metric, ok := s.metrics[value.MetricID]; ok {
+			c.Metric = *metric
+		}
+		values = append(values, c)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Metric.Name < values[j].Metric.Name })
+	return values
+}
+
+func (r *MetricRepository) FindValuesByPostID(postID uuid.UUID) ([]models.MetricValue, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.valuesOfPost(postID), nil
+}
+
+// truncate mirrors Postgres' date_trunc in UTC, with weeks starting on
+// Monday.
+func truncate(t time.Time, bucket string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch bucket {
+	case "week":
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+func (r *MetricRepository) Series(metricID uuid.UUID, bucket string, from, to, now time.Time) ([]repositories.MetricSeriesRow, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rows := make(map[time.Time]*repositories.MetricSeriesRow)
+	for _, value := range r.metricValues {
+		if value.MetricID != metricID || value.RecordedAt.Before(from) || !value.RecordedAt.Before(to) {
+			continue
+		}
+		post, ok := r.posts[value.PostID]
+		if !ok || post.DeletedAt.Valid || post.IsSealed(now) {
+			continue
+		}
+
+		key := truncate(value.RecordedAt, bucket)
+		row, ok := rows[key]
+		if !ok {
+			row = &repositories.MetricSeriesRow{Bucket: key, Min: value.Value, Max: value.Value}
+			rows[key] = row
+		}
+		row.Count++
+		row.Sum += value.Value
+		row.Min = min(row.Min, value.Value)
+		row.Max = max(row.Max, value.Value)
+	}
+
+	series := make([]repositories.MetricSeriesRow, 0, len(rows))
+	for _, row := range rows {
+		row.Avg = row.Sum / float64(row.Count)
+		series = append(series, *row)
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].Bucket.Before(series[j].Bucket) })
+	return series, nil
+}
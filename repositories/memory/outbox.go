@@ -0,0 +1,158 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/cheeszy/journaling/models"
+	"github.com/cheeszy/journaling/repositories"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var _ repositories.OutboxRepository = (*OutboxRepository)(nil)
+
+type OutboxRepository struct {
+	*Store
+}
+
+func (r *OutboxRepository) Create(email *models.EmailOutbox) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	newID(&email.ID)
+	now := time.Now()
+	email.CreatedAt, email.UpdatedAt = now, now
+	if email.Status == "" {
+		email.Status = models.OutboxStatusPending
+	}
+	c := *email
+	r.outbox[c.ID] = &c
+	return nil
+}
+
+// sorted returns copies of the matching emails in the given order.
+func (r *OutboxRepository) sorted(match func(*models.EmailOutbox) bool, less func(a, b *models.EmailOutbox) bool) []models.EmailOutbox {
+	var emails []models.EmailOutbox
+	for _, email := range r.outbox {
+		if match(email) {
+			emails = append(emails, *email)
+		}
+	}
+	sort.Slice(emails, func(i, j int) bool { return less(&emails[i], &emails[j]) })
+	return emails
+}
+
+func newestEmailFirst(a, b *models.EmailOutbox) bool {
+	return a.CreatedAt.After(b.CreatedAt)
+}
+
+func (r *OutboxRepository) ClaimDue(now time.Time, lease time.Duration, limit int) ([]models.EmailOutbox, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	emails := r.sorted(func(e *models.EmailOutbox) bool {
+		return e.Status == models.OutboxStatusPending && !e.NextAttemptAt.After(now)
+	}, func(a, b *models.EmailOutbox) bool {
+		return a.NextAttemptAt.Before(b.NextAttemptAt)
+	})
+	if len(emails) > limit {
+		emails = emails[:limit]
+	}
+	for _, email := range emails {
+		r.outbox[email.ID].NextAttemptAt = now.Add(lease)
+	}
+	return emails, nil
+}
+
+func (r *OutboxRepository) update(id uuid.UUID, fn func(*models.EmailOutbox)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if email, ok := r.outbox[id]; ok {
+		fn(email)
+		email.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (r *OutboxRepository) MarkSent(id uuid.UUID, attempts int, at time.Time) error {
+	return r.update(id, func(e *models.EmailOutbox) {
+		e.Status = models.OutboxStatusSent
+		e.Attempts = attempts
+		e.SentAt = &at
+		e.LastError = ""
+	})
+}
+
+func (r *OutboxRepository) MarkFailed(id uuid.UUID, status string, attempts int, next time.Time, lastError string) error {
+	return r.update(id, func(e *models.EmailOutbox) {
+		e.Status = status
+		e.Attempts = attempts
+		e.NextAttemptAt = next
+		e.LastError = lastError
+	})
+}
+
+func (r *OutboxRepository) Find(status string, limit int) ([]models.EmailOutbox, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	emails := r.sorted(func(e *models.EmailOutbox) bool {
+		return status == "" || e.Status == status
+	}, newestEmailFirst)
+	if len(emails) > limit {
+		emails = emails[:limit]
+	}
+	return emails, nil
+}
+
+func (r *OutboxRepository) FindByID(id string) (*models.EmailOutbox, error) {
+	emailID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	email, ok := r.outbox[emailID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	c := *email
+	return &c, nil
+}
+
+func (r *OutboxRepository) FindLatest(userID uuid.UUID, template string) (*models.EmailOutbox, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	emails := r.sorted(func(e *models.EmailOutbox) bool {
+		return e.UserID != nil && *e.UserID == userID && e.Template == template
+	}, newestEmailFirst)
+	if len(emails) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &emails[0], nil
+}
+
+func (r *OutboxRepository) Requeue(id string, now time.Time) (int64, error) {
+	emailID, err := uuid.Parse(id)
+	if err != nil {
+		return 0, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	email, ok := r.outbox[emailID]
+	if !ok || email.Status != models.OutboxStatusDead {
+		return 0, nil
+	}
+	email.Status = models.OutboxStatusPending
+	email.Attempts = 0
+	email.NextAttemptAt = now
+	email.UpdatedAt = time.Now()
+	return 1, nil
+}
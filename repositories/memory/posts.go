@@ -0,0 +1,322 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cheeszy/journaling/models"
+	"github.com/cheeszy/journaling/repositories"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var _ repositories.PostRepository = (*PostRepository)(nil)
+
+type PostRepository struct {
+	*Store
+}
+
+func clonePost(post *models.Post) *models.Post {
+	c := *post
+	c.User = models.User{}
+	c.MetricValues = nil
+	return &c
+}
+
+func (r *PostRepository) Create(post *models.Post) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	newID(&post.ID)
+	if _, ok := r.posts[post.ID]; ok {
+		return gorm.ErrDuplicatedKey
+	}
+	now := time.Now()
+	if post.CreatedAt.IsZero() {
+		post.CreatedAt = now
+	}
+	if post.UpdatedAt.IsZero() {
+		post.UpdatedAt = now
+	}
+	if post.Kind == "" {
+		post.Kind = models.PostKindText
+	}
+	if post.Status == "" {
+		post.Status = models.PostStatusPublished
+	}
+	r.posts[post.ID] = clonePost(post)
+	return nil
+}
+
+func (r *PostRepository) Update(post *models.Post) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.posts[post.ID] = clonePost(post)
+	return nil
+}
+
+func (r *PostRepository) Autosave(post *models.Post, fields map[string]interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.live(post.ID)
+	if !ok {
+		return nil
+	}
+	for column, value := range fields {
+		switch column {
+		case "title":
+			stored.Title = value.(string)
+		case "body":
+			stored.Body = value.(string)
+		case "transcript":
+			stored.Transcript = value.(string)
+		case "autosaved_at":
+			at := value.(time.Time)
+			stored.AutosavedAt = &at
+		default:
+			return fmt.Errorf("memory: autosaving column %q isn't supported", column)
+		}
+	}
+	return nil
+}
+
+func (r *PostRepository) UpdateCover(post *models.Post) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if stored, ok := r.live(post.ID); ok {
+		stored.CoverKey = post.CoverKey
+		stored.CoverContentType = post.CoverContentType
+		stored.CoverWidth = post.CoverWidth
+		stored.CoverHeight = post.CoverHeight
+		stored.CoverBytes = post.CoverBytes
+		stored.CoverUpdatedAt = post.CoverUpdatedAt
+	}
+	return nil
+}
+
+func (r *PostRepository) DeleteByID(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	postID, err := uuid.Parse(id)
+	if err != nil {
+		return repositories.ErrPostNotFound
+	}
+	post, ok := r.live(postID)
+	if !ok {
+		return repositories.ErrPostNotFound
+	}
+	post.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	return nil
+}
+
+// live returns the stored post unless it's missing or soft deleted.
+func (r *PostRepository) live(id uuid.UUID) (*models.Post, bool) {
+	post, ok := r.posts[id]
+	if !ok || post.DeletedAt.Valid {
+		return nil, false
+	}
+	return post, true
+}
+
+// filter returns copies of the live posts that match, oldest first.
+func (r *PostRepository) filter(match func(*models.Post) bool) []models.Post {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var posts []models.Post
+	for _, post := range r.posts {
+		if !post.DeletedAt.Valid && match(post) {
+			posts = append(posts, *clonePost(post))
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].CreatedAt.Before(posts[j].CreatedAt)
+	})
+	return posts
+}
+
+// withMetricValues loads the posts' metric values together with their
+// metric, like Preload("MetricValues.Metric").
+func (r *PostRepository) withMetricValues(posts []models.Post) []models.Post {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i := range posts {
+		posts[i].MetricValues = r.valuesOfPost(posts[i].ID)
+	}
+	return posts
+}
+
+func newestFirst(posts []models.Post) []models.Post {
+	for i, j := 0, len(posts)-1; i < j; i, j = i+1, j-1 {
+		posts[i], posts[j] = posts[j], posts[i]
+	}
+	return posts
+}
+
+func (r *PostRepository) FindByID(id string) (*models.Post, error) {
+	postID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	post, ok := r.live(postID)
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return clonePost(post), nil
+}
+
+func (r *PostRepository) FindByIDAndUserID(id string, userID uuid.UUID) (*models.Post, error) {
+	post, err := r.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if post.UserID != userID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return post, nil
+}
+
+func (r *PostRepository) LockByID(id uuid.UUID) (*models.Post, error) {
+	return r.FindByID(id.String())
+}
+
+func (r *PostRepository) FindByUsername(username string) ([]models.Post, error) {
+	r.mu.RLock()
+	user, ok := r.userWhere(func(u *models.User) bool { return strings.EqualFold(u.Username, username) })
+	r.mu.RUnlock()
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	posts := r.filter(func(p *models.Post) bool { return p.UserID == user.ID })
+	return r.withMetricValues(newestFirst(posts)), nil
+}
+
+func (r *PostRepository) FindPublished() ([]models.Post, error) {
+	return r.filter(func(p *models.Post) bool {
+		return p.Status == models.PostStatusPublished
+	}), nil
+}
+
+func (r *PostRepository) FindAllByUserID(userID uuid.UUID) ([]models.Post, error) {
+	posts := r.filter(func(p *models.Post) bool { return p.UserID == userID })
+	return r.withMetricValues(posts), nil
+}
+
+func (r *PostRepository) FindPublishedByUserID(userID uuid.UUID) ([]models.Post, error) {
+	return r.filter(func(p *models.Post) bool {
+		return p.UserID == userID && p.Status == models.PostStatusPublished
+	}), nil
+}
+
+func (r *PostRepository) FindPublishedInRange(userID uuid.UUID, from, to time.Time) ([]models.Post, error) {
+	return r.filter(func(p *models.Post) bool {
+		return p.UserID == userID && p.Status == models.PostStatusPublished &&
+			!p.CreatedAt.Before(from) && p.CreatedAt.Before(to)
+	}), nil
+}
+
+func (r *PostRepository) FindOnThisDay(userID uuid.UUID, timezone string, month, day, year int) ([]models.Post, error) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, err
+	}
+	posts := r.filter(func(p *models.Post) bool {
+		created := p.CreatedAt.In(loc)
+		return p.UserID == userID && p.Status == models.PostStatusPublished &&
+			int(created.Month()) == month && created.Day() == day && created.Year() < year
+	})
+	return r.withMetricValues(newestFirst(posts)), nil
+}
+
+// FindCoveredIDsByUserID includes soft deleted posts, like the GORM version.
+func (r *PostRepository) FindCoveredIDsByUserID(userID uuid.UUID) ([]uuid.UUID, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var ids []uuid.UUID
+	for _, post := range r.posts {
+		if post.UserID == userID && post.CoverKey != "" {
+			ids = append(ids, post.ID)
+		}
+	}
+	return ids, nil
+}
+
+// Search matches posts containing every word of the query, ignoring case,
+// newest first. It doesn't understand the quoting and operators Postgres
+// accepts.
+func (r *PostRepository) Search(userID uuid.UUID, query string, now time.Time, limit int) ([]models.Post, error) {
+	words := strings.Fields(strings.ToLower(query))
+	posts := newestFirst(r.filter(func(p *models.Post) bool {
+		if p.UserID != userID || p.IsSealed(now) {
+			return false
+		}
+		body := p.Body
+		if p.BodyEncrypted {
+			body = ""
+		}
+		text := strings.ToLower(p.Title + " " + body + " " + p.Transcript)
+		for _, word := range words {
+			if !strings.Contains(text, word) {
+				return false
+			}
+		}
+		return true
+	}))
+	if len(posts) > limit {
+		posts = posts[:limit]
+	}
+	return r.withMetricValues(posts), nil
+}
+
+func (r *PostRepository) PublishDue(now time.Time) ([]models.Post, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var posts []models.Post
+	for _, post := range r.posts {
+		if post.DeletedAt.Valid || post.Status != models.PostStatusScheduled ||
+			post.PublishAt == nil || post.PublishAt.After(now) {
+			continue
+		}
+		post.Status = models.PostStatusPublished
+		posts = append(posts, *clonePost(post))
+	}
+	return posts, nil
+}
+
+func (r *PostRepository) FindUnsealedToNotify(now time.Time) ([]models.Post, error) {
+	posts := r.filter(func(p *models.Post) bool {
+		return p.SealedUntil != nil && !p.SealedUntil.After(now) && p.UnsealNotifiedAt == nil
+	})
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i := range posts {
+		if user, ok := r.users[posts[i].UserID]; ok {
+			posts[i].User = *cloneUser(user)
+		}
+	}
+	return posts, nil
+}
+
+func (r *PostRepository) MarkUnsealNotified(id uuid.UUID, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if post, ok := r.live(id); ok {
+		post.UnsealNotifiedAt = &at
+	}
+	return nil
+}
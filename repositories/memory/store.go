@@ -0,0 +1,76 @@
+// Package memory implements the repository interfaces in memory, so the
+// services can run without Postgres. Transactions aren't supported: every
+// write takes effect immediately.
+package memory
+
+import (
+	"sync"
+
+	"github.com/cheeszy/journaling/models"
+	"github.com/cheeszy/journaling/repositories"
+	"github.com/google/uuid"
+)
+
+// Store holds every table. The repositories share it, so queries that span
+// tables, such as loading a post's metric values or deleting an account,
+// behave like their SQL counterparts.
+type Store struct {
+	mu sync.RWMutex
+
+	users           map[uuid.UUID]*models.User
+	posts           map[uuid.UUID]*models.Post
+	metrics         map[uuid.UUID]*models.Metric
+	metricValues    map[uuid.UUID]*models.MetricValue
+	attachments     map[uuid.UUID]*models.Attachment
+	comments        map[uuid.UUID]*models.Comment
+	outbox          map[uuid.UUID]*models.EmailOutbox
+	emailChanges    map[uuid.UUID]*models.EmailChange
+	usernameHistory map[uuid.UUID]*models.UsernameHistory
+	dataExports     map[uuid.UUID]*models.DataExport
+	importJobs      map[uuid.UUID]*models.ImportJob
+}
+
+func NewStore() *Store {
+	return &Store{
+		users:           make(map[uuid.UUID]*models.User),
+		posts:           make(map[uuid.UUID]*models.Post),
+		metrics:         make(map[uuid.UUID]*models.Metric),
+		metricValues:    make(map[uuid.UUID]*models.MetricValue),
+		attachments:     make(map[uuid.UUID]*models.Attachment),
+		comments:        make(map[uuid.UUID]*models.Comment),
+		outbox:          make(map[uuid.UUID]*models.EmailOutbox),
+		emailChanges:    make(map[uuid.UUID]*models.EmailChange),
+		usernameHistory: make(map[uuid.UUID]*models.UsernameHistory),
+		dataExports:     make(map[uuid.UUID]*models.DataExport),
+		importJobs:      make(map[uuid.UUID]*models.ImportJob),
+	}
+}
+
+// Repositories returns every repository, all backed by s.
+func (s *Store) Repositories() repositories.Repositories {
+	return repositories.Repositories{
+		Users:           &UserRepository{s},
+		Posts:           &PostRepository{s},
+		Metrics:         &MetricRepository{s},
+		Attachments:     &AttachmentRepository{s},
+		Comments:        &CommentRepository{s},
+		Outbox:          &OutboxRepository{s},
+		EmailChanges:    &EmailChangeRepository{s},
+		UsernameHistory: &UsernameHistoryRepository{s},
+		DataExports:     &DataExportRepository{s},
+		ImportJobs:      &ImportJobRepository{s},
+		Accounts:        &AccountRepository{s},
+	}
+}
+
+// New returns the repositories of a new, empty store.
+func New() repositories.Repositories {
+	return NewStore().Repositories()
+}
+
+// newID fills in the primary key like the database default would.
+func newID(id *uuid.UUID) {
+	if *id == uuid.Nil {
+		*id = uuid.New()
+	}
+}
@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"strings"
+	"time"
+
+	"github.com/cheeszy/journaling/models"
+	"github.com/cheeszy/journaling/repositories"
+	"gorm.io/gorm"
+)
+
+var _ repositories.UsernameHistoryRepository = (*UsernameHistoryRepository)(nil)
+
+type UsernameHistoryRepository struct {
+	*Store
+}
+
+func (r *UsernameHistoryRepository) Create(entry *models.UsernameHistory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	newID(&entry.ID)
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	c := *entry
+	r.usernameHistory[c.ID] = &c
+	return nil
+}
+
+func (r *UsernameHistoryRepository) FindReserved(username string, now time.Time) (*models.UsernameHistory, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var latest *models.UsernameHistory
+	for _, entry := range r.usernameHistory {
+		if !strings.EqualFold(entry.OldUsername, username) || !entry.ReservedUntil.After(now) {
+			continue
+		}
+		if latest == nil || entry.CreatedAt.After(latest.CreatedAt) {
+			latest = entry
+		}
+	}
+	if latest == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	c := *latest
+	return &c, nil
+}
@@ -0,0 +1,242 @@
+package memory
+
+import (
+	"strings"
+	"time"
+
+	"github.com/cheeszy/journaling/models"
+	"github.com/cheeszy/journaling/repositories"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var _ repositories.UserRepository = (*UserRepository)(nil)
+
+type UserRepository struct {
+	*Store
+}
+
+// cloneUser copies the user without its associations, so callers never share
+// memory with the repository.
+func cloneUser(user *models.User) *models.User {
+	c := *user
+	c.Posts = nil
+	return &c
+}
+
+func (r *UserRepository) conflicts(user *models.User) bool {
+	for id, other := range r.users {
+		if id != user.ID && (other.Email == user.Email || strings.EqualFold(other.Username, user.Username)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *UserRepository) Create(user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	newID(&user.ID)
+	if _, ok := r.users[user.ID]; ok || r.conflicts(user) {
+		return gorm.ErrDuplicatedKey
+	}
+	now := time.Now()
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	user.UpdatedAt = now
+	if user.Timezone == "" {
+		user.Timezone = "UTC"
+	}
+	if user.Plan == "" {
+		user.Plan = models.PlanFree
+	}
+	if user.DigestHour == 0 {
+		user.DigestHour = 8
+	}
+	r.users[user.ID] = cloneUser(user)
+	return nil
+}
+
+func (r *UserRepository) Update(user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conflicts(user) {
+		return gorm.ErrDuplicatedKey
+	}
+	user.UpdatedAt = time.Now()
+	r.users[user.ID] = cloneUser(user)
+	return nil
+}
+
+// userWhere returns the first stored user that matches. Callers hold the
+// lock.
+func (s *Store) userWhere(match func(*models.User) bool) (*models.User, bool) {
+	for _, user := range s.users {
+		if match(user) {
+			return user, true
+		}
+	}
+	return nil, false
+}
+
+func (r *UserRepository) find(match func(*models.User) bool) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if user, ok := r.userWhere(match); ok {
+		return cloneUser(user), nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *UserRepository) FindByID(id uuid.UUID) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return u.ID == id })
+}
+
+func (r *UserRepository) FindByEmail(email string) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return u.Email == email })
+}
+
+func (r *UserRepository) FindByEmailOrUsername(identifier string) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return u.Email == identifier || strings.EqualFold(u.Username, identifier) })
+}
+
+func (r *UserRepository) FindByUsername(username string) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return strings.EqualFold(u.Username, username) })
+}
+
+func (r *UserRepository) FindByVerificationToken(token string) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return token != "" && u.VerificationToken == token })
+}
+
+func (r *UserRepository) FindByRecoveryKey(recoveryKey string) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return recoveryKey != "" && u.RecoveryKey == recoveryKey })
+}
+
+func (r *UserRepository) FindDigestSubscribers() ([]models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var users []models.User
+	for _, user := range r.users {
+		if user.DigestEnabled && user.IsVerified {
+			users = append(users, *cloneUser(user))
+		}
+	}
+	return users, nil
+}
+
+// update applies fn to the stored user. Like a GORM update by ID, a missing
+// user isn't an error.
+func (r *UserRepository) update(userID uuid.UUID, fn func(*models.User)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user, ok := r.users[userID]; ok {
+		fn(user)
+		user.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (r *UserRepository) UpdateUsername(userID uuid.UUID, newUsername string, changedAt time.Time) error {
+	r.mu.RLock()
+	taken := r.conflicts(&models.User{ID: userID, Username: newUsername})
+	r.mu.RUnlock()
+	if taken {
+		return gorm.ErrDuplicatedKey
+	}
+	return r.update(userID, func(u *models.User) {
+		u.Username = newUsername
+		u.UsernameChangedAt = &changedAt
+	})
+}
+
+func (r *UserRepository) UpdateEmail(userID uuid.UUID, newEmail string) error {
+	r.mu.RLock()
+	taken := r.conflicts(&models.User{ID: userID, Email: newEmail})
+	r.mu.RUnlock()
+	if taken {
+		return gorm.ErrDuplicatedKey
+	}
+	return r.update(userID, func(u *models.User) {
+		u.Email = newEmail
+		u.IsVerified = true
+		u.VerificationToken = ""
+		u.VerificationExpiresAt = time.Time{}
+		u.ResendCount = 0
+	})
+}
+
+func (r *UserRepository) UpdateTimezone(userID uuid.UUID, timezone string) error {
+	return r.update(userID, func(u *models.User) { u.Timezone = timezone })
+}
+
+func (r *UserRepository) UpdateDigestSettings(userID uuid.UUID, enabled bool, hour int) error {
+	return r.update(userID, func(u *models.User) {
+		u.DigestEnabled = enabled
+		u.DigestHour = hour
+	})
+}
+
+func (r *UserRepository) UpdateLastDigestDate(userID uuid.UUID, date string) error {
+	return r.update(userID, func(u *models.User) { u.LastDigestDate = date })
+}
+
+func (r *UserRepository) UpdatePlan(userID uuid.UUID, plan string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	user.Plan = plan
+	return nil
+}
+
+func (r *UserRepository) ClearRecoveryKeyPending(userID uuid.UUID) error {
+	return r.update(userID, func(u *models.User) { u.RecoveryKeyPending = false })
+}
+
+func (r *UserRepository) SetContentKeyByServer(userID uuid.UUID, key string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok || user.EncryptedContentKeyByServer != "" {
+		return false, nil
+	}
+	user.EncryptedContentKeyByServer = key
+	return true, nil
+}
+
+func (r *UserRepository) LockUsage(userID uuid.UUID) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &models.User{
+		ID:          user.ID,
+		Plan:        user.Plan,
+		PostCount:   user.PostCount,
+		StoredBytes: user.StoredBytes,
+	}, nil
+}
+
+func (r *UserRepository) AddUsage(userID uuid.UUID, posts, bytes int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user, ok := r.users[userID]; ok {
+		user.PostCount += posts
+		user.StoredBytes += bytes
+	}
+	return nil
+}
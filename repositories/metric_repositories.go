@@ -0,0 +1,117 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cheeszy/journaling/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type MetricSeriesRow struct {
+	Bucket time.Time
+	Count  int64
+	Avg    float64
+	Min    float64
+	Max    float64
+	Sum    float64
+}
+
+// MetricRepository stores metrics and the values recorded on posts.
+type MetricRepository interface {
+	Create(metric *models.Metric) error
+	// FindByUserID returns the user's metrics ordered by name.
+	FindByUserID(userID uuid.UUID) ([]models.Metric, error)
+	FindByIDAndUserID(id string, userID uuid.UUID) (*models.Metric, error)
+	FindByIDs(userID uuid.UUID, ids []uuid.UUID) ([]models.Metric, error)
+	DeleteByIDAndUserID(id string, userID uuid.UUID) error
+
+	// UpsertValues sets the value of each metric on a post, replacing any
+	// value previously recorded for the same metric.
+	UpsertValues(values []models.MetricValue) error
+	// FindValuesByPostID returns the post's values with their metric loaded.
+	FindValuesByPostID(postID uuid.UUID) ([]models.MetricValue, error)
+	// Series aggregates a metric's values into day, week or month buckets.
+	// Values on deleted or still-sealed posts are left out.
+	Series(metricID uuid.UUID, bucket string, from, to, now time.Time) ([]MetricSeriesRow, error)
+}
+
+// ErrMetricNotFound is returned when deleting a metric that doesn't exist.
+var ErrMetricNotFound = errors.New("metric not found or unauthorized")
+
+type metricRepository struct {
+	db *gorm.DB
+}
+
+func NewMetricRepository(db *gorm.DB) MetricRepository {
+	return &metricRepository{db: db}
+}
+
+func (r *metricRepository) Create(metric *models.Metric) error {
+	return r.db.Create(metric).Error
+}
+
+func (r *metricRepository) FindByUserID(userID uuid.UUID) ([]models.Metric, error) {
+	var metrics []models.Metric
+	err := r.db.Where("user_id = ?", userID).Order("name").Find(&metrics).Error
+	return metrics, err
+}
+
+func (r *metricRepository) FindByIDAndUserID(id string, userID uuid.UUID) (*models.Metric, error) {
+	var metric models.Metric
+	if err := r.db.First(&metric, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		return nil, err
+	}
+	return &metric, nil
+}
+
+func (r *metricRepository) FindByIDs(userID uuid.UUID, ids []uuid.UUID) ([]models.Metric, error) {
+	var metrics []models.Metric
+	err := r.db.Where("user_id = ? AND id IN ?", userID, ids).Find(&metrics).Error
+	return metrics, err
+}
+
+func (r *metricRepository) DeleteByIDAndUserID(id string, userID uuid.UUID) error {
+	res := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.Metric{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrMetricNotFound
+	}
+	return nil
+}
+
+func (r *metricRepository) UpsertValues(values []models.MetricValue) error {
+	if len(values) == 0 {
+		return nil
+	}
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "metric_id"}, {Name: "post_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "recorded_at", "updated_at"}),
+	}).Create(&values).Error
+}
+
+func (r *metricRepository) FindValuesByPostID(postID uuid.UUID) ([]models.MetricValue, error) {
+	var values []models.MetricValue
+	err := r.db.Preload("Metric").Where("post_id = ?", postID).Find(&values).Error
+	return values, err
+}
+
+func (r *metricRepository) Series(metricID uuid.UUID, bucket string, from, to, now time.Time) ([]MetricSeriesRow, error) {
+	var rows []MetricSeriesRow
+	err := r.db.Model(&models.MetricValue{}).
+		Select("date_trunc(?, metric_values.recorded_at) AS bucket, COUNT(*) AS count, "+
+			"AVG(metric_values.value) AS avg, MIN(metric_values.value) AS min, "+
+			"MAX(metric_values.value) AS max, SUM(metric_values.value) AS sum", bucket).
+		Joins("JOIN posts ON posts.id = metric_values.post_id AND posts.deleted_at IS NULL").
+		Where("metric_values.metric_id = ?", metricID).
+		Where("metric_values.recorded_at >= ? AND metric_values.recorded_at < ?", from, to).
+		Where("posts.sealed_until IS NULL OR posts.sealed_until <= ?", now).
+		Group("bucket").
+		Order("bucket").
+		Scan(&rows).Error
+	return rows, err
+}
@@ -2,59 +2,221 @@ package repositories
 
 import (
 	"errors"
+	"time"
 
 	"github.com/cheeszy/journaling/models"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-func CreatePost(db *gorm.DB, post *models.Post) error {
-	return db.Create(post).Error
+// PostRepository stores posts. Lookups return gorm.ErrRecordNotFound when
+// nothing matches, whatever the implementation.
+type PostRepository interface {
+	Create(post *models.Post) error
+	Update(post *models.Post) error
+	// Autosave writes the given columns without touching updated_at, so
+	// frequent autosaves don't count as a new revision of the post.
+	Autosave(post *models.Post, fields map[string]interface{}) error
+	// UpdateCover saves the post's cover photo fields, including cleared ones.
+	UpdateCover(post *models.Post) error
+	DeleteByID(id string) error
+
+	FindByID(id string) (*models.Post, error)
+	FindByIDAndUserID(id string, userID uuid.UUID) (*models.Post, error)
+	// LockByID reads the post and locks its row until the transaction ends.
+	LockByID(id uuid.UUID) (*models.Post, error)
+	// FindByUsername returns the posts of the user with the given username,
+	// ignoring case, newest first.
+	FindByUsername(username string) ([]models.Post, error)
+	FindPublished() ([]models.Post, error)
+	// FindAllByUserID returns every post of the user, oldest first.
+	FindAllByUserID(userID uuid.UUID) ([]models.Post, error)
+	FindPublishedByUserID(userID uuid.UUID) ([]models.Post, error)
+	// FindPublishedInRange returns the user's published posts created in
+	// [from, to), oldest first.
+	FindPublishedInRange(userID uuid.UUID, from, to time.Time) ([]models.Post, error)
+	// FindOnThisDay returns published posts written on the given month and
+	// day in earlier years, evaluated in the given time zone.
+	FindOnThisDay(userID uuid.UUID, timezone string, month, day, year int) ([]models.Post, error)
+	FindCoveredIDsByUserID(userID uuid.UUID) ([]uuid.UUID, error)
+	// Search returns up to limit of the user's posts matching a web search
+	// style query, best matches first. Posts sealed at now are skipped.
+	Search(userID uuid.UUID, query string, now time.Time, limit int) ([]models.Post, error)
+
+	// PublishDue publishes scheduled posts that are due and returns them.
+	PublishDue(now time.Time) ([]models.Post, error)
+	// FindUnsealedToNotify returns unsealed time capsules whose owner hasn't
+	// been told yet, with the owner loaded.
+	FindUnsealedToNotify(now time.Time) ([]models.Post, error)
+	MarkUnsealNotified(id uuid.UUID, at time.Time) error
+}
+
+// ErrPostNotFound is returned when deleting a post that doesn't exist.
+var ErrPostNotFound = errors.New("post not found or unauthorized")
+
+type postRepository struct {
+	db *gorm.DB
+}
+
+func NewPostRepository(db *gorm.DB) PostRepository {
+	return &postRepository{db: db}
+}
+
+func (r *postRepository) Create(post *models.Post) error {
+	return r.db.Create(post).Error
+}
+
+func (r *postRepository) Update(post *models.Post) error {
+	return r.db.Save(post).Error
+}
+
+func (r *postRepository) Autosave(post *models.Post, fields map[string]interface{}) error {
+	return r.db.Model(post).UpdateColumns(fields).Error
+}
+
+func (r *postRepository) UpdateCover(post *models.Post) error {
+	return r.db.Model(post).
+		Select("cover_key", "cover_content_type", "cover_width", "cover_height", "cover_bytes", "cover_updated_at").
+		Updates(post).Error
+}
+
+func (r *postRepository) DeleteByID(id string) error {
+	res := r.db.Where("id = ?", id).Delete(&models.Post{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrPostNotFound
+	}
+	return nil
+}
+
+func (r *postRepository) FindByID(id string) (*models.Post, error) {
+	var post models.Post
+	if err := r.db.First(&post, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+func (r *postRepository) FindByIDAndUserID(id string, userID uuid.UUID) (*models.Post, error) {
+	var post models.Post
+	if err := r.db.First(&post, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		return nil, err
+	}
+	return &post, nil
 }
 
-func FindPostByID(db *gorm.DB, id string) (*models.Post, error) {
+func (r *postRepository) LockByID(id uuid.UUID) (*models.Post, error) {
 	var post models.Post
-	if err := db.First(&post, "id = ?", id).Error; err != nil {
+	if err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&post, "id = ?", id).Error; err != nil {
 		return nil, err
 	}
 	return &post, nil
 }
 
-func FindUserWithPostsByUsername(db *gorm.DB, username string) (*models.User, error) {
+func (r *postRepository) FindByUsername(username string) ([]models.Post, error) {
 	var user models.User
-	if err := db.Preload("Posts", func(db *gorm.DB) *gorm.DB {
+	if err := r.db.Preload("Posts", func(db *gorm.DB) *gorm.DB {
 		return db.Order("created_at DESC")
-	}).Where("username = ?", username).First(&user).Error; err != nil {
+	}).Preload("Posts.MetricValues.Metric").Where("LOWER(username) = LOWER(?)", username).First(&user).Error; err != nil {
 		return nil, err
 	}
-	return &user, nil
+	return user.Posts, nil
 }
 
-func UpdatePost(db *gorm.DB, post *models.Post) error {
-	return db.Save(post).Error
+func (r *postRepository) FindPublished() ([]models.Post, error) {
+	var posts []models.Post
+	err := r.db.Where("status = ?", models.PostStatusPublished).Find(&posts).Error
+	return posts, err
 }
 
-func DeletePostByID(db *gorm.DB, id string) error {
-	res := db.Where("id = ?", id).Delete(&models.Post{})
-	if res.Error != nil {
-		return res.Error
-	}
-	if res.RowsAffected == 0 {
-		return errors.New("post not found or unauthorized")
-	}
-	return nil
+func (r *postRepository) FindAllByUserID(userID uuid.UUID) ([]models.Post, error) {
+	var posts []models.Post
+	err := r.db.Preload("MetricValues.Metric").
+		Where("user_id = ?", userID).
+		Order("created_at").
+		Find(&posts).Error
+	return posts, err
 }
 
-func FindAllPosts(db *gorm.DB) ([]models.Post, error) {
+func (r *postRepository) FindPublishedByUserID(userID uuid.UUID) ([]models.Post, error) {
 	var posts []models.Post
-	err := db.Find(&posts).Error
+	err := r.db.Where("user_id = ? AND status = ?", userID, models.PostStatusPublished).
+		Order("created_at").
+		Find(&posts).Error
 	return posts, err
 }
 
-func GetPostsByUserID(db *gorm.DB, userID uuid.UUID) ([]models.Post, error) {
+func (r *postRepository) FindPublishedInRange(userID uuid.UUID, from, to time.Time) ([]models.Post, error) {
 	var posts []models.Post
-	if err := db.Where("user_id = ?", userID).Find(&posts).Error; err != nil {
-		return nil, err
-	}
-	return posts, nil
+	err := r.db.Where("user_id = ? AND status = ?", userID, models.PostStatusPublished).
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Order("created_at").
+		Find(&posts).Error
+	return posts, err
+}
+
+func (r *postRepository) FindOnThisDay(userID uuid.UUID, timezone string, month, day, year int) ([]models.Post, error) {
+	var posts []models.Post
+	err := r.db.Preload("MetricValues.Metric").
+		Where("user_id = ? AND status = ?", userID, models.PostStatusPublished).
+		Where("EXTRACT(MONTH FROM created_at AT TIME ZONE ?) = ?", timezone, month).
+		Where("EXTRACT(DAY FROM created_at AT TIME ZONE ?) = ?", timezone, day).
+		Where("EXTRACT(YEAR FROM created_at AT TIME ZONE ?) < ?", timezone, year).
+		Order("created_at DESC").
+		Find(&posts).Error
+	return posts, err
 }
+
+func (r *postRepository) FindCoveredIDsByUserID(userID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.Unscoped().Model(&models.Post{}).
+		Where("user_id = ? AND cover_key IS NOT NULL AND cover_key <> ''", userID).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+func (r *postRepository) Search(userID uuid.UUID, query string, now time.Time, limit int) ([]models.Post, error) {
+	var posts []models.Post
+	err := r.db.Preload("MetricValues.Metric").
+		Where("user_id = ?", userID).
+		Where("sealed_until IS NULL OR sealed_until <= ?", now).
+		Where(postSearchDocument+" @@ websearch_to_tsquery('simple', ?)", query).
+		Order(clause.OrderBy{Expression: clause.Expr{
+			SQL:  "ts_rank(" + postSearchDocument + ", websearch_to_tsquery('simple', ?)) DESC, created_at DESC",
+			Vars: []interface{}{query},
+		}}).
+		Limit(limit).
+		Find(&posts).Error
+	return posts, err
+}
+
+func (r *postRepository) PublishDue(now time.Time) ([]models.Post, error) {
+	var posts []models.Post
+	err := r.db.Model(&posts).
+		Clauses(clause.Returning{}).
+		Where("status = ? AND publish_at <= ?", models.PostStatusScheduled, now).
+		Update("status", models.PostStatusPublished).Error
+	return posts, err
+}
+
+func (r *postRepository) FindUnsealedToNotify(now time.Time) ([]models.Post, error) {
+	var posts []models.Post
+	err := r.db.Preload("User").
+		Where("sealed_until <= ? AND unseal_notified_at IS NULL", now).
+		Find(&posts).Error
+	return posts, err
+}
+
+func (r *postRepository) MarkUnsealNotified(id uuid.UUID, at time.Time) error {
+	return r.db.Model(&models.Post{}).Where("id = ?", id).UpdateColumn("unseal_notified_at", at).Error
+}
+
+// postSearchDocument is the text search vector of a post. Encrypted bodies
+// are left out, since their ciphertext can't match anything.
+// idx_posts_search in migrations/0002_encrypted_post_bodies.up.sql indexes
+// the same expression, so the two must stay identical.
+const postSearchDocument = `to_tsvector('simple', title || ' ' || ` +
+	`CASE WHEN body_encrypted THEN '' ELSE COALESCE(body, '') END || ' ' || transcript)`
@@ -0,0 +1,36 @@
+package repositories
+
+import "gorm.io/gorm"
+
+// Repositories bundles every repository the services use, so they can be
+// swapped together for a transaction or for in-memory fakes.
+type Repositories struct {
+	Users           UserRepository
+	Posts           PostRepository
+	Metrics         MetricRepository
+	Attachments     AttachmentRepository
+	Comments        CommentRepository
+	Outbox          OutboxRepository
+	EmailChanges    EmailChangeRepository
+	UsernameHistory UsernameHistoryRepository
+	DataExports     DataExportRepository
+	ImportJobs      ImportJobRepository
+	Accounts        AccountRepository
+}
+
+// New returns the GORM-backed repositories for db.
+func New(db *gorm.DB) Repositories {
+	return Repositories{
+		Users:           NewUserRepository(db),
+		Posts:           NewPostRepository(db),
+		Metrics:         NewMetricRepository(db),
+		Attachments:     NewAttachmentRepository(db),
+		Comments:        NewCommentRepository(db),
+		Outbox:          NewOutboxRepository(db),
+		EmailChanges:    NewEmailChangeRepository(db),
+		UsernameHistory: NewUsernameHistoryRepository(db),
+		DataExports:     NewDataExportRepository(db),
+		ImportJobs:      NewImportJobRepository(db),
+		Accounts:        NewAccountRepository(db),
+	}
+}
@@ -1,53 +1,175 @@
 package repositories
 
 import (
+	"time"
+
 	"github.com/cheeszy/journaling/models"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-func FindUserByRecoveryKey(db *gorm.DB, recoveryKey string) (models.User, error) {
-	var user models.User
-	err := db.Where("recovery_key = ?", recoveryKey).First(&user).Error
-	return user, err
+// UserRepository stores users. Lookups return gorm.ErrRecordNotFound when
+// nothing matches, whatever the implementation.
+type UserRepository interface {
+	Create(user *models.User) error
+	Update(user *models.User) error
+
+	FindByID(id uuid.UUID) (*models.User, error)
+	FindByEmail(email string) (*models.User, error)
+	// FindByEmailOrUsername and FindByUsername ignore the case of usernames,
+	// which are unique ignoring case.
+	FindByEmailOrUsername(identifier string) (*models.User, error)
+	FindByUsername(username string) (*models.User, error)
+	FindByVerificationToken(token string) (*models.User, error)
+	FindByRecoveryKey(recoveryKey string) (*models.User, error)
+	FindDigestSubscribers() ([]models.User, error)
+
+	UpdateUsername(userID uuid.UUID, newUsername string, changedAt time.Time) error
+	// UpdateEmail switches the user to an address they just confirmed,
+	// which also counts as verifying it.
+	UpdateEmail(userID uuid.UUID, newEmail string) error
+	UpdateTimezone(userID uuid.UUID, timezone string) error
+	UpdateDigestSettings(userID uuid.UUID, enabled bool, hour int) error
+	UpdateLastDigestDate(userID uuid.UUID, date string) error
+	UpdatePlan(userID uuid.UUID, plan string) error
+	ClearRecoveryKeyPending(userID uuid.UUID) error
+	// SetContentKeyByServer stores the user's encrypted content key unless
+	// one is already set, and reports whether it was stored.
+	SetContentKeyByServer(userID uuid.UUID, key string) (bool, error)
+
+	// LockUsage reads the user's plan and usage counters and locks the row
+	// until the transaction ends.
+	LockUsage(userID uuid.UUID) (*models.User, error)
+	AddUsage(userID uuid.UUID, posts, bytes int64) error
 }
 
-func UpdateUsername(db *gorm.DB, userID uuid.UUID, newUsername string) error {
-	return db.Model(&models.User{}).Where("id = ?", userID).Update("username", newUsername).Error
+type userRepository struct {
+	db *gorm.DB
 }
 
-func UpdateEmail(db *gorm.DB, userID uuid.UUID, newEmail string) error {
-	return db.Model(&models.User{}).Where("id = ?", userID).Update("email", newEmail).Error
+func NewUserRepository(db *gorm.DB) UserRepository {
+	return &userRepository{db: db}
 }
 
-func CreateUser(db *gorm.DB, user *models.User) error {
-	return db.Create(user).Error
+func (r *userRepository) Create(user *models.User) error {
+	return r.db.Create(user).Error
 }
 
-func FindUserByEmailOrUsername(db *gorm.DB, identifier string) (*models.User, error) {
-	var user models.User
-	err := db.Where("email = ? OR username = ?", identifier, identifier).First(&user).Error
-	return &user, err
+func (r *userRepository) Update(user *models.User) error {
+	return r.db.Save(user).Error
 }
 
-func FindUserByVerificationToken(db *gorm.DB, token string) (*models.User, error) {
+func (r *userRepository) first(query string, args ...interface{}) (*models.User, error) {
 	var user models.User
-	err := db.Where("verification_token = ?", token).First(&user).Error
-	return &user, err
+	if err := r.db.Where(query, args...).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
 }
 
-func FindUserByEmail(db *gorm.DB, email string) (*models.User, error) {
-	var user models.User
-	err := db.Where("email = ?", email).First(&user).Error
-	return &user, err
+func (r *userRepository) FindByID(id uuid.UUID) (*models.User, error) {
+	return r.first("id = ?", id)
+}
+
+func (r *userRepository) FindByEmail(email string) (*models.User, error) {
+	return r.first("email = ?", email)
+}
+
+func (r *userRepository) FindByEmailOrUsername(identifier string) (*models.User, error) {
+	return r.first("email = ? OR LOWER(username) = LOWER(?)", identifier, identifier)
+}
+
+func (r *userRepository) FindByUsername(username string) (*models.User, error) {
+	return r.first("LOWER(username) = LOWER(?)", username)
+}
+
+func (r *userRepository) FindByVerificationToken(token string) (*models.User, error) {
+	return r.first("verification_token = ?", token)
+}
+
+func (r *userRepository) FindByRecoveryKey(recoveryKey string) (*models.User, error) {
+	return r.first("recovery_key = ?", recoveryKey)
+}
+
+func (r *userRepository) FindDigestSubscribers() ([]models.User, error) {
+	var users []models.User
+	err := r.db.Where("digest_enabled = ? AND is_verified = ?", true, true).Find(&users).Error
+	return users, err
 }
 
-func UpdateUser(db *gorm.DB, user *models.User) error {
-	return db.Save(user).Error
+func (r *userRepository) updates(userID uuid.UUID, fields map[string]interface{}) error {
+	return r.db.Model(&models.User{}).Where("id = ?", userID).Updates(fields).Error
 }
 
-func GetUserByEmail(db *gorm.DB, email string) (models.User, error) {
+func (r *userRepository) UpdateUsername(userID uuid.UUID, newUsername string, changedAt time.Time) error {
+	return r.updates(userID, map[string]interface{}{
+		"username":            newUsername,
+		"username_changed_at": changedAt,
+	})
+}
+
+func (r *userRepository) UpdateEmail(userID uuid.UUID, newEmail string) error {
+	return r.updates(userID, map[string]interface{}{
+		"email":                   newEmail,
+		"is_verified":             true,
+		"verification_token":      nil,
+		"verification_expires_at": nil,
+		"resend_count":            0,
+	})
+}
+
+func (r *userRepository) UpdateTimezone(userID uuid.UUID, timezone string) error {
+	return r.updates(userID, map[string]interface{}{"timezone": timezone})
+}
+
+func (r *userRepository) UpdateDigestSettings(userID uuid.UUID, enabled bool, hour int) error {
+	return r.updates(userID, map[string]interface{}{
+		"digest_enabled": enabled,
+		"digest_hour":    hour,
+	})
+}
+
+func (r *userRepository) UpdateLastDigestDate(userID uuid.UUID, date string) error {
+	return r.updates(userID, map[string]interface{}{"last_digest_date": date})
+}
+
+func (r *userRepository) UpdatePlan(userID uuid.UUID, plan string) error {
+	result := r.db.Model(&models.User{}).Where("id = ?", userID).Update("plan", plan)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *userRepository) ClearRecoveryKeyPending(userID uuid.UUID) error {
+	return r.updates(userID, map[string]interface{}{"recovery_key_pending": false})
+}
+
+func (r *userRepository) SetContentKeyByServer(userID uuid.UUID, key string) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND (encrypted_content_key_by_server IS NULL OR encrypted_content_key_by_server = '')", userID).
+		Update("encrypted_content_key_by_server", key)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *userRepository) LockUsage(userID uuid.UUID) (*models.User, error) {
 	var user models.User
-	err := db.Where("email = ?", email).First(&user).Error
-	return user, err
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "plan", "post_count", "stored_bytes").
+		First(&user, "id = ?", userID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *userRepository) AddUsage(userID uuid.UUID, posts, bytes int64) error {
+	return r.db.Model(&models.User{}).Where("id = ?", userID).UpdateColumns(map[string]interface{}{
+		"post_count":   gorm.Expr("post_count + ?", posts),
+		"stored_bytes": gorm.Expr("stored_bytes + ?", bytes),
+	}).Error
 }
@@ -0,0 +1,38 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/cheeszy/journaling/models"
+	"gorm.io/gorm"
+)
+
+type UsernameHistoryRepository interface {
+	Create(entry *models.UsernameHistory) error
+	// FindReserved returns the most recent history entry that still holds
+	// the given old username, matched case-insensitively.
+	FindReserved(username string, now time.Time) (*models.UsernameHistory, error)
+}
+
+type usernameHistoryRepository struct {
+	db *gorm.DB
+}
+
+func NewUsernameHistoryRepository(db *gorm.DB) UsernameHistoryRepository {
+	return &usernameHistoryRepository{db: db}
+}
+
+func (r *usernameHistoryRepository) Create(entry *models.UsernameHistory) error {
+	return r.db.Create(entry).Error
+}
+
+func (r *usernameHistoryRepository) FindReserved(username string, now time.Time) (*models.UsernameHistory, error) {
+	var entry models.UsernameHistory
+	err := r.db.Where("LOWER(old_username) = LOWER(?) AND reserved_until > ?", username, now).
+		Order("created_at DESC").
+		First(&entry).Error
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/cheeszy/journaling/app"
+	"github.com/cheeszy/journaling/models"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrInvalidPassword = errors.New("Invalid password")
+
+func (s *Service) accountDeletionGrace() time.Duration {
+	return s.Config.AccountDeletionGrace
+}
+
+// ScheduleAccountDeletion marks the account for deletion after the grace
+// period. Asking again while a deletion is pending keeps the original date.
+func (s *Service) ScheduleAccountDeletion(userID uuid.UUID, password string) (time.Time, error) {
+	user, err := s.Users.FindByID(userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return time.Time{}, ErrInvalidPassword
+	}
+	if user.DeletionScheduledAt != nil {
+		return *user.DeletionScheduledAt, nil
+	}
+
+	deleteAt := s.Clock.Now().Add(s.accountDeletionGrace())
+	err = s.Transaction(func(tx *app.App) error {
+		if err := tx.Accounts.ScheduleDeletion(user.ID, deleteAt); err != nil {
+			return err
+		}
+		return s.QueueAccountDeletionScheduledEmail(tx, user, deleteAt)
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return deleteAt, nil
+}
+
+// cancelAccountDeletion is called on login while a deletion is pending.
+func (s *Service) cancelAccountDeletion(user *models.User) error {
+	return s.Transaction(func(tx *app.App) error {
+		if err := tx.Accounts.CancelDeletion(user.ID); err != nil {
+			return err
+		}
+		user.DeletionScheduledAt = nil
+		return s.QueueAccountDeletionCancelledEmail(tx, user)
+	})
+}
+
+// DeleteDueAccounts permanently deletes accounts whose grace period is over,
+// together with their posts and comments.
+func (s *Service) DeleteDueAccounts(now time.Time) (int, error) {
+	users, err := s.Accounts.FindDueForDeletion(now)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range users {
+		user := &users[i]
+		exports, err := s.DataExports.FindByUserID(user.ID)
+		if err != nil {
+			return i, err
+		}
+		imports, err := s.ImportJobs.FindByUserID(user.ID)
+		if err != nil {
+			return i, err
+		}
+		attachments, err := s.Attachments.FindByUserID(user.ID)
+		if err != nil {
+			return i, err
+		}
+		covered, err := s.Posts.FindCoveredIDsByUserID(user.ID)
+		if err != nil {
+			return i, err
+		}
+
+		err = s.Transaction(func(tx *app.App) error {
+			if err := tx.Accounts.HardDelete(user.ID); err != nil {
+				return err
+			}
+			return s.QueueAccountDeletedEmail(tx, user)
+		})
+		if err != nil {
+			return i, err
+		}
+
+		for _, export := range exports {
+			if export.FilePath != "" {
+				os.Remove(export.FilePath)
+			}
+		}
+		for _, job := range imports {
+			os.Remove(job.FilePath)
+		}
+		s.deleteBlobs(context.Background(), attachments)
+		s.removeCoverDirs(covered)
+		s.InvalidateStats(user.ID)
+	}
+
+	return len(users), nil
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/cheeszy/journaling/app"
+	"github.com/cheeszy/journaling/audio"
+	"github.com/cheeszy/journaling/encryption"
+	"github.com/cheeszy/journaling/models"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrAttachmentTooLarge = errors.New("attachment is larger than 25 MB")
+	ErrVoiceRecording     = errors.New("the recording of a voice entry can't be removed; delete the entry instead")
+)
+
+const (
+	attachmentMaxBytes       = 25 << 20
+	attachmentFilenameLength = 200
+)
+
+// inlineContentTypes are the types that are safe to display in the browser.
+// Everything else is served as a download.
+var inlineContentTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+	"audio/mpeg": true,
+	"audio/mp4":  true,
+	"audio/ogg":  true,
+	"audio/wave": true,
+	"audio/webm": true,
+	"video/mp4":  true,
+	"video/webm": true,
+}
+
+// IsInlineContentType reports whether files of this type can be shown in the
+// browser rather than downloaded.
+func IsInlineContentType(contentType string) bool {
+	return inlineContentTypes[contentType]
+}
+
+// findWritablePost returns the user's post unless it's a sealed time capsule.
+func (s *Service) findWritablePost(postID string, userID uuid.UUID) (*models.Post, error) {
+	post, err := s.Posts.FindByIDAndUserID(postID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if post.IsSealed(s.Clock.Now()) {
+		return nil, ErrPostSealed
+	}
+	return post, nil
+}
+
+func attachmentFilename(name string) string {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	return excerpt(name, attachmentFilenameLength)
+}
+
+func attachmentContentType(head []byte, filename string) string {
+	contentType := http.DetectContentType(head)
+	if contentType == "application/octet-stream" || contentType == "application/zip" {
+		if byExt := mime.TypeByExtension(filepath.Ext(filename)); byExt != "" {
+			contentType = byExt
+		}
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && mediaType != "text/plain" {
+		contentType = mediaType
+	}
+	return contentType
+}
+
+// CreateAttachment encrypts an uploaded file with the user's content key,
+// stores it and attaches it to the post.
+func (s *Service) CreateAttachment(ctx context.Context, postID string, userID uuid.UUID, file *multipart.FileHeader) (*models.Attachment, error) {
+	if file.Size > attachmentMaxBytes {
+		return nil, ErrAttachmentTooLarge
+	}
+	post, err := s.findWritablePost(postID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	attachment := newAttachment(post.ID, userID, file)
+	if info, err := audio.Probe(src, file.Size); err == nil {
+		attachment.ContentType = info.ContentType
+		attachment.DurationMs = info.Duration.Milliseconds()
+	} else {
+		head := make([]byte, 512)
+		n, err := src.ReadAt(head, 0)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		attachment.ContentType = attachmentContentType(head[:n], attachment.Filename)
+	}
+
+	if err := s.uploadAttachment(ctx, &attachment, src); err != nil {
+		return nil, err
+	}
+
+	err = s.Transaction(func(tx *app.App) error {
+		if err := s.reserveUsage(tx, userID, 0, attachment.Size, 0); err != nil {
+			return err
+		}
+		return tx.Attachments.Create(&attachment)
+	})
+	if err != nil {
+		s.deleteBlobs(ctx, []models.Attachment{attachment})
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+func newAttachment(postID, userID uuid.UUID, file *multipart.FileHeader) models.Attachment {
+	attachment := models.Attachment{
+		ID:       uuid.New(),
+		PostID:   postID,
+		UserID:   userID,
+		Filename: attachmentFilename(file.Filename),
+		Size:     file.Size,
+	}
+	attachment.StorageKey = "attachments/" + userID.String() + "/" + attachment.ID.String()
+	return attachment
+}
+
+// uploadAttachment stores the attachment's content, read from r. It's
+// encrypted while uploading, so the file never has to fit in memory, and
+// bound to the attachment's ID so another blob can't be swapped in for it.
+func (s *Service) uploadAttachment(ctx context.Context, attachment *models.Attachment, r io.Reader) error {
+	key, err := s.userContentKey(attachment.UserID)
+	if err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		enc, err := encryption.NewEncryptWriter(pw, key, attachment.ID[:])
+		if err == nil {
+			_, err = io.Copy(enc, r)
+		}
+		if err == nil {
+			err = enc.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	err = s.BlobStore.Put(ctx, attachment.StorageKey, pr, encryption.EncryptedSize(attachment.Size))
+	pr.CloseWithError(err)
+	<-done
+	return err
+}
+
+func (s *Service) GetAttachments(postID string, userID uuid.UUID) ([]models.Attachment, error) {
+	post, err := s.findWritablePost(postID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Attachments.FindByPostID(post.ID)
+}
+
+// OpenAttachment returns an attachment and a reader that decrypts it on the
+// fly. The reader supports seeking, so ranges are served without fetching
+// the whole file.
+func (s *Service) OpenAttachment(ctx context.Context, postID, attachmentID string, userID uuid.UUID) (*models.Attachment, io.ReadSeekCloser, error) {
+	post, err := s.findWritablePost(postID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	attachment, err := s.Attachments.FindByIDAndPostID(attachmentID, post.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader, err := s.openAttachmentContent(ctx, attachment)
+	if err != nil {
+		return nil, nil, err
+	}
+	return attachment, reader, nil
+}
+
+func (s *Service) openAttachmentContent(ctx context.Context, attachment *models.Attachment) (io.ReadSeekCloser, error) {
+	key, err := s.userContentKey(attachment.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return encryption.NewDecryptReader(key, attachment.ID[:], attachment.Size, func(offset, length int64) (io.ReadCloser, error) {
+		return s.BlobStore.Open(ctx, attachment.StorageKey, offset, length)
+	})
+}
+
+func (s *Service) DeleteAttachment(ctx context.Context, postID, attachmentID string, userID uuid.UUID) error {
+	post, err := s.findWritablePost(postID, userID)
+	if err != nil {
+		return err
+	}
+	attachment, err := s.Attachments.FindByIDAndPostID(attachmentID, post.ID)
+	if err != nil {
+		return err
+	}
+	if post.AudioAttachmentID != nil && *post.AudioAttachmentID == attachment.ID {
+		return ErrVoiceRecording
+	}
+	err = s.Transaction(func(tx *app.App) error {
+		if err := tx.Attachments.DeleteByID(attachment.ID); err != nil {
+			return err
+		}
+		return s.reserveUsage(tx, userID, 0, -attachment.Size, 0)
+	})
+	if err != nil {
+		return err
+	}
+	s.deleteBlobs(ctx, []models.Attachment{*attachment})
+	return nil
+}
+
+// deleteBlobs removes the stored files of attachments whose rows are gone.
+// Failures are only logged; an orphaned blob is unreadable without its row.
+func (s *Service) deleteBlobs(ctx context.Context, attachments []models.Attachment) {
+	for _, attachment := range attachments {
+		if err := s.BlobStore.Delete(ctx, attachment.StorageKey); err != nil {
+			slog.ErrorContext(ctx, "Failed to delete attachment", "attachment_id", attachment.ID, "error", err)
+		}
+	}
+}
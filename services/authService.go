@@ -2,19 +2,29 @@ package services
 
 import (
 	"errors"
-	"os"
 	"time"
 
+	"github.com/cheeszy/journaling/app"
 	"github.com/cheeszy/journaling/dto"
-	"github.com/cheeszy/journaling/initializers"
 	"github.com/cheeszy/journaling/models"
-	"github.com/cheeszy/journaling/repositories"
 	"github.com/cheeszy/journaling/utils"
 	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
-func RegisterUser(input dto.RegisterRequest) (string, error) {
+var (
+	ErrInvalidCredentials = errors.New("Invalid email/username or password")
+	ErrRecoveryKeyPending = errors.New("Please confirm you have saved your recovery key")
+	ErrAlreadyRegistered  = errors.New("Username or email is already registered")
+)
+
+func (s *Service) RegisterUser(input dto.RegisterRequest) (string, error) {
+	if err := s.ValidateUsername(input.Username, uuid.Nil); err != nil {
+		return "", err
+	}
+
 	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 	recoveryKey, err := utils.GenerateRecoveryKey()
 	if err != nil {
@@ -26,6 +36,8 @@ func RegisterUser(input dto.RegisterRequest) (string, error) {
 		Email:       input.Email,
 		Password:    string(hashedPassword),
 		RecoveryKey: recoveryKey,
+
+		RecoveryKeyPending: true,
 	}
 
 	token, err := GenerateToken(32)
@@ -34,47 +46,72 @@ func RegisterUser(input dto.RegisterRequest) (string, error) {
 	}
 
 	user.VerificationToken = token
-	user.VerificationExpiresAt = time.Now().Add(15 * time.Minute)
+	user.VerificationExpiresAt = s.Clock.Now().Add(15 * time.Minute)
 
-	if err := repositories.CreateUser(initializers.DB, &user); err != nil {
+	err = s.Transaction(func(tx *app.App) error {
+		if err := tx.Users.Create(&user); err != nil {
+			return err
+		}
+		return s.QueueVerificationEmail(tx, &user, token)
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return "", ErrAlreadyRegistered
+	}
+	if err != nil {
 		return "", err
 	}
 
-	go SendVerificationEmail(user.Email, token, user.RecoveryKey)
-
 	return recoveryKey, nil
 }
 
-func LoginUser(input dto.LoginRequest) (string, int64, error) {
-	user, err := repositories.FindUserByEmailOrUsername(initializers.DB, input.Identifier)
-	if err != nil || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)) != nil {
-		return "", 0, errors.New("Invalid email/username or password")
+func (s *Service) LoginUser(input dto.LoginRequest) (string, int64, error) {
+	user, err := s.authenticate(input.Identifier, input.Password)
+	if err != nil {
+		return "", 0, err
 	}
 
 	if !user.IsVerified {
 		return "", 0, errors.New("Please verify your email")
 	}
 
+	if user.RecoveryKeyPending {
+		return "", 0, ErrRecoveryKeyPending
+	}
+
+	if user.DeletionScheduledAt != nil {
+		if err := s.cancelAccountDeletion(user); err != nil {
+			return "", 0, err
+		}
+	}
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"sub": user.ID.String(),
-		"exp": time.Now().Add(time.Hour * 24).Unix(),
+		"exp": s.Clock.Now().Add(time.Hour * 24).Unix(),
 	})
 
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	tokenString, err := token.SignedString([]byte(s.Config.JWTSecret.Value()))
 	if err != nil {
 		return "", 0, err
 	}
 
-	return tokenString, time.Now().Add(time.Hour * 24).Unix(), nil
+	return tokenString, s.Clock.Now().Add(time.Hour * 24).Unix(), nil
 }
 
-func VerifyUserEmail(token string) error {
-	user, err := repositories.FindUserByVerificationToken(initializers.DB, token)
+func (s *Service) authenticate(identifier, password string) (*models.User, error) {
+	user, err := s.Users.FindByEmailOrUsername(identifier)
+	if err != nil || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+func (s *Service) VerifyUserEmail(token string) error {
+	user, err := s.Users.FindByVerificationToken(token)
 	if err != nil {
 		return errors.New("Invalid token")
 	}
 
-	if time.Now().After(user.VerificationExpiresAt) {
+	if s.Clock.Now().After(user.VerificationExpiresAt) {
 		return errors.New("Token expired")
 	}
 
@@ -83,11 +120,11 @@ func VerifyUserEmail(token string) error {
 	user.VerificationExpiresAt = time.Time{}
 	user.ResendCount = 0
 
-	return repositories.UpdateUser(initializers.DB, user)
+	return s.Users.Update(user)
 }
 
-func ResendVerificationEmail(email string) (map[string]interface{}, error) {
-	user, err := repositories.FindUserByEmail(initializers.DB, email)
+func (s *Service) ResendVerificationEmail(email string) (map[string]interface{}, error) {
+	user, err := s.Users.FindByEmail(email)
 	if err != nil {
 		return nil, errors.New("User not found")
 	}
@@ -99,7 +136,7 @@ func ResendVerificationEmail(email string) (map[string]interface{}, error) {
 	const maxResend = 3
 	const cooldown = 24 * time.Hour
 
-	if time.Since(user.VerificationExpiresAt) > cooldown {
+	if s.Clock.Now().Sub(user.VerificationExpiresAt) > cooldown {
 		user.ResendCount = 0
 	}
 
@@ -108,24 +145,40 @@ func ResendVerificationEmail(email string) (map[string]interface{}, error) {
 	}
 
 	token, _ := GenerateToken(32)
-	expiry := time.Now().Add(15 * time.Minute)
+	expiry := s.Clock.Now().Add(15 * time.Minute)
 
 	user.VerificationToken = token
 	user.VerificationExpiresAt = expiry
 	user.ResendCount++
-	user.LastVerificationSentAt = time.Now()
+	user.LastVerificationSentAt = s.Clock.Now()
+
+	// Report how the previous verification email fared, so the client can
+	// tell "never delivered" apart from "delivered but not clicked".
+	var lastDelivery map[string]interface{}
+	if last, err := s.Outbox.FindLatest(user.ID, EmailVerification); err == nil {
+		lastDelivery = map[string]interface{}{
+			"status":   last.Status,
+			"attempts": last.Attempts,
+			"sent_at":  last.SentAt,
+		}
+	}
 
-	if err := repositories.UpdateUser(initializers.DB, user); err != nil {
+	err = s.Transaction(func(tx *app.App) error {
+		if err := tx.Users.Update(user); err != nil {
+			return err
+		}
+		return s.QueueVerificationEmail(tx, user, token)
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	go SendVerificationEmail(user.Email, token, user.RecoveryKey)
-
 	return map[string]interface{}{
 		"message":         "Verification email resent successfully",
 		"expires_at":      expiry,
 		"resend_count":    user.ResendCount,
 		"resend_limit":    maxResend,
 		"remaining_quota": maxResend - user.ResendCount,
+		"last_delivery":   lastDelivery,
 	}, nil
 }
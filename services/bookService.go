@@ -0,0 +1,107 @@
+package services
+
+import (
+	"errors"
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/cheeszy/journaling/book"
+	"github.com/cheeszy/journaling/models"
+	"github.com/cheeszy/journaling/utils"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidBookRange = errors.New("from and to must be dates formatted as YYYY-MM-DD, with from not after to and at most 10 years apart")
+	ErrBookEmpty        = errors.New("no published entries in this date range")
+)
+
+const (
+	bookMaxYears        = 10
+	bookChapterLayout   = "January 2006"
+	bookEntryDateLayout = "Monday, January 2, 2006 at 3:04 PM"
+)
+
+// BuildBook collects the user's published entries between from and to,
+// inclusive, into a book with one chapter per month. Dates are in the user's
+// time zone; an empty from means the start of the current year and an empty
+// to means today. Sealed time capsules are left out.
+func (s *Service) BuildBook(user models.User, fromStr, toStr string) (*book.Book, error) {
+	loc := user.Location()
+	now := s.Clock.Now().In(loc)
+
+	from := time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, loc)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	var err error
+	if fromStr != "" {
+		if from, err = time.ParseInLocation(dateLayout, fromStr, loc); err != nil {
+			return nil, ErrInvalidBookRange
+		}
+	}
+	if toStr != "" {
+		if to, err = time.ParseInLocation(dateLayout, toStr, loc); err != nil {
+			return nil, ErrInvalidBookRange
+		}
+	}
+	if from.After(to) || to.After(from.AddDate(bookMaxYears, 0, 0)) {
+		return nil, ErrInvalidBookRange
+	}
+
+	posts, err := s.Posts.FindPublishedInRange(user.ID, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.decryptPostBodies(posts); err != nil {
+		return nil, err
+	}
+
+	b := &book.Book{
+		Identifier: "urn:uuid:" + uuid.NewSHA1(user.ID, []byte(from.Format(dateLayout)+"/"+to.Format(dateLayout))).String(),
+		Title:      user.Username + "'s Journal",
+		Subtitle:   bookSubtitle(from, to),
+		Author:     user.Username,
+		Language:   "en",
+		Modified:   s.Clock.Now(),
+	}
+
+	for i := range posts {
+		post := &posts[i]
+		if post.IsSealed(now) {
+			continue
+		}
+
+		created := post.CreatedAt.In(loc)
+		id := created.Format("2006-01")
+		if len(b.Chapters) == 0 || b.Chapters[len(b.Chapters)-1].ID != id {
+			b.Chapters = append(b.Chapters, book.Chapter{ID: id, Title: created.Format(bookChapterLayout)})
+		}
+		title := strings.TrimSpace(book.XMLSafe(post.Title))
+		if title == "" {
+			title = created.Format(dateLayout)
+		}
+		// A voice entry is printed as its transcript, after any notes.
+		text := post.Body
+		if post.Transcript != "" {
+			text = strings.TrimSpace(text + "\n\n" + post.Transcript)
+		}
+		chapter := &b.Chapters[len(b.Chapters)-1]
+		chapter.Entries = append(chapter.Entries, book.Entry{
+			Title: title,
+			Date:  created.Format(bookEntryDateLayout),
+			Body:  template.HTML(utils.RenderMarkdown(book.XMLSafe(text))),
+		})
+	}
+
+	if len(b.Chapters) == 0 {
+		return nil, ErrBookEmpty
+	}
+	return b, nil
+}
+
+func bookSubtitle(from, to time.Time) string {
+	if from.Year() == to.Year() && from.Month() == to.Month() {
+		return from.Format(bookChapterLayout)
+	}
+	return from.Format(bookChapterLayout) + " – " + to.Format(bookChapterLayout)
+}
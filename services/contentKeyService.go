@@ -0,0 +1,107 @@
+package services
+
+import (
+	"encoding/base64"
+
+	"github.com/cheeszy/journaling/encryption"
+	"github.com/cheeszy/journaling/models"
+	"github.com/google/uuid"
+)
+
+// userContentKey returns the key the user's files are encrypted with,
+// creating it the first time it's needed. The key is stored encrypted with
+// the server's master key and bound to the user's ID.
+func (s *Service) userContentKey(userID uuid.UUID) ([]byte, error) {
+	user, err := s.Users.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.EncryptedContentKeyByServer == "" {
+		key, err := encryption.NewKey()
+		if err != nil {
+			return nil, err
+		}
+		sealed, err := encryption.Seal(s.ContentMasterKey, key, userID[:])
+		if err != nil {
+			return nil, err
+		}
+		stored, err := s.Users.SetContentKeyByServer(userID, base64.StdEncoding.EncodeToString(sealed))
+		if err != nil {
+			return nil, err
+		}
+		if stored {
+			return key, nil
+		}
+
+		// Another request created the key first; use that one.
+		if user, err = s.Users.FindByID(userID); err != nil {
+			return nil, err
+		}
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(user.EncryptedContentKeyByServer)
+	if err != nil {
+		return nil, err
+	}
+	return encryption.Open(s.ContentMasterKey, sealed, userID[:])
+}
+
+// encryptPostBody replaces the post's body with its encryption under the
+// owner's content key. The post's ID is bound to the ciphertext, so it must
+// be set first.
+func (s *Service) encryptPostBody(post *models.Post) error {
+	key, err := s.userContentKey(post.UserID)
+	if err != nil {
+		return err
+	}
+	sealed, err := encryption.Seal(key, []byte(post.Body), post.ID[:])
+	if err != nil {
+		return err
+	}
+	post.Body = base64.StdEncoding.EncodeToString(sealed)
+	post.BodyEncrypted = true
+	return nil
+}
+
+// decryptPostBodies replaces encrypted bodies with their plaintext, looking
+// each owner's key up once. Call it before a post's body leaves the
+// service, and don't save the posts afterwards.
+func (s *Service) decryptPostBodies(posts []models.Post) error {
+	keys := make(map[uuid.UUID][]byte)
+	for i := range posts {
+		post := &posts[i]
+		if !post.BodyEncrypted {
+			continue
+		}
+		key, ok := keys[post.UserID]
+		if !ok {
+			var err error
+			if key, err = s.userContentKey(post.UserID); err != nil {
+				return err
+			}
+			keys[post.UserID] = key
+		}
+
+		sealed, err := base64.StdEncoding.DecodeString(post.Body)
+		if err != nil {
+			return err
+		}
+		body, err := encryption.Open(key, sealed, post.ID[:])
+		if err != nil {
+			return err
+		}
+		post.Body = string(body)
+		post.BodyEncrypted = false
+	}
+	return nil
+}
+
+func (s *Service) decryptPostBody(post *models.Post) error {
+	posts := []models.Post{*post}
+	if err := s.decryptPostBodies(posts); err != nil {
+		return err
+	}
+	post.Body, post.BodyEncrypted = posts[0].Body, posts[0].BodyEncrypted
+	return nil
+}
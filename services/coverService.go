@@ -0,0 +1,303 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+
+	"github.com/cheeszy/journaling/app"
+	"github.com/cheeszy/journaling/dto"
+	"github.com/cheeszy/journaling/models"
+	"github.com/cheeszy/journaling/utils"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrCoverTooLarge = errors.New("cover photo must be at most 15 MB and 50 megapixels")
+	ErrCoverFormat   = errors.New("cover photo must be a JPEG or PNG image")
+	ErrNoCover       = errors.New("post has no cover photo")
+)
+
+const (
+	coverMaxBytes    = 15 << 20
+	coverMaxPixels   = 50_000_000
+	coverJPEGQuality = 85
+)
+
+// coverSizes are the thumbnails generated for every cover photo, by the
+// longest edge in pixels.
+var coverSizes = []struct {
+	name    string
+	maxEdge int
+}{
+	{"small", 160},
+	{"medium", 640},
+	{"large", 1280},
+}
+
+func (s *Service) coverDir() string {
+	return s.Config.CoverDir
+}
+
+// coverKeepMetadata reports whether cover photos are stored as uploaded.
+// By default they're re-encoded, which drops EXIF data such as the GPS
+// position.
+func (s *Service) coverKeepMetadata() bool {
+	return s.Config.CoverKeepMetadata
+}
+
+func (s *Service) coverPath(post *models.Post, size string) string {
+	name := post.CoverKey
+	if size != "" {
+		name += "-" + size
+	}
+	ext := ".jpg"
+	if post.CoverContentType == "image/png" {
+		ext = ".png"
+	}
+	return filepath.Join(s.coverDir(), post.ID.String(), name+ext)
+}
+
+func toCoverResponse(post *models.Post) *dto.CoverResponse {
+	if post.CoverKey == "" {
+		return nil
+	}
+
+	url := "/api/posts/" + post.ID.String() + "/cover"
+	res := &dto.CoverResponse{
+		ImageResponse: dto.ImageResponse{URL: url, Width: post.CoverWidth, Height: post.CoverHeight},
+		Thumbnails:    make(map[string]dto.ImageResponse, len(coverSizes)),
+	}
+	for _, size := range coverSizes {
+		w, h := utils.FitWithin(post.CoverWidth, post.CoverHeight, size.maxEdge)
+		res.Thumbnails[size.name] = dto.ImageResponse{URL: url + "/" + size.name, Width: w, Height: h}
+	}
+	return res
+}
+
+// SetPostCover replaces the post's cover photo and generates its thumbnails.
+// The files count toward the owner's storage in place of the previous
+// cover's.
+func (s *Service) SetPostCover(postID string, userID uuid.UUID, file *multipart.FileHeader) (*dto.CoverResponse, error) {
+	if file.Size > coverMaxBytes {
+		return nil, ErrCoverTooLarge
+	}
+	post, err := s.findWritablePost(postID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(src, coverMaxBytes))
+	src.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the dimensions before decoding so a tiny file can't claim a
+	// huge image.
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (format != "jpeg" && format != "png") {
+		return nil, ErrCoverFormat
+	}
+	if config.Width*config.Height > coverMaxPixels {
+		return nil, ErrCoverTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrCoverFormat
+	}
+	if format == "jpeg" {
+		img = utils.ApplyOrientation(img, utils.JPEGOrientation(data))
+	}
+
+	key, err := GenerateToken(8)
+	if err != nil {
+		return nil, err
+	}
+	now := s.Clock.Now()
+	post.CoverKey = key
+	post.CoverContentType = "image/" + format
+	post.CoverWidth = img.Bounds().Dx()
+	post.CoverHeight = img.Bounds().Dy()
+	post.CoverUpdatedAt = &now
+
+	if err := s.writeCoverFiles(post, img, data); err != nil {
+		s.removeCoverFiles(post)
+		return nil, err
+	}
+	if post.CoverBytes, err = s.coverFilesSize(post); err != nil {
+		s.removeCoverFiles(post)
+		return nil, err
+	}
+
+	var previous *models.Post
+	err = s.Transaction(func(tx *app.App) error {
+		var err error
+		if previous, err = lockStoredPost(tx, post); err != nil {
+			return err
+		}
+		if err := s.reserveUsage(tx, userID, 0, post.CoverBytes-previous.CoverBytes, 0); err != nil {
+			return err
+		}
+		return tx.Posts.UpdateCover(post)
+	})
+	if err != nil {
+		s.removeCoverFiles(post)
+		return nil, err
+	}
+	s.removeCoverFiles(previous)
+
+	return toCoverResponse(post), nil
+}
+
+func (s *Service) writeCoverFiles(post *models.Post, img image.Image, original []byte) error {
+	if err := os.MkdirAll(filepath.Dir(s.coverPath(post, "")), 0o700); err != nil {
+		return err
+	}
+
+	if s.coverKeepMetadata() {
+		if err := os.WriteFile(s.coverPath(post, ""), original, 0o600); err != nil {
+			return err
+		}
+	} else if err := writeCoverImage(s.coverPath(post, ""), post.CoverContentType, img); err != nil {
+		return err
+	}
+
+	for _, size := range coverSizes {
+		thumbnail := utils.Thumbnail(img, size.maxEdge)
+		if err := writeCoverImage(s.coverPath(post, size.name), post.CoverContentType, thumbnail); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeCoverImage(path, contentType string, img image.Image) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if contentType == "image/png" {
+		err = png.Encode(f, img)
+	} else {
+		err = jpeg.Encode(f, img, &jpeg.Options{Quality: coverJPEGQuality})
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// coverFilesSize adds up the sizes of the files of the post's cover.
+func (s *Service) coverFilesSize(post *models.Post) (int64, error) {
+	names := []string{""}
+	for _, size := range coverSizes {
+		names = append(names, size.name)
+	}
+
+	var total int64
+	for _, name := range names {
+		info, err := os.Stat(s.coverPath(post, name))
+		if err != nil {
+			return 0, err
+		}
+		total += info.Size()
+	}
+	return total, nil
+}
+
+// removeCoverFiles deletes the files of the post's current cover, if any.
+func (s *Service) removeCoverFiles(post *models.Post) {
+	if post.CoverKey == "" {
+		return
+	}
+	os.Remove(s.coverPath(post, ""))
+	for _, size := range coverSizes {
+		os.Remove(s.coverPath(post, size.name))
+	}
+}
+
+// removeCoverDirs deletes everything stored for the posts' covers.
+func (s *Service) removeCoverDirs(postIDs []uuid.UUID) {
+	for _, id := range postIDs {
+		os.RemoveAll(filepath.Join(s.coverDir(), id.String()))
+	}
+}
+
+func (s *Service) DeletePostCover(postID string, userID uuid.UUID) error {
+	post, err := s.findWritablePost(postID, userID)
+	if err != nil {
+		return err
+	}
+	if post.CoverKey == "" {
+		return ErrNoCover
+	}
+
+	post.CoverKey = ""
+	post.CoverContentType = ""
+	post.CoverWidth = 0
+	post.CoverHeight = 0
+	post.CoverBytes = 0
+	post.CoverUpdatedAt = nil
+
+	var previous *models.Post
+	err = s.Transaction(func(tx *app.App) error {
+		var err error
+		if previous, err = lockStoredPost(tx, post); err != nil {
+			return err
+		}
+		if err := tx.Posts.UpdateCover(post); err != nil {
+			return err
+		}
+		return s.reserveUsage(tx, userID, 0, -previous.CoverBytes, 0)
+	})
+	if err != nil {
+		return err
+	}
+	s.removeCoverFiles(previous)
+	return nil
+}
+
+// OpenPostCover returns the cover photo, or one of its thumbnails, of a post
+// the user may read: their own posts and everyone's published ones.
+func (s *Service) OpenPostCover(postID string, user models.User, size string) (*os.File, *models.Post, error) {
+	post, err := s.Posts.FindByID(postID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if post.UserID != user.ID && post.Status != models.PostStatusPublished {
+		return nil, nil, ErrNoCover
+	}
+	if post.IsSealed(s.Clock.Now()) {
+		return nil, nil, ErrPostSealed
+	}
+	if post.CoverKey == "" {
+		return nil, nil, ErrNoCover
+	}
+
+	if size != "" {
+		known := false
+		for _, s := range coverSizes {
+			known = known || s.name == size
+		}
+		if !known {
+			return nil, nil, ErrNoCover
+		}
+	}
+
+	file, err := os.Open(s.coverPath(post, size))
+	if err != nil {
+		return nil, nil, ErrNoCover
+	}
+	return file, post, nil
+}
@@ -4,9 +4,27 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
-	"log"
-	"net/smtp"
-	"os"
+	"time"
+
+	"github.com/cheeszy/journaling/app"
+	"github.com/cheeszy/journaling/mailer"
+	"github.com/cheeszy/journaling/models"
+	"github.com/google/uuid"
+)
+
+const (
+	EmailVerification = "verification"
+	EmailTimeCapsule  = "time_capsule"
+	EmailDigest       = "digest"
+
+	EmailChangeConfirm = "email_change_confirm"
+	EmailChangeNotice  = "email_change_notice"
+
+	EmailAccountDeletionScheduled = "account_deletion_scheduled"
+	EmailAccountDeletionCancelled = "account_deletion_cancelled"
+	EmailAccountDeleted           = "account_deleted"
+
+	EmailDataExportReady = "data_export_ready"
 )
 
 func GenerateToken(n int) (string, error) {
@@ -19,37 +37,101 @@ func GenerateToken(n int) (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
-func SendVerificationEmail(toEmail, token, recoveryKey string) error {
-	link := fmt.Sprintf(os.Getenv("FE_DOMAIN")+"/verify?token=%s", token)
-	subject := "Email Verification"
+// queueEmail renders the named email template and stores it in the outbox.
+// Pass the transaction that makes the related change so both commit or roll
+// back together; the outbox worker delivers it afterwards.
+func (s *Service) queueEmail(tx *app.App, userID *uuid.UUID, name, toEmail string, data interface{}) error {
+	msg, err := mailer.Render(name, toEmail, data)
+	if err != nil {
+		return err
+	}
 
-	body := fmt.Sprintf(
-		"Please verify your email by clicking the following link:\n\n%s\n\n"+
-			"Also, please keep this recovery key safe:\n\n%s\n\n"+
-			"Don't share this key with anyone!",
-		link, recoveryKey,
-	)
+	return tx.Outbox.Create(&models.EmailOutbox{
+		UserID:        userID,
+		Template:      name,
+		To:            toEmail,
+		Subject:       msg.Subject,
+		TextBody:      msg.Text,
+		HTMLBody:      msg.HTML,
+		Status:        models.OutboxStatusPending,
+		NextAttemptAt: s.Clock.Now(),
+	})
+}
 
-	from := os.Getenv("EMAIL_FROM")
-	password := os.Getenv("EMAIL_PASSWORD")
-	smtpHost := os.Getenv("SMTP_HOST")
-	smtpPort := os.Getenv("SMTP_PORT")
+func (s *Service) QueueVerificationEmail(tx *app.App, user *models.User, token string) error {
+	return s.queueEmail(tx, &user.ID, EmailVerification, user.Email, map[string]string{
+		"Link": fmt.Sprintf(s.Config.FEDomain+"/verify?token=%s", token),
+	})
+}
 
-	msg := []byte("To: " + toEmail + "\r\n" +
-		"Subject: " + subject + "\r\n" +
-		"MIME-Version: 1.0\r\n" +
-		"Content-Type: text/plain; charset=\"utf-8\"\r\n" +
-		"\r\n" +
-		body + "\r\n")
+func (s *Service) QueueTimeCapsuleEmail(tx *app.App, post *models.Post) error {
+	return s.queueEmail(tx, &post.UserID, EmailTimeCapsule, post.User.Email, map[string]string{
+		"Title":       post.Title,
+		"SealedUntil": post.SealedUntil.Format("January 2, 2006"),
+		"Link":        s.Config.FEDomain,
+	})
+}
 
-	auth := smtp.PlainAuth("", from, password, smtpHost)
+type digestMemory struct {
+	YearsAgo int
+	Title    string
+	Excerpt  string
+}
 
-	addr := smtpHost + ":" + smtpPort
-	err := smtp.SendMail(addr, auth, from, []string{toEmail}, msg)
+func (s *Service) QueueDigestEmail(tx *app.App, user *models.User, date time.Time, posts []models.Post) error {
+	memories := make([]digestMemory, 0, len(posts))
+	for _, post := range posts {
+		memories = append(memories, digestMemory{
+			YearsAgo: date.Year() - post.CreatedAt.In(date.Location()).Year(),
+			Title:    post.Title,
+			Excerpt:  excerpt(post.Body, digestExcerptLength),
+		})
+	}
+
+	return s.queueEmail(tx, &user.ID, EmailDigest, user.Email, map[string]interface{}{
+		"Date":     date.Format("January 2"),
+		"Memories": memories,
+		"Link":     s.Config.FEDomain,
+	})
+}
+
+func (s *Service) QueueEmailChangeEmails(tx *app.App, change *models.EmailChange) error {
+	err := s.queueEmail(tx, &change.UserID, EmailChangeConfirm, change.NewEmail, map[string]string{
+		"Link":      s.Config.FEDomain + "/account/email-change/confirm?token=" + change.ConfirmToken,
+		"ExpiresAt": change.ExpiresAt.UTC().Format("January 2, 2006 15:04 MST"),
+	})
 	if err != nil {
-		log.Printf("SMTP error: %v\n", err)
-	} else {
-		log.Printf("Verification email sent to %s\n", toEmail)
+		return err
 	}
-	return err
+
+	return s.queueEmail(tx, &change.UserID, EmailChangeNotice, change.OldEmail, map[string]string{
+		"NewEmail":   change.NewEmail,
+		"CancelLink": s.Config.FEDomain + "/account/email-change/cancel?token=" + change.CancelToken,
+	})
+}
+
+func (s *Service) QueueAccountDeletionScheduledEmail(tx *app.App, user *models.User, deleteAt time.Time) error {
+	return s.queueEmail(tx, &user.ID, EmailAccountDeletionScheduled, user.Email, map[string]string{
+		"DeleteAt": deleteAt.In(user.Location()).Format("January 2, 2006 15:04 MST"),
+		"Link":     s.Config.FEDomain + "/login",
+	})
+}
+
+func (s *Service) QueueAccountDeletionCancelledEmail(tx *app.App, user *models.User) error {
+	return s.queueEmail(tx, &user.ID, EmailAccountDeletionCancelled, user.Email, nil)
+}
+
+// QueueAccountDeletedEmail isn't tied to the user, since the user row is gone
+// by the time it's delivered.
+func (s *Service) QueueAccountDeletedEmail(tx *app.App, user *models.User) error {
+	return s.queueEmail(tx, nil, EmailAccountDeleted, user.Email, map[string]string{
+		"Username": user.Username,
+	})
+}
+
+func (s *Service) QueueDataExportReadyEmail(tx *app.App, user *models.User, export *models.DataExport) error {
+	return s.queueEmail(tx, &user.ID, EmailDataExportReady, user.Email, map[string]string{
+		"Link":      s.Config.Domain + "/api/account/export/download?token=" + *export.DownloadToken,
+		"ExpiresAt": export.ExpiresAt.In(user.Location()).Format("January 2, 2006 15:04 MST"),
+	})
 }
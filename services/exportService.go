@@ -0,0 +1,448 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cheeszy/journaling/app"
+	"github.com/cheeszy/journaling/dto"
+	"github.com/cheeszy/journaling/models"
+	"github.com/cheeszy/journaling/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrExportUnavailable = errors.New("export link is invalid or has expired")
+
+const (
+	exportStaleAfter = 30 * time.Minute
+	exportBatchSize  = 5
+)
+
+func (s *Service) exportDir() string {
+	return s.Config.ExportDir
+}
+
+func (s *Service) exportLinkTTL() time.Duration {
+	return s.Config.ExportLinkTTL
+}
+
+// RequestDataExport queues an export of the user's data. If one is already
+// queued or running, that one is returned instead.
+func (s *Service) RequestDataExport(userID uuid.UUID) (*models.DataExport, error) {
+	if active, err := s.DataExports.FindActive(userID); err == nil {
+		return active, nil
+	}
+
+	export := models.DataExport{UserID: userID, Status: models.ExportStatusPending}
+	if err := s.DataExports.Create(&export); err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (s *Service) GetDataExport(id string, userID uuid.UUID) (*models.DataExport, error) {
+	return s.DataExports.FindByIDAndUserID(id, userID)
+}
+
+// OpenDataExport returns a ready export and its archive for a download token.
+func (s *Service) OpenDataExport(token string) (*models.DataExport, *os.File, error) {
+	export, err := s.DataExports.FindByToken(token)
+	if err != nil || export.Status != models.ExportStatusReady ||
+		export.ExpiresAt == nil || s.Clock.Now().After(*export.ExpiresAt) {
+		return nil, nil, ErrExportUnavailable
+	}
+
+	file, err := os.Open(export.FilePath)
+	if err != nil {
+		return nil, nil, ErrExportUnavailable
+	}
+	return export, file, nil
+}
+
+// ProcessDataExports builds queued exports and emails a download link for
+// each one.
+func (s *Service) ProcessDataExports(now time.Time) (int, error) {
+	done := 0
+	for done < exportBatchSize {
+		export, err := s.DataExports.Claim(now, exportStaleAfter)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			break
+		}
+		if err != nil {
+			return done, err
+		}
+
+		if err := s.processDataExport(export); err != nil {
+			slog.Error("Data export failed", "export_id", export.ID, "error", err)
+			export.Status = models.ExportStatusFailed
+			export.Error = err.Error()
+			if err := s.DataExports.Update(export); err != nil {
+				return done, err
+			}
+		}
+		done++
+	}
+	return done, nil
+}
+
+func (s *Service) processDataExport(export *models.DataExport) error {
+	user, err := s.Users.FindByID(export.UserID)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.exportDir(), 0o700); err != nil {
+		return err
+	}
+	path := filepath.Join(s.exportDir(), export.ID.String()+".zip")
+	size, err := s.writeExportArchive(user, path)
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	token, err := GenerateToken(32)
+	if err != nil {
+		return err
+	}
+	now := s.Clock.Now()
+	expiresAt := now.Add(s.exportLinkTTL())
+
+	export.Status = models.ExportStatusReady
+	export.FilePath = path
+	export.Size = size
+	export.DownloadToken = &token
+	export.ExpiresAt = &expiresAt
+	export.CompletedAt = &now
+	export.Error = ""
+
+	return s.Transaction(func(tx *app.App) error {
+		if err := tx.DataExports.Update(export); err != nil {
+			return err
+		}
+		return s.QueueDataExportReadyEmail(tx, user, export)
+	})
+}
+
+type exportProfile struct {
+	ID            uuid.UUID `json:"id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	Timezone      string    `json:"timezone"`
+	IsVerified    bool      `json:"isVerified"`
+	DigestEnabled bool      `json:"digestEnabled"`
+	DigestHour    int       `json:"digestHour"`
+	CreatedAt     time.Time `json:"createdAt"`
+	ExportedAt    time.Time `json:"exportedAt"`
+}
+
+type exportComment struct {
+	ID        uuid.UUID `json:"id"`
+	PostID    uuid.UUID `json:"postId"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+const exportReadme = `This archive contains everything stored in your journaling account.
+
+profile.json   your account details
+posts.json     every entry, including drafts and scheduled entries
+comments.json  every comment you wrote
+metrics.json   the metrics you defined
+entries/       one Markdown file per entry, with the title and date in
+               YAML front matter
+attachments/   the files attached to each entry, in a folder per entry,
+               including the recordings of voice entries
+covers/        each entry's cover photo, named after the entry's ID
+sealed/        time capsule entries that haven't reached their unlock
+               date, in full; see sealed/README.txt
+
+Elsewhere in the archive, time capsule entries that haven't reached their
+unlock date are listed without their title, body, attachments and cover
+photo, as everywhere else in the app.
+`
+
+const exportSealedReadme = `These are your time capsule entries that haven't reached their unlock
+date yet. The app keeps them hidden until then, even from you, but this
+export holds all of your data, so they are included here in full.
+
+Opening these files spoils the surprise.
+
+posts.json     the sealed entries
+entries/       one Markdown file per sealed entry
+attachments/   their attachments, in a folder per entry
+covers/        their cover photos, named after the entry's ID
+`
+
+// writeExportArchive writes the user's data as a zip file and returns its size.
+func (s *Service) writeExportArchive(user *models.User, path string) (int64, error) {
+	posts, err := s.Posts.FindAllByUserID(user.ID)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.decryptPostBodies(posts); err != nil {
+		return 0, err
+	}
+	comments, err := s.Comments.FindByUserID(user.ID)
+	if err != nil {
+		return 0, err
+	}
+	metrics, err := s.Metrics.FindByUserID(user.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	zw := zip.NewWriter(file)
+
+	profile := exportProfile{
+		ID:            user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		Timezone:      user.Location().String(),
+		IsVerified:    user.IsVerified,
+		DigestEnabled: user.DigestEnabled,
+		DigestHour:    user.DigestHour,
+		CreatedAt:     user.CreatedAt,
+		ExportedAt:    s.Clock.Now(),
+	}
+
+	exportComments := make([]exportComment, 0, len(comments))
+	for _, comment := range comments {
+		exportComments = append(exportComments, exportComment{
+			ID:        comment.ID,
+			PostID:    comment.PostID,
+			Content:   comment.Content,
+			CreatedAt: comment.CreatedAt,
+			UpdatedAt: comment.UpdatedAt,
+		})
+	}
+
+	responses := s.toPostResponses(posts)
+	var open, sealed []dto.PostResponse
+	for i := range posts {
+		if responses[i].Sealed {
+			sealed = append(sealed, s.toRevealedPostResponse(&posts[i]))
+		} else {
+			open = append(open, responses[i])
+		}
+	}
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", profile},
+		{"posts.json", responses},
+		{"comments.json", exportComments},
+		{"metrics.json", metrics},
+	}
+	for _, f := range files {
+		if err := writeZipJSON(zw, f.name, f.data); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := writeZipFile(zw, "README.txt", exportReadme); err != nil {
+		return 0, err
+	}
+	if len(sealed) > 0 {
+		if err := writeZipFile(zw, "sealed/README.txt", exportSealedReadme); err != nil {
+			return 0, err
+		}
+		if err := writeZipJSON(zw, "sealed/posts.json", sealed); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := writeExportEntries(zw, "entries/", open, user.Location()); err != nil {
+		return 0, err
+	}
+	if err := writeExportEntries(zw, "sealed/entries/", sealed, user.Location()); err != nil {
+		return 0, err
+	}
+
+	if err := s.writeExportAttachments(zw, user.ID, responses); err != nil {
+		return 0, err
+	}
+	if err := s.writeExportCovers(zw, posts); err != nil {
+		return 0, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// writeExportEntries adds a Markdown file per post to dir.
+func writeExportEntries(zw *zip.Writer, dir string, posts []dto.PostResponse, loc *time.Location) error {
+	used := make(map[string]int)
+	for _, post := range posts {
+		name := post.CreatedAt.In(loc).Format(dateLayout) + "-" + utils.Slugify(post.Title)
+		used[name]++
+		if used[name] > 1 {
+			name += "-" + strconv.Itoa(used[name])
+		}
+		if err := writeZipFile(zw, dir+name+".md", postMarkdown(post, loc)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportDir is where a post's files go in the archive: sealed time
+// capsules have a folder of their own.
+func exportDir(sealed bool) string {
+	if sealed {
+		return "sealed/"
+	}
+	return ""
+}
+
+// writeExportAttachments adds the decrypted attachments of every post.
+func (s *Service) writeExportAttachments(zw *zip.Writer, userID uuid.UUID, posts []dto.PostResponse) error {
+	attachments, err := s.Attachments.FindByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	sealed := make(map[uuid.UUID]bool, len(posts))
+	for _, post := range posts {
+		sealed[post.ID] = post.Sealed
+	}
+
+	for i := range attachments {
+		attachment := &attachments[i]
+		w, err := zw.Create(exportDir(sealed[attachment.PostID]) + "attachments/" + attachment.PostID.String() + "/" +
+			attachment.ID.String()[:8] + "-" + attachment.Filename)
+		if err != nil {
+			return err
+		}
+		content, err := s.openAttachmentContent(context.Background(), attachment)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, content)
+		content.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) writeExportCovers(zw *zip.Writer, posts []models.Post) error {
+	now := s.Clock.Now()
+	for i := range posts {
+		post := &posts[i]
+		if post.CoverKey == "" {
+			continue
+		}
+		path := s.coverPath(post, "")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		w, err := zw.Create(exportDir(post.IsSealed(now)) + "covers/" + post.ID.String() + filepath.Ext(path))
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeZipJSON(zw *zip.Writer, name string, data interface{}) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
+
+func writeZipFile(zw *zip.Writer, name, content string) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, content)
+	return err
+}
+
+// postMarkdown renders an entry as Markdown with YAML front matter, the same
+// layout the Markdown importer reads.
+func postMarkdown(post dto.PostResponse, loc *time.Location) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "title: %s\n", strconv.Quote(post.Title))
+	fmt.Fprintf(&b, "date: %s\n", post.CreatedAt.In(loc).Format(time.RFC3339))
+	fmt.Fprintf(&b, "status: %s\n", post.Status)
+	if post.Kind == models.PostKindVoice {
+		fmt.Fprintf(&b, "kind: %s\n", post.Kind)
+	}
+	if post.Transcript != "" {
+		fmt.Fprintf(&b, "transcript: %s\n", strconv.Quote(post.Transcript))
+	}
+	if post.SealedUntil != nil {
+		fmt.Fprintf(&b, "sealedUntil: %s\n", post.SealedUntil.In(loc).Format(time.RFC3339))
+	}
+	if len(post.Metrics) > 0 {
+		b.WriteString("metrics:\n")
+		for _, metric := range post.Metrics {
+			fmt.Fprintf(&b, "  %s: %s\n", strconv.Quote(metric.Name), strconv.FormatFloat(metric.Value, 'f', -1, 64))
+		}
+	}
+	b.WriteString("---\n\n")
+	b.WriteString(post.Body)
+	b.WriteString("\n")
+	return b.String()
+}
+
+// ExpireDataExports removes archives whose download link has expired.
+func (s *Service) ExpireDataExports(now time.Time) (int, error) {
+	exports, err := s.DataExports.FindExpired(now)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range exports {
+		export := &exports[i]
+		if err := os.Remove(export.FilePath); err != nil && !os.IsNotExist(err) {
+			slog.Error("Failed to remove expired export", "export_id", export.ID, "error", err)
+		}
+		export.Status = models.ExportStatusExpired
+		export.FilePath = ""
+		export.DownloadToken = nil
+		if err := s.DataExports.Update(export); err != nil {
+			return i, err
+		}
+	}
+	return len(exports), nil
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/cheeszy/journaling/mailer"
+	"github.com/cheeszy/journaling/migrations"
+)
+
+// mailerPingTTL is how long the outcome of a mailer ping is reused. Every
+// instance is probed every few seconds; the mail server needn't see each
+// probe.
+const mailerPingTTL = 30 * time.Second
+
+type mailerPing struct {
+	sync.Mutex
+	at  time.Time
+	err error
+}
+
+// CheckReadiness reports whether the server can handle requests: the
+// database answers, every migration is applied and the mailer is
+// reachable. It returns the outcome of each check, "ok" or "failed", and
+// whether all of them passed; what went wrong is only logged, since the
+// probe is public. Apps without a database, as used with in-memory
+// repositories, skip the database checks.
+func (s *Service) CheckReadiness(ctx context.Context) (map[string]string, bool) {
+	checks := make(map[string]string)
+	ready := true
+	report := func(name string, err error) {
+		if err != nil {
+			slog.WarnContext(ctx, "Readiness check failed", "check", name, "error", err)
+			checks[name] = "failed"
+			ready = false
+			return
+		}
+		checks[name] = "ok"
+	}
+
+	if s.DB != nil {
+		sqlDB, err := s.DB.DB()
+		if err == nil {
+			err = sqlDB.PingContext(ctx)
+		}
+		report("database", err)
+
+		if err == nil {
+			report("migrations", checkMigrations(ctx, sqlDB))
+		}
+	}
+
+	report("mailer", s.pingMailer(ctx))
+
+	return checks, ready
+}
+
+// pingMailer checks the mailer's backend is reachable, reusing the last
+// outcome for mailerPingTTL. Concurrent probes wait for a single ping.
+func (s *Service) pingMailer(ctx context.Context) error {
+	pinger, ok := s.Mailer.(mailer.Pinger)
+	if !ok {
+		return nil
+	}
+
+	s.mailerPing.Lock()
+	defer s.mailerPing.Unlock()
+	now := s.Clock.Now()
+	if !s.mailerPing.at.IsZero() && now.Sub(s.mailerPing.at) < mailerPingTTL {
+		return s.mailerPing.err
+	}
+	s.mailerPing.err = pinger.Ping(ctx)
+	s.mailerPing.at = now
+	return s.mailerPing.err
+}
+
+// checkMigrations fails while migrations are pending, so a new release
+// isn't routed traffic before `migrate up` ran.
+func checkMigrations(ctx context.Context, db *sql.DB) error {
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d pending, starting with %s", len(pending), pending[0])
+	}
+	return nil
+}
@@ -0,0 +1,321 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cheeszy/journaling/models"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrUnknownImportFormat = errors.New("archive is not a Day One export, a Journey export or a folder of Markdown files")
+
+const (
+	importMaxFileBytes = 20 << 20
+	importTitleLength  = 120
+
+	// An archive may expand to at most this much in total, so a small zip
+	// bomb can't tie up the importer.
+	importMaxFiles             = 10_000
+	importMaxUncompressedBytes = 1 << 30
+)
+
+// importedEntry is one journal entry read from an archive. Err is set when
+// the entry couldn't be parsed; it's reported instead of imported.
+type importedEntry struct {
+	Source    string
+	Title     string
+	Body      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Err       error
+}
+
+// checkImportArchive rejects archives with too many files or whose files
+// add up to more than we're willing to read, going by the zip's directory.
+func checkImportArchive(r *zip.Reader) error {
+	if len(r.File) > importMaxFiles {
+		return fmt.Errorf("%w: more than %d files", ErrImportTooLarge, importMaxFiles)
+	}
+	var total uint64
+	for _, f := range r.File {
+		total += f.UncompressedSize64
+		if total > importMaxUncompressedBytes {
+			return fmt.Errorf("%w: more than %d MB uncompressed", ErrImportTooLarge, importMaxUncompressedBytes>>20)
+		}
+	}
+	return nil
+}
+
+// parseImportArchive detects which app produced the zip and returns its
+// entries in a stable order, oldest first. Entries whose body is longer
+// than maxBodyBytes are returned as failed, without their body.
+func parseImportArchive(r *zip.Reader, maxBodyBytes int64) (string, []importedEntry, error) {
+	if err := checkImportArchive(r); err != nil {
+		return "", nil, err
+	}
+
+	var jsonFiles, mdFiles []*zip.File
+	for _, f := range r.File {
+		name := f.Name
+		if f.FileInfo().IsDir() || strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), ".") {
+			continue
+		}
+		switch strings.ToLower(path.Ext(name)) {
+		case ".json":
+			jsonFiles = append(jsonFiles, f)
+		case ".md", ".markdown":
+			mdFiles = append(mdFiles, f)
+		}
+	}
+
+	var (
+		format  string
+		entries []importedEntry
+	)
+	add := func(parsed ...importedEntry) {
+		for _, entry := range parsed {
+			if entry.Err == nil && int64(len(entry.Body)) > maxBodyBytes {
+				entry.Body = ""
+				entry.Err = ErrBodyTooLarge
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	for _, f := range jsonFiles {
+		data, err := readZipFile(f)
+		if err != nil {
+			continue
+		}
+		if dayOne, ok := parseDayOne(f.Name, data); ok {
+			format = models.ImportFormatDayOne
+			add(dayOne...)
+		}
+	}
+
+	if format == "" {
+		for _, f := range jsonFiles {
+			data, err := readZipFile(f)
+			if err != nil {
+				entries = append(entries, importedEntry{Source: f.Name, Err: err})
+				continue
+			}
+			if entry, ok := parseJourney(f.Name, data); ok {
+				format = models.ImportFormatJourney
+				add(entry)
+			}
+		}
+	}
+
+	if format == "" && len(mdFiles) > 0 {
+		format = models.ImportFormatMarkdown
+		entries = entries[:0]
+		for _, f := range mdFiles {
+			data, err := readZipFile(f)
+			if err != nil {
+				entries = append(entries, importedEntry{Source: f.Name, Err: err})
+				continue
+			}
+			add(parseMarkdownEntry(f.Name, data, f.Modified))
+		}
+	}
+
+	if format == "" {
+		return "", nil, ErrUnknownImportFormat
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+		}
+		return entries[i].Source < entries[j].Source
+	})
+
+	return format, entries, nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	if f.UncompressedSize64 > importMaxFileBytes {
+		return nil, fmt.Errorf("file is larger than %d MB", importMaxFileBytes>>20)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, importMaxFileBytes))
+}
+
+type dayOneExport struct {
+	Entries []struct {
+		UUID         string `json:"uuid"`
+		CreationDate string `json:"creationDate"`
+		ModifiedDate string `json:"modifiedDate"`
+		Text         string `json:"text"`
+	} `json:"entries"`
+}
+
+// parseDayOne reads a Day One JSON export, which keeps all entries of a
+// journal in one file under "entries".
+func parseDayOne(name string, data []byte) ([]importedEntry, bool) {
+	var export dayOneExport
+	if err := json.Unmarshal(data, &export); err != nil || len(export.Entries) == 0 {
+		return nil, false
+	}
+	if export.Entries[0].CreationDate == "" {
+		return nil, false
+	}
+
+	entries := make([]importedEntry, 0, len(export.Entries))
+	for i, e := range export.Entries {
+		source := e.UUID
+		if source == "" {
+			source = fmt.Sprintf("%s#%d", name, i+1)
+		}
+		entry := importedEntry{Source: source}
+
+		created, err := time.Parse(time.RFC3339, e.CreationDate)
+		if err != nil {
+			entry.Err = fmt.Errorf("invalid creationDate %q", e.CreationDate)
+			entries = append(entries, entry)
+			continue
+		}
+		entry.CreatedAt = created
+		entry.UpdatedAt = created
+		if modified, err := time.Parse(time.RFC3339, e.ModifiedDate); err == nil {
+			entry.UpdatedAt = modified
+		}
+		entry.Title, entry.Body = splitTitle(e.Text)
+		entries = append(entries, entry)
+	}
+	return entries, true
+}
+
+type journeyEntry struct {
+	ID           string `json:"id"`
+	Text         string `json:"text"`
+	DateJournal  int64  `json:"date_journal"`
+	DateModified int64  `json:"date_modified"`
+}
+
+var (
+	htmlBreaks = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</li>|</h[1-6]>`)
+	htmlTags   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// parseJourney reads one entry of a Journey export, which stores each entry
+// in its own JSON file with millisecond timestamps.
+func parseJourney(name string, data []byte) (importedEntry, bool) {
+	var e journeyEntry
+	if err := json.Unmarshal(data, &e); err != nil || e.DateJournal == 0 {
+		return importedEntry{}, false
+	}
+
+	text := e.Text
+	if strings.HasPrefix(strings.TrimSpace(text), "<") {
+		text = htmlBreaks.ReplaceAllString(text, "\n")
+		text = html.UnescapeString(htmlTags.ReplaceAllString(text, ""))
+	}
+
+	entry := importedEntry{
+		Source:    name,
+		CreatedAt: time.UnixMilli(e.DateJournal),
+		UpdatedAt: time.UnixMilli(e.DateJournal),
+	}
+	if e.DateModified > 0 {
+		entry.UpdatedAt = time.UnixMilli(e.DateModified)
+	}
+	entry.Title, entry.Body = splitTitle(text)
+	return entry, true
+}
+
+type markdownFrontMatter struct {
+	Title string `yaml:"title"`
+	Date  string `yaml:"date"`
+}
+
+var frontMatterDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseMarkdownEntry reads a Markdown file with optional YAML front matter.
+// Without a title the first line is used; without a date, the file's
+// modification time.
+func parseMarkdownEntry(name string, data []byte, modified time.Time) importedEntry {
+	entry := importedEntry{Source: name, CreatedAt: modified, UpdatedAt: modified}
+
+	text := strings.ReplaceAll(string(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))), "\r\n", "\n")
+	var fm markdownFrontMatter
+	if strings.HasPrefix(text, "---\n") {
+		end := strings.Index(text[4:], "\n---")
+		if end < 0 {
+			entry.Err = errors.New("unterminated front matter")
+			return entry
+		}
+		if err := yaml.Unmarshal([]byte(text[4:4+end]), &fm); err != nil {
+			entry.Err = fmt.Errorf("invalid front matter: %v", err)
+			return entry
+		}
+		text = strings.TrimPrefix(text[4+end+4:], "\n")
+	}
+
+	if fm.Date != "" {
+		parsed := false
+		for _, layout := range frontMatterDateLayouts {
+			if t, err := time.Parse(layout, fm.Date); err == nil {
+				entry.CreatedAt, entry.UpdatedAt, parsed = t, t, true
+				break
+			}
+		}
+		if !parsed {
+			entry.Err = fmt.Errorf("invalid date %q", fm.Date)
+			return entry
+		}
+	}
+
+	if fm.Title != "" {
+		entry.Title = strings.TrimSpace(fm.Title)
+		entry.Body = strings.TrimSpace(text)
+	} else {
+		entry.Title, entry.Body = splitTitle(text)
+	}
+	if entry.Title == "Untitled" {
+		entry.Title = strings.TrimSuffix(path.Base(name), path.Ext(name))
+	}
+	return entry
+}
+
+// splitTitle uses the first line of the text as the title, dropping Markdown
+// heading marks. Very long first lines stay in the body and are shortened
+// for the title.
+func splitTitle(text string) (string, string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "Untitled", ""
+	}
+
+	first, rest, _ := strings.Cut(text, "\n")
+	title := strings.TrimSpace(strings.TrimLeft(first, "#"))
+	if title == "" {
+		return "Untitled", text
+	}
+	if len([]rune(title)) > importTitleLength {
+		return excerpt(title, importTitleLength), text
+	}
+	return title, strings.TrimSpace(rest)
+}
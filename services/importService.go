@@ -0,0 +1,197 @@
+package services
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"os"
+	"time"
+
+	"github.com/cheeszy/journaling/app"
+	"github.com/cheeszy/journaling/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrImportTooLarge = errors.New("import archive is too large")
+	ErrImportNotZip   = errors.New("import must be a zip archive")
+)
+
+const (
+	importMaxUploadBytes = 200 << 20
+	importStaleAfter     = 30 * time.Minute
+	importBatchSize      = 2
+	importMaxErrors      = 500
+)
+
+func (s *Service) importDir() string {
+	return s.Config.ImportDir
+}
+
+// RequestImport stores an uploaded archive and queues it for import.
+func (s *Service) RequestImport(userID uuid.UUID, file *multipart.FileHeader) (*models.ImportJob, error) {
+	if file.Size > importMaxUploadBytes {
+		return nil, ErrImportTooLarge
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(s.importDir(), 0o700); err != nil {
+		return nil, err
+	}
+	dst, err := os.CreateTemp(s.importDir(), "import-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	defer dst.Close()
+
+	size, err := io.Copy(dst, io.LimitReader(src, importMaxUploadBytes+1))
+	if err == nil && size > importMaxUploadBytes {
+		err = ErrImportTooLarge
+	}
+	if err == nil {
+		var archive *zip.Reader
+		if archive, err = zip.NewReader(dst, size); err != nil {
+			err = ErrImportNotZip
+		} else {
+			err = checkImportArchive(archive)
+		}
+	}
+	if err != nil {
+		os.Remove(dst.Name())
+		return nil, err
+	}
+
+	job := models.ImportJob{
+		UserID:   userID,
+		Status:   models.ImportStatusPending,
+		FilePath: dst.Name(),
+	}
+	if err := s.ImportJobs.Create(&job); err != nil {
+		os.Remove(dst.Name())
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *Service) GetImportJob(id string, userID uuid.UUID) (*models.ImportJob, error) {
+	return s.ImportJobs.FindByIDAndUserID(id, userID)
+}
+
+// ProcessImports imports queued archives. Progress is saved with every
+// entry, so an import interrupted by a restart resumes where it stopped.
+func (s *Service) ProcessImports(now time.Time) (int, error) {
+	done := 0
+	for done < importBatchSize {
+		job, err := s.ImportJobs.Claim(now, importStaleAfter)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			break
+		}
+		if err != nil {
+			return done, err
+		}
+
+		if err := s.processImport(job); err != nil {
+			slog.Error("Import failed", "import_id", job.ID, "error", err)
+			job.Status = models.ImportStatusFailed
+			job.Error = err.Error()
+			if err := s.ImportJobs.Update(job); err != nil {
+				return done, err
+			}
+		}
+		os.Remove(job.FilePath)
+		done++
+	}
+	return done, nil
+}
+
+func (s *Service) processImport(job *models.ImportJob) error {
+	archive, err := zip.OpenReader(job.FilePath)
+	if err != nil {
+		return ErrImportNotZip
+	}
+	defer archive.Close()
+
+	user, err := s.Users.FindByID(job.UserID)
+	if err != nil {
+		return err
+	}
+	// The plan's limit is checked again as each entry is saved; this keeps
+	// oversized bodies from being held in memory until then.
+	limits := s.limitsFor(user.Plan)
+	format, entries, err := parseImportArchive(&archive.Reader, limits.MaxBodyBytes)
+	if err != nil {
+		return err
+	}
+	job.Format = format
+	job.Total = len(entries)
+
+	// Entries before this index were handled by an earlier, interrupted run.
+	start := job.Imported + job.Failed
+	for i := start; i < len(entries); i++ {
+		entry := entries[i]
+		post := models.Post{
+			ID:        uuid.New(),
+			Kind:      models.PostKindText,
+			Title:     entry.Title,
+			Body:      entry.Body,
+			UserID:    job.UserID,
+			Status:    models.PostStatusPublished,
+			CreatedAt: entry.CreatedAt,
+			UpdatedAt: entry.UpdatedAt,
+		}
+		// Imported bodies are stored encrypted; the plan's body limit
+		// applies to the plaintext.
+		plainBodyBytes := bodyBytes(&post)
+		if entry.Err == nil {
+			if err := s.encryptPostBody(&post); err != nil {
+				return fmt.Errorf("entry %s: %w", entry.Source, err)
+			}
+		}
+		err := s.Transaction(func(tx *app.App) error {
+			entryErr := entry.Err
+			if entryErr == nil {
+				// Entries over the plan's limits are reported like any other
+				// entry that can't be imported.
+				entryErr = s.reserveUsage(tx, job.UserID, 1, postBytes(&post), plainBodyBytes)
+				if entryErr != nil && !IsQuotaError(entryErr) {
+					return entryErr
+				}
+			}
+			if entryErr == nil {
+				if err := tx.Posts.Create(&post); err != nil {
+					return err
+				}
+				job.Imported++
+			} else {
+				job.Failed++
+				if len(job.Errors) < importMaxErrors {
+					job.Errors = append(job.Errors, models.ImportEntryError{
+						Entry: entry.Source,
+						Error: entryErr.Error(),
+					})
+				}
+			}
+			return tx.ImportJobs.Update(job)
+		})
+		if err != nil {
+			return fmt.Errorf("entry %s: %w", entry.Source, err)
+		}
+	}
+
+	s.InvalidateStats(job.UserID)
+
+	now := s.Clock.Now()
+	job.Status = models.ImportStatusCompleted
+	job.CompletedAt = &now
+	job.Error = ""
+	return s.ImportJobs.Update(job)
+}
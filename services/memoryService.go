@@ -0,0 +1,115 @@
+package services
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/cheeszy/journaling/app"
+	"github.com/cheeszy/journaling/dto"
+	"github.com/cheeszy/journaling/models"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidDate = errors.New("date must be formatted as YYYY-MM-DD")
+
+const digestExcerptLength = 200
+
+func (s *Service) findMemories(user *models.User, date time.Time) ([]models.Post, error) {
+	posts, err := s.Posts.FindOnThisDay(
+		user.ID, user.Location().String(),
+		int(date.Month()), date.Day(), date.Year(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return posts, s.decryptPostBodies(posts)
+}
+
+// GetOnThisDay returns the user's entries written on the same month and day
+// as date in previous years. An empty date means today in the user's time zone.
+func (s *Service) GetOnThisDay(user models.User, dateStr string) ([]dto.PostResponse, error) {
+	date := s.Clock.Now().In(user.Location())
+	if dateStr != "" {
+		parsed, err := time.ParseInLocation(dateLayout, dateStr, user.Location())
+		if err != nil {
+			return nil, ErrInvalidDate
+		}
+		date = parsed
+	}
+
+	posts, err := s.findMemories(&user, date)
+	if err != nil {
+		return nil, err
+	}
+	return s.toPostResponses(posts), nil
+}
+
+func (s *Service) UpdateDigestSettings(userID uuid.UUID, req dto.DigestSettingsRequest) error {
+	hour := 8
+	if req.Hour != nil {
+		hour = *req.Hour
+	}
+	return s.Users.UpdateDigestSettings(userID, *req.Enabled, hour)
+}
+
+// SendDailyDigests emails "on this day" memories to every subscriber whose
+// preferred local hour has passed and who hasn't had today's digest yet.
+// Digests are queued in the email outbox.
+// Days without memories are marked as done without sending anything.
+func (s *Service) SendDailyDigests(now time.Time) (int, error) {
+	users, err := s.Users.FindDigestSubscribers()
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for i := range users {
+		user := &users[i]
+		local := now.In(user.Location())
+		today := local.Format(dateLayout)
+		if local.Hour() < user.DigestHour || user.LastDigestDate == today {
+			continue
+		}
+
+		posts, err := s.findMemories(user, local)
+		if err != nil {
+			slog.Error("Digest lookup failed", "user_id", user.ID, "error", err)
+			continue
+		}
+
+		memories := make([]models.Post, 0, len(posts))
+		for _, post := range posts {
+			if !post.IsSealed(now) {
+				memories = append(memories, post)
+			}
+		}
+
+		err = s.Transaction(func(tx *app.App) error {
+			if err := tx.Users.UpdateLastDigestDate(user.ID, today); err != nil {
+				return err
+			}
+			if len(memories) == 0 {
+				return nil
+			}
+			return s.QueueDigestEmail(tx, user, local, memories)
+		})
+		if err != nil {
+			return sent, err
+		}
+		if len(memories) > 0 {
+			sent++
+		}
+	}
+
+	return sent, nil
+}
+
+func excerpt(text string, max int) string {
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) <= max {
+		return string(runes)
+	}
+	return strings.TrimSpace(string(runes[:max])) + "…"
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cheeszy/journaling/app"
+	"github.com/cheeszy/journaling/dto"
+	"github.com/cheeszy/journaling/models"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidMetricRange = errors.New("metric min must not be greater than max")
+	ErrUnknownMetric      = errors.New("unknown metric")
+	ErrInvalidMetricValue = errors.New("metric value out of range")
+	ErrInvalidSeriesQuery = errors.New("invalid series query")
+)
+
+const defaultSeriesRange = 30 * 24 * time.Hour
+
+func (s *Service) CreateMetric(userID uuid.UUID, req dto.CreateMetricRequest) (*models.Metric, error) {
+	metric := models.Metric{
+		UserID: userID,
+		Name:   req.Name,
+		Kind:   req.Kind,
+		Unit:   req.Unit,
+		Min:    req.Min,
+		Max:    req.Max,
+	}
+
+	switch metric.Kind {
+	case models.MetricKindScale:
+		if metric.Min == nil {
+			min := 1.0
+			metric.Min = &min
+		}
+		if metric.Max == nil {
+			max := 5.0
+			metric.Max = &max
+		}
+	case models.MetricKindBoolean:
+		metric.Min, metric.Max, metric.Unit = nil, nil, ""
+	}
+
+	if metric.Min != nil && metric.Max != nil && *metric.Min > *metric.Max {
+		return nil, ErrInvalidMetricRange
+	}
+
+	if err := s.Metrics.Create(&metric); err != nil {
+		return nil, err
+	}
+	return &metric, nil
+}
+
+func (s *Service) GetMetrics(userID uuid.UUID) ([]models.Metric, error) {
+	return s.Metrics.FindByUserID(userID)
+}
+
+func (s *Service) DeleteMetric(id string, userID uuid.UUID) error {
+	return s.Metrics.DeleteByIDAndUserID(id, userID)
+}
+
+func validateMetricValue(metric *models.Metric, value float64) error {
+	if metric.Kind == models.MetricKindBoolean {
+		if value != 0 && value != 1 {
+			return ErrInvalidMetricValue
+		}
+		return nil
+	}
+	if metric.Min != nil && value < *metric.Min {
+		return ErrInvalidMetricValue
+	}
+	if metric.Max != nil && value > *metric.Max {
+		return ErrInvalidMetricValue
+	}
+	return nil
+}
+
+// saveMetricValues validates the submitted values against the user's own
+// metrics and stores them on the post.
+func saveMetricValues(tx *app.App, post *models.Post, inputs []dto.MetricValueInput) error {
+	if len(inputs) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(inputs))
+	for _, input := range inputs {
+		ids = append(ids, input.MetricID)
+	}
+
+	metrics, err := tx.Metrics.FindByIDs(post.UserID, ids)
+	if err != nil {
+		return err
+	}
+	byID := make(map[uuid.UUID]*models.Metric, len(metrics))
+	for i := range metrics {
+		byID[metrics[i].ID] = &metrics[i]
+	}
+
+	values := make([]models.MetricValue, 0, len(inputs))
+	for _, input := range inputs {
+		metric, ok := byID[input.MetricID]
+		if !ok {
+			return ErrUnknownMetric
+		}
+		if err := validateMetricValue(metric, input.Value); err != nil {
+			return err
+		}
+		values = append(values, models.MetricValue{
+			UserID:     post.UserID,
+			MetricID:   metric.ID,
+			PostID:     post.ID,
+			Value:      input.Value,
+			RecordedAt: post.CreatedAt,
+		})
+	}
+
+	return tx.Metrics.UpsertValues(values)
+}
+
+func parseSeriesTime(value string, fallback time.Time, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, ErrInvalidSeriesQuery
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// GetMetricSeries returns a metric's values aggregated per bucket between
+// from (inclusive) and to (inclusive for plain dates).
+func (s *Service) GetMetricSeries(id string, userID uuid.UUID, fromStr, toStr, bucket string) (*dto.MetricSeriesResponse, error) {
+	metric, err := s.Metrics.FindByIDAndUserID(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if bucket == "" {
+		bucket = "day"
+	}
+	if bucket != "day" && bucket != "week" && bucket != "month" {
+		return nil, ErrInvalidSeriesQuery
+	}
+
+	now := s.Clock.Now()
+	to, err := parseSeriesTime(toStr, now, true)
+	if err != nil {
+		return nil, err
+	}
+	from, err := parseSeriesTime(fromStr, to.Add(-defaultSeriesRange), false)
+	if err != nil {
+		return nil, err
+	}
+	if !from.Before(to) {
+		return nil, ErrInvalidSeriesQuery
+	}
+
+	rows, err := s.Metrics.Series(metric.ID, bucket, from, to, now)
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]dto.MetricSeriesPoint, 0, len(rows))
+	for _, row := range rows {
+		points = append(points, dto.MetricSeriesPoint(row))
+	}
+
+	return &dto.MetricSeriesResponse{
+		MetricID: metric.ID,
+		Bucket:   bucket,
+		From:     from,
+		To:       to,
+		Points:   points,
+	}, nil
+}
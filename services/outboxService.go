@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/cheeszy/journaling/mailer"
+	"github.com/cheeszy/journaling/models"
+)
+
+const (
+	outboxBatchSize   = 20
+	outboxLease       = 5 * time.Minute
+	outboxMaxAttempts = 8
+	outboxBaseBackoff = 30 * time.Second
+	outboxMaxBackoff  = 6 * time.Hour
+	outboxSendTimeout = time.Minute
+)
+
+// outboxBackoff returns the delay before the next attempt: 30s, 1m, 2m, ...
+// capped at six hours.
+func outboxBackoff(attempts int) time.Duration {
+	delay := time.Duration(float64(outboxBaseBackoff) * math.Pow(2, float64(attempts-1)))
+	if delay <= 0 || delay > outboxMaxBackoff {
+		return outboxMaxBackoff
+	}
+	return delay
+}
+
+// DeliverOutbox sends due outbox emails. Transient failures are retried with
+// exponential backoff; permanent failures and emails that run out of attempts
+// are dead-lettered.
+func (s *Service) DeliverOutbox(now time.Time) (sent, failed int, err error) {
+	emails, err := s.Outbox.ClaimDue(now, outboxLease, outboxBatchSize)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, email := range emails {
+		if s.deliverOutboxEmail(&email) {
+			sent++
+		} else {
+			failed++
+		}
+	}
+
+	return sent, failed, nil
+}
+
+func (s *Service) deliverOutboxEmail(email *models.EmailOutbox) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), outboxSendTimeout)
+	defer cancel()
+
+	attempts := email.Attempts + 1
+	sendErr := s.Mailer.Send(ctx, mailer.Message{
+		To:      []string{email.To},
+		Subject: email.Subject,
+		Text:    email.TextBody,
+		HTML:    email.HTMLBody,
+	})
+
+	if sendErr == nil {
+		if err := s.Outbox.MarkSent(email.ID, attempts, s.Clock.Now()); err != nil {
+			slog.Error("Outbox: failed to mark email as sent", "outbox_id", email.ID, "error", err)
+		}
+		return true
+	}
+
+	status := models.OutboxStatusPending
+	next := s.Clock.Now().Add(outboxBackoff(attempts))
+	if mailer.IsPermanent(sendErr) || attempts >= outboxMaxAttempts {
+		status = models.OutboxStatusDead
+	}
+
+	slog.Warn("Outbox: delivery failed", "outbox_id", email.ID, "template", email.Template,
+		"attempt", attempts, "status", status, "error", sendErr)
+
+	if err := s.Outbox.MarkFailed(email.ID, status, attempts, next, sendErr.Error()); err != nil {
+		slog.Error("Outbox: failed to record delivery failure", "outbox_id", email.ID, "error", err)
+	}
+	return false
+}
+
+func (s *Service) GetOutboxEmails(status string, limit int) ([]models.EmailOutbox, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	return s.Outbox.Find(status, limit)
+}
+
+func (s *Service) GetOutboxEmail(id string) (*models.EmailOutbox, error) {
+	return s.Outbox.FindByID(id)
+}
+
+// RetryOutboxEmail moves a dead-lettered email back into the queue.
+func (s *Service) RetryOutboxEmail(id string) (bool, error) {
+	n, err := s.Outbox.Requeue(id, s.Clock.Now())
+	return n > 0, err
+}
@@ -1,95 +1,425 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"time"
 
+	"github.com/cheeszy/journaling/app"
 	"github.com/cheeszy/journaling/dto"
-	"github.com/cheeszy/journaling/initializers"
 	"github.com/cheeszy/journaling/models"
-	"github.com/cheeszy/journaling/repositories"
 	"github.com/google/uuid"
 )
 
-func CreatePost(req dto.CreatePostRequest, userID uuid.UUID) (*dto.PostResponse, error) {
+var (
+	ErrPublishAtRequired    = errors.New("publishAt must be set in the future for scheduled posts")
+	ErrPublishAtUnscheduled = errors.New("publishAt can only be set on scheduled posts")
+	ErrNotAutosavable       = errors.New("only drafts and scheduled posts can be autosaved")
+	ErrSealedUntilPast      = errors.New("sealedUntil must be in the future")
+	ErrPostSealed           = errors.New("post is sealed until its unlock date")
+	ErrNotVoiceEntry        = errors.New("only voice entries have a transcript")
+)
+
+// toPostResponse maps a post to its API shape. Sealed time capsules only
+// expose their unlock date; title and body are withheld from everyone,
+// including the owner, until then.
+func (s *Service) toPostResponse(post *models.Post) dto.PostResponse {
+	res := s.toRevealedPostResponse(post)
+	if res.Sealed {
+		res.Title = ""
+		res.Body = ""
+		res.Transcript = ""
+		res.Audio = nil
+		res.Metrics = nil
+		res.Cover = nil
+	}
+	return res
+}
+
+// toRevealedPostResponse is toPostResponse without withholding anything
+// from sealed time capsules. Only the owner's data export uses it.
+func (s *Service) toRevealedPostResponse(post *models.Post) dto.PostResponse {
+	res := dto.PostResponse{
+		ID:          post.ID,
+		Kind:        post.Kind,
+		Title:       post.Title,
+		Body:        post.Body,
+		Transcript:  post.Transcript,
+		Audio:       toAudioResponse(post),
+		Status:      post.Status,
+		PublishAt:   post.PublishAt,
+		AutosavedAt: post.AutosavedAt,
+		SealedUntil: post.SealedUntil,
+		Cover:       toCoverResponse(post),
+		CreatedAt:   post.CreatedAt,
+		UpdatedAt:   post.UpdatedAt,
+	}
+
+	for _, value := range post.MetricValues {
+		res.Metrics = append(res.Metrics, dto.MetricValueResponse{
+			MetricID: value.MetricID,
+			Name:     value.Metric.Name,
+			Value:    value.Value,
+		})
+	}
+
+	// Callers decrypt bodies first; ciphertext is never handed out.
+	if post.BodyEncrypted {
+		res.Body = ""
+	}
+
+	res.Sealed = post.IsSealed(s.Clock.Now())
+	return res
+}
+
+func (s *Service) toPostResponses(posts []models.Post) []dto.PostResponse {
+	responses := make([]dto.PostResponse, 0, len(posts))
+	for i := range posts {
+		responses = append(responses, s.toPostResponse(&posts[i]))
+	}
+	return responses
+}
+
+func (s *Service) validateSealedUntil(sealedUntil *time.Time) error {
+	if sealedUntil != nil && !sealedUntil.After(s.Clock.Now()) {
+		return ErrSealedUntilPast
+	}
+	return nil
+}
+
+// resolvePostStatus validates the requested status and returns the status and
+// publish time to store. An empty status means the post is published now. A
+// publish time is rejected rather than ignored for anything but a scheduled
+// post.
+func (s *Service) resolvePostStatus(status string, publishAt *time.Time) (string, *time.Time, error) {
+	if publishAt != nil && status != models.PostStatusScheduled {
+		return "", nil, ErrPublishAtUnscheduled
+	}
+	switch status {
+	case "", models.PostStatusPublished:
+		return models.PostStatusPublished, nil, nil
+	case models.PostStatusDraft:
+		return models.PostStatusDraft, nil, nil
+	case models.PostStatusScheduled:
+		if publishAt == nil || !publishAt.After(s.Clock.Now()) {
+			return "", nil, ErrPublishAtRequired
+		}
+		return models.PostStatusScheduled, publishAt, nil
+	}
+	return "", nil, errors.New("invalid status")
+}
+
+func (s *Service) CreatePost(req dto.CreatePostRequest, userID uuid.UUID) (*dto.PostResponse, error) {
+	status, publishAt, err := s.resolvePostStatus(req.Status, req.PublishAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validateSealedUntil(req.SealedUntil); err != nil {
+		return nil, err
+	}
+
 	post := models.Post{
-		Title:  req.Title,
-		Body:   req.Body,
-		UserID: userID,
+		Kind:        models.PostKindText,
+		Title:       req.Title,
+		Body:        req.Body,
+		UserID:      userID,
+		Status:      status,
+		PublishAt:   publishAt,
+		SealedUntil: req.SealedUntil,
 	}
 
-	if err := repositories.CreatePost(initializers.DB, &post); err != nil {
+	err = s.Transaction(func(tx *app.App) error {
+		if err := s.reserveUsage(tx, userID, 1, postBytes(&post), bodyBytes(&post)); err != nil {
+			return err
+		}
+		if err := tx.Posts.Create(&post); err != nil {
+			return err
+		}
+		if err := saveMetricValues(tx, &post, req.Metrics); err != nil {
+			return err
+		}
+		post.MetricValues, err = tx.Metrics.FindValuesByPostID(post.ID)
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	return &dto.PostResponse{
-		ID:        post.ID,
-		Title:     post.Title,
-		Body:      post.Body,
-		CreatedAt: post.CreatedAt,
-		UpdatedAt: post.UpdatedAt,
-	}, nil
+	s.InvalidateStats(userID)
+
+	res := s.toPostResponse(&post)
+	return &res, nil
 }
 
-func GetPostByID(id string) (*dto.PostResponse, error) {
-	post, err := repositories.FindPostByID(initializers.DB, id)
+func (s *Service) GetPostByID(id string) (*dto.PostResponse, error) {
+	post, err := s.Posts.FindByID(id)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.decryptPostBody(post); err != nil {
+		return nil, err
+	}
 
-	return &dto.PostResponse{
-		ID:    post.ID,
-		Title: post.Title,
-		Body:  post.Body,
-	}, nil
+	res := s.toPostResponse(post)
+	return &res, nil
 }
 
-func GetPostsByUsername(username string) ([]dto.PostResponse, error) {
-	user, err := repositories.FindUserWithPostsByUsername(initializers.DB, username)
+func (s *Service) GetPostsByUsername(username string) ([]dto.PostResponse, error) {
+	posts, err := s.Posts.FindByUsername(username)
 	if err != nil {
 		return nil, err
 	}
-
-	responses := make([]dto.PostResponse, 0, len(user.Posts))
-	for _, post := range user.Posts {
-		responses = append(responses, dto.PostResponse{
-			ID:        post.ID,
-			Title:     post.Title,
-			Body:      post.Body,
-			CreatedAt: post.CreatedAt,
-			UpdatedAt: post.UpdatedAt,
-		})
+	if err := s.decryptPostBodies(posts); err != nil {
+		return nil, err
 	}
 
-	return responses, nil
+	return s.toPostResponses(posts), nil
 }
 
-func UpdatePost(id string, req dto.UpdatePostRequest) (*dto.PostResponse, error) {
-	post, err := repositories.FindPostByID(initializers.DB, id)
+func (s *Service) UpdatePost(id string, userID uuid.UUID, req dto.UpdatePostRequest) (*dto.PostResponse, error) {
+	post, err := s.Posts.FindByIDAndUserID(id, userID)
 	if err != nil {
 		return nil, err
 	}
 
+	if post.IsSealed(s.Clock.Now()) {
+		return nil, ErrPostSealed
+	}
+
+	if req.SealedUntil != nil {
+		if err := s.validateSealedUntil(req.SealedUntil); err != nil {
+			return nil, err
+		}
+		post.SealedUntil = req.SealedUntil
+	}
+
+	// A publishAt on its own reschedules the post, keeping its status.
+	if req.Status != "" || req.PublishAt != nil {
+		status := req.Status
+		if status == "" {
+			status = post.Status
+		}
+		status, publishAt, err := s.resolvePostStatus(status, req.PublishAt)
+		if err != nil {
+			return nil, err
+		}
+		post.Status = status
+		post.PublishAt = publishAt
+	}
+
+	if req.Transcript != nil {
+		if post.Kind != models.PostKindVoice {
+			return nil, ErrNotVoiceEntry
+		}
+		post.Transcript = *req.Transcript
+	}
+
 	post.Title = req.Title
 	post.Body = req.Body
-	post.UpdatedAt = time.Now()
+	post.UpdatedAt = s.Clock.Now()
+	// An encrypted body stays encrypted; the limit applies to the plaintext.
+	newBodyBytes := bodyBytes(post)
+	if post.BodyEncrypted {
+		if err := s.encryptPostBody(post); err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.Transaction(func(tx *app.App) error {
+		stored, err := lockStoredPost(tx, post)
+		if err != nil {
+			return err
+		}
+		growth := postBytes(post) - postBytes(stored)
+		if err := s.reserveUsage(tx, post.UserID, 0, growth, newBodyBytes); err != nil {
+			return err
+		}
+		if err := tx.Posts.Update(post); err != nil {
+			return err
+		}
+		if err := saveMetricValues(tx, post, req.Metrics); err != nil {
+			return err
+		}
+		post.MetricValues, err = tx.Metrics.FindValuesByPostID(post.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.InvalidateStats(post.UserID)
+
+	if err := s.decryptPostBody(post); err != nil {
+		return nil, err
+	}
+	res := s.toPostResponse(post)
+	return &res, nil
+}
+
+// AutosavePost stores an in-progress title/body for a draft or scheduled post.
+// Unlike UpdatePost it leaves updatedAt alone, so clients can call it often.
+func (s *Service) AutosavePost(id string, userID uuid.UUID, req dto.AutosavePostRequest) (*dto.PostResponse, error) {
+	post, err := s.Posts.FindByIDAndUserID(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if post.Status == models.PostStatusPublished {
+		return nil, ErrNotAutosavable
+	}
+	if post.IsSealed(s.Clock.Now()) {
+		return nil, ErrPostSealed
+	}
+
+	encrypted := post.BodyEncrypted
+	if err := s.decryptPostBody(post); err != nil {
+		return nil, err
+	}
 
-	if err := repositories.UpdatePost(initializers.DB, post); err != nil {
+	now := s.Clock.Now()
+	fields := map[string]interface{}{"autosaved_at": now}
+	if req.Title != nil {
+		fields["title"] = *req.Title
+		post.Title = *req.Title
+	}
+	if req.Body != nil {
+		post.Body = *req.Body
+	}
+	if req.Transcript != nil {
+		if post.Kind != models.PostKindVoice {
+			return nil, ErrNotVoiceEntry
+		}
+		fields["transcript"] = *req.Transcript
+		post.Transcript = *req.Transcript
+	}
+	post.AutosavedAt = &now
+
+	// An encrypted body stays encrypted; the limit applies to the plaintext.
+	newBodyBytes := bodyBytes(post)
+	if encrypted {
+		if err := s.encryptPostBody(post); err != nil {
+			return nil, err
+		}
+	}
+	if req.Body != nil {
+		fields["body"] = post.Body
+	}
+
+	err = s.Transaction(func(tx *app.App) error {
+		stored, err := lockStoredPost(tx, post)
+		if err != nil {
+			return err
+		}
+		// Only the autosaved fields change; the rest stays as stored.
+		saved := *stored
+		if req.Title != nil {
+			saved.Title = post.Title
+		}
+		if req.Body != nil {
+			saved.Body = post.Body
+		}
+		if req.Transcript != nil {
+			saved.Transcript = post.Transcript
+		}
+		growth := postBytes(&saved) - postBytes(stored)
+		if err := s.reserveUsage(tx, userID, 0, growth, newBodyBytes); err != nil {
+			return err
+		}
+		return tx.Posts.Autosave(post, fields)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.decryptPostBody(post); err != nil {
 		return nil, err
 	}
+	res := s.toPostResponse(post)
+	return &res, nil
+}
+
+func (s *Service) DeletePost(ctx context.Context, id string, userID uuid.UUID) error {
+	post, err := s.Posts.FindByIDAndUserID(id, userID)
+	if err != nil {
+		return err
+	}
+
+	attachments, err := s.Attachments.FindByPostID(post.ID)
+	if err != nil {
+		return err
+	}
+
+	released := postBytes(post) + post.CoverBytes
+	for _, attachment := range attachments {
+		released += attachment.Size
+	}
 
-	return &dto.PostResponse{
-		ID:        post.ID,
-		Title:     post.Title,
-		Body:      post.Body,
-		CreatedAt: post.CreatedAt,
-		UpdatedAt: post.UpdatedAt,
-	}, nil
+	err = s.Transaction(func(tx *app.App) error {
+		if err := tx.Attachments.DeleteByPostID(post.ID); err != nil {
+			return err
+		}
+		if err := tx.Posts.DeleteByID(id); err != nil {
+			return err
+		}
+		return s.reserveUsage(tx, post.UserID, -1, -released, 0)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.deleteBlobs(ctx, attachments)
+	s.removeCoverDirs([]uuid.UUID{post.ID})
+	s.InvalidateStats(post.UserID)
+	s.render.forget(post.ID)
+	return nil
+}
+
+func (s *Service) GetAllPosts() ([]dto.PostResponse, error) {
+	posts, err := s.Posts.FindPublished()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.decryptPostBodies(posts); err != nil {
+		return nil, err
+	}
+	return s.toPostResponses(posts), nil
 }
 
-func DeletePost(id string) error {
-	return repositories.DeletePostByID(initializers.DB, id)
+// NotifyUnsealedPosts emails the owners of time capsules that have reached
+// their unlock date. The post itself unseals in place; this only records that
+// the owner has been told.
+func (s *Service) NotifyUnsealedPosts(now time.Time) (int, error) {
+	posts, err := s.Posts.FindUnsealedToNotify(now)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range posts {
+		post := &posts[i]
+		err := s.Transaction(func(tx *app.App) error {
+			if err := tx.Posts.MarkUnsealNotified(post.ID, now); err != nil {
+				return err
+			}
+			return s.QueueTimeCapsuleEmail(tx, post)
+		})
+		if err != nil {
+			return i, err
+		}
+		// Its words count toward the stats now.
+		s.InvalidateStats(post.UserID)
+	}
+
+	return len(posts), nil
 }
 
-func GetAllPosts() ([]models.Post, error) {
-	return repositories.FindAllPosts(initializers.DB)
+// PublishDuePosts flips scheduled posts whose publishAt has passed to published.
+func (s *Service) PublishDuePosts(now time.Time) (int, error) {
+	posts, err := s.Posts.PublishDue(now)
+	if err != nil {
+		return 0, err
+	}
+	for _, post := range posts {
+		s.InvalidateStats(post.UserID)
+	}
+	return len(posts), nil
 }
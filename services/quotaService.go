@@ -0,0 +1,142 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/cheeszy/journaling/app"
+	"github.com/cheeszy/journaling/config"
+	"github.com/cheeszy/journaling/dto"
+	"github.com/cheeszy/journaling/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrBodyTooLarge         = errors.New("entry body is larger than your plan allows")
+	ErrPostQuotaExceeded    = errors.New("you've reached the number of entries your plan allows")
+	ErrStorageQuotaExceeded = errors.New("you've used all the storage your plan allows")
+	ErrUnknownPlan          = errors.New("plan must be free or pro")
+)
+
+// multipartOverhead is room for the form fields and part headers sent along
+// with an uploaded file.
+const multipartOverhead = 1 << 20
+
+// The most an upload request may send. Handlers cut requests off at these
+// sizes while reading them, instead of buffering an oversized upload first.
+const (
+	AttachmentRequestMaxBytes = attachmentMaxBytes + multipartOverhead
+	CoverRequestMaxBytes      = coverMaxBytes + multipartOverhead
+	ImportRequestMaxBytes     = importMaxUploadBytes + multipartOverhead
+)
+
+// PostRequestMaxBytes is the most a request creating or editing a post may
+// send on the plan: a body and a transcript at the plan's limit, both
+// escaped in JSON, and the other fields.
+func (s *Service) PostRequestMaxBytes(plan string) int64 {
+	return 4*s.limitsFor(plan).MaxBodyBytes + 64<<10
+}
+
+// limitsFor returns the configured limits of a plan.
+func (s *Service) limitsFor(plan string) config.PlanLimits {
+	if plan == models.PlanPro {
+		return s.Config.Plans.Pro
+	}
+	return s.Config.Plans.Free
+}
+
+// IsQuotaError reports whether err is one of the plan limit errors.
+func IsQuotaError(err error) bool {
+	return errors.Is(err, ErrBodyTooLarge) ||
+		errors.Is(err, ErrPostQuotaExceeded) ||
+		errors.Is(err, ErrStorageQuotaExceeded)
+}
+
+// postBytes is how much of the user's storage a post's text takes.
+func postBytes(post *models.Post) int64 {
+	return int64(len(post.Title) + len(post.Body) + len(post.Transcript))
+}
+
+// bodyBytes is the size checked against the plan's body limit. A voice
+// entry's transcript has the same limit as its body.
+func bodyBytes(post *models.Post) int64 {
+	return int64(max(len(post.Body), len(post.Transcript)))
+}
+
+// reserveUsage records that the user gains posts entries and bytes of
+// storage, after checking that the plan allows it and that a new or changed
+// body of bodyBytes fits. Negative changes release usage and always succeed.
+// It must run in the transaction that makes the change: the user's row stays
+// locked until it ends, so concurrent requests can't overshoot the limits.
+func (s *Service) reserveUsage(tx *app.App, userID uuid.UUID, posts, bytes, bodyBytes int64) error {
+	user, err := tx.Users.LockUsage(userID)
+	if err != nil {
+		return err
+	}
+
+	limits := s.limitsFor(user.Plan)
+	if bodyBytes > limits.MaxBodyBytes {
+		return ErrBodyTooLarge
+	}
+	if posts > 0 && user.PostCount+posts > limits.MaxPosts {
+		return ErrPostQuotaExceeded
+	}
+	if bytes > 0 && user.StoredBytes+bytes > limits.MaxBytes {
+		return ErrStorageQuotaExceeded
+	}
+
+	if posts == 0 && bytes == 0 {
+		return nil
+	}
+	return tx.Users.AddUsage(userID, posts, bytes)
+}
+
+// lockStoredPost locks the owner's usage and then the post, in that order
+// like every other usage change, and returns the post as stored. Size
+// changes must be measured against it: a copy read before the transaction
+// may be stale once the locks are held.
+func lockStoredPost(tx *app.App, post *models.Post) (*models.Post, error) {
+	if _, err := tx.Users.LockUsage(post.UserID); err != nil {
+		return nil, err
+	}
+	return tx.Posts.LockByID(post.ID)
+}
+
+func (s *Service) toUsageResponse(user *models.User) dto.UsageResponse {
+	limits := s.limitsFor(user.Plan)
+	return dto.UsageResponse{
+		Plan:            user.Plan,
+		Posts:           user.PostCount,
+		MaxPosts:        limits.MaxPosts,
+		StoredBytes:     user.StoredBytes,
+		MaxStoredBytes:  limits.MaxBytes,
+		MaxBodyBytes:    limits.MaxBodyBytes,
+		MaxPostsReached: user.PostCount >= limits.MaxPosts,
+		StorageFull:     user.StoredBytes >= limits.MaxBytes,
+	}
+}
+
+func (s *Service) GetUsage(userID uuid.UUID) (*dto.UsageResponse, error) {
+	user, err := s.Users.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	res := s.toUsageResponse(user)
+	return &res, nil
+}
+
+// ChangePlan moves a user to another plan. Existing data is kept even if it
+// exceeds the new plan's limits; only new posts and uploads are refused.
+func (s *Service) ChangePlan(userID string, plan string) (*dto.UsageResponse, error) {
+	if plan != models.PlanFree && plan != models.PlanPro {
+		return nil, ErrUnknownPlan
+	}
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if err := s.Users.UpdatePlan(id, plan); err != nil {
+		return nil, err
+	}
+	return s.GetUsage(id)
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cheeszy/journaling/dto"
+	"github.com/cheeszy/journaling/models"
+	"github.com/cheeszy/journaling/utils"
+)
+
+// RecoveryKeySuffixLength is how many trailing characters of the recovery key
+// the user types back to prove they saved it.
+const RecoveryKeySuffixLength = 8
+
+var (
+	ErrRecoveryKeyConfirmed = errors.New("Recovery key has already been confirmed")
+	ErrRecoveryKeyMismatch  = errors.New("Recovery key does not match")
+)
+
+// pendingRecoveryUser authenticates the user and makes sure their recovery
+// key is still unconfirmed. The key is only ever revealed during that window.
+func (s *Service) pendingRecoveryUser(identifier, password string) (*models.User, error) {
+	user, err := s.authenticate(identifier, password)
+	if err != nil {
+		return nil, err
+	}
+	if !user.RecoveryKeyPending {
+		return nil, ErrRecoveryKeyConfirmed
+	}
+	return user, nil
+}
+
+// ConfirmRecoveryKey activates the account once the user submits the last
+// characters of the recovery key they were shown at registration.
+func (s *Service) ConfirmRecoveryKey(input dto.ConfirmRecoveryKeyRequest) error {
+	user, err := s.pendingRecoveryUser(input.Identifier, input.Password)
+	if err != nil {
+		return err
+	}
+
+	key := user.RecoveryKey
+	suffix := strings.ToLower(strings.TrimSpace(input.KeySuffix))
+	if len(key) < RecoveryKeySuffixLength || len(suffix) != RecoveryKeySuffixLength ||
+		subtle.ConstantTimeCompare([]byte(suffix), []byte(key[len(key)-RecoveryKeySuffixLength:])) != 1 {
+		return ErrRecoveryKeyMismatch
+	}
+
+	return s.Users.ClearRecoveryKeyPending(user.ID)
+}
+
+// RecoveryKit is a downloadable file containing the user's recovery key.
+type RecoveryKit struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// BuildRecoveryKit renders the recovery kit as plain text or PDF. Like the
+// key itself, it's only available until the user confirms the key.
+func (s *Service) BuildRecoveryKit(input dto.RecoveryKitRequest) (*RecoveryKit, error) {
+	user, err := s.pendingRecoveryUser(input.Identifier, input.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	title := "Journaling Recovery Kit"
+	lines := []string{
+		"Account:   " + user.Username,
+		"Email:     " + user.Email,
+		"Generated: " + s.Clock.Now().UTC().Format("January 2, 2006 15:04 MST"),
+		"",
+		"Recovery key:",
+		"",
+		user.RecoveryKey,
+		"",
+		"This key is the only way to reset your password if you forget it.",
+		"Store this file somewhere safe and offline, such as a password",
+		"manager or a printed copy. Don't share it with anyone.",
+		"",
+		fmt.Sprintf("To finish setting up your account, enter the last %d characters", RecoveryKeySuffixLength),
+		"of this key when asked.",
+	}
+
+	if input.Format == "pdf" {
+		return &RecoveryKit{
+			Filename:    "recovery-kit.pdf",
+			ContentType: "application/pdf",
+			Data:        utils.RenderTextPDF(title, lines),
+		}, nil
+	}
+
+	text := title + "\n" + strings.Repeat("=", len(title)) + "\n\n" + strings.Join(lines, "\n") + "\n"
+	return &RecoveryKit{
+		Filename:    "recovery-kit.txt",
+		ContentType: "text/plain; charset=utf-8",
+		Data:        []byte(text),
+	}, nil
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+
+	"github.com/cheeszy/journaling/dto"
+	"github.com/cheeszy/journaling/utils"
+	"github.com/google/uuid"
+)
+
+const renderCacheSize = 10000
+
+type renderedBody struct {
+	postID uuid.UUID
+	sum    [sha256.Size]byte
+	html   string
+}
+
+// renderCache keeps the latest rendering of each post's body. An entry is
+// reused only while the body it was rendered from is unchanged, so every
+// revision is rendered once. When full, the least recently used entry is
+// dropped.
+type renderCache struct {
+	sync.Mutex
+	size    int
+	order   *list.List // of renderedBody, most recently used first
+	entries map[uuid.UUID]*list.Element
+}
+
+func newRenderCache(size int) *renderCache {
+	return &renderCache{size: size, order: list.New(), entries: make(map[uuid.UUID]*list.Element)}
+}
+
+func (c *renderCache) get(postID uuid.UUID, sum [sha256.Size]byte) (string, bool) {
+	c.Lock()
+	defer c.Unlock()
+	e, ok := c.entries[postID]
+	if !ok || e.Value.(renderedBody).sum != sum {
+		return "", false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(renderedBody).html, true
+}
+
+func (c *renderCache) put(body renderedBody) {
+	c.Lock()
+	defer c.Unlock()
+	if e, ok := c.entries[body.postID]; ok {
+		e.Value = body
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[body.postID] = c.order.PushFront(body)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(renderedBody).postID)
+	}
+}
+
+func (c *renderCache) forget(postID uuid.UUID) {
+	c.Lock()
+	defer c.Unlock()
+	if e, ok := c.entries[postID]; ok {
+		c.order.Remove(e)
+		delete(c.entries, postID)
+	}
+}
+
+// RenderPostBody fills in the post's BodyHTML with its body rendered from
+// Markdown and sanitized. Sealed posts are left alone.
+func (s *Service) RenderPostBody(post *dto.PostResponse) {
+	if post.Sealed {
+		return
+	}
+
+	sum := sha256.Sum256([]byte(post.Body))
+	if html, ok := s.render.get(post.ID, sum); ok {
+		post.BodyHTML = html
+		return
+	}
+
+	post.BodyHTML = utils.RenderMarkdown(post.Body)
+	s.render.put(renderedBody{postID: post.ID, sum: sum, html: post.BodyHTML})
+}
+
+func (s *Service) RenderPostBodies(posts []dto.PostResponse) {
+	for i := range posts {
+		s.RenderPostBody(&posts[i])
+	}
+}
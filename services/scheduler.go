@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// workers tracks the background jobs started by runEvery so Stop can wait
+// for them.
+type workers struct {
+	wg       sync.WaitGroup
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newWorkers() *workers {
+	return &workers{stop: make(chan struct{})}
+}
+
+// runEvery calls job immediately and then once per interval in the
+// background, until Stop is called.
+func (s *Service) runEvery(interval time.Duration, job func(now time.Time)) {
+	s.workers.wg.Add(1)
+	go func() {
+		defer s.workers.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			job(s.Clock.Now())
+			select {
+			case <-ticker.C:
+			case <-s.workers.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop tells the background workers not to start another run and waits
+// for the runs in progress, such as an outbox batch being sent, to finish.
+// It gives up when ctx is done.
+func (s *Service) Stop(ctx context.Context) error {
+	s.workers.stopOnce.Do(func() { close(s.workers.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		s.workers.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StartPostScheduler periodically publishes scheduled posts in the background.
+func (s *Service) StartPostScheduler(interval time.Duration) {
+	s.runEvery(interval, func(now time.Time) {
+		if n, err := s.PublishDuePosts(now); err != nil {
+			slog.Error("Post scheduler failed", "error", err)
+		} else if n > 0 {
+			slog.Info("Published scheduled posts", "count", n)
+		}
+	})
+}
+
+// StartTimeCapsuleScheduler periodically notifies owners of unsealed posts.
+func (s *Service) StartTimeCapsuleScheduler(interval time.Duration) {
+	s.runEvery(interval, func(now time.Time) {
+		if n, err := s.NotifyUnsealedPosts(now); err != nil {
+			slog.Error("Time capsule scheduler failed", "error", err)
+		} else if n > 0 {
+			slog.Info("Queued time capsule emails", "count", n)
+		}
+	})
+}
+
+// StartDigestScheduler periodically sends daily "on this day" digests.
+func (s *Service) StartDigestScheduler(interval time.Duration) {
+	s.runEvery(interval, func(now time.Time) {
+		if n, err := s.SendDailyDigests(now); err != nil {
+			slog.Error("Digest scheduler failed", "error", err)
+		} else if n > 0 {
+			slog.Info("Queued daily digests", "count", n)
+		}
+	})
+}
+
+// StartOutboxWorker periodically delivers queued emails.
+func (s *Service) StartOutboxWorker(interval time.Duration) {
+	s.runEvery(interval, func(now time.Time) {
+		if sent, failed, err := s.DeliverOutbox(now); err != nil {
+			slog.Error("Outbox worker failed", "error", err)
+		} else if sent+failed > 0 {
+			slog.Info("Outbox delivered", "sent", sent, "failed", failed)
+		}
+	})
+}
+
+// StartAccountDeletionScheduler periodically deletes accounts whose deletion
+// grace period has passed.
+func (s *Service) StartAccountDeletionScheduler(interval time.Duration) {
+	s.runEvery(interval, func(now time.Time) {
+		if n, err := s.DeleteDueAccounts(now); err != nil {
+			slog.Error("Account deletion scheduler failed", "error", err)
+		} else if n > 0 {
+			slog.Info("Deleted accounts", "count", n)
+		}
+	})
+}
+
+// StartExportWorker periodically builds queued data exports and removes
+// expired archives.
+func (s *Service) StartExportWorker(interval time.Duration) {
+	s.runEvery(interval, func(now time.Time) {
+		if n, err := s.ProcessDataExports(now); err != nil {
+			slog.Error("Export worker failed", "error", err)
+		} else if n > 0 {
+			slog.Info("Processed data exports", "count", n)
+		}
+		if _, err := s.ExpireDataExports(now); err != nil {
+			slog.Error("Export cleanup failed", "error", err)
+		}
+	})
+}
+
+// StartImportWorker periodically imports uploaded journal archives.
+func (s *Service) StartImportWorker(interval time.Duration) {
+	s.runEvery(interval, func(now time.Time) {
+		if n, err := s.ProcessImports(now); err != nil {
+			slog.Error("Import worker failed", "error", err)
+		} else if n > 0 {
+			slog.Info("Processed imports", "count", n)
+		}
+	})
+}
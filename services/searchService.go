@@ -0,0 +1,31 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/cheeszy/journaling/dto"
+	"github.com/google/uuid"
+)
+
+var ErrEmptySearch = errors.New("q must not be empty")
+
+const searchLimit = 50
+
+// SearchPosts finds the user's entries whose title, body or transcript
+// match the query. Sealed time capsules are left out, and encrypted bodies
+// can only be found by their title.
+func (s *Service) SearchPosts(userID uuid.UUID, query string) ([]dto.PostResponse, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, ErrEmptySearch
+	}
+	posts, err := s.Posts.Search(userID, query, s.Clock.Now(), searchLimit)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.decryptPostBodies(posts); err != nil {
+		return nil, err
+	}
+	return s.toPostResponses(posts), nil
+}
@@ -0,0 +1,26 @@
+package services
+
+import (
+	"github.com/cheeszy/journaling/app"
+)
+
+// Service implements the use cases behind the API and the background
+// workers. Everything it depends on comes from the embedded App.
+type Service struct {
+	*app.App
+
+	stats      *statsCache
+	render     *renderCache
+	workers    *workers
+	mailerPing *mailerPing
+}
+
+func New(a *app.App) *Service {
+	return &Service{
+		App:        a,
+		stats:      newStatsCache(),
+		render:     newRenderCache(renderCacheSize),
+		workers:    newWorkers(),
+		mailerPing: &mailerPing{},
+	}
+}
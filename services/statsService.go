@@ -0,0 +1,206 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cheeszy/journaling/dto"
+	"github.com/cheeszy/journaling/models"
+	"github.com/google/uuid"
+)
+
+const dateLayout = "2006-01-02"
+
+// statsSweepInterval is how often stats cached for a day that has passed
+// are dropped.
+const statsSweepInterval = 10 * time.Minute
+
+type cachedStats struct {
+	expires time.Time
+	stats   *dto.StatsResponse
+}
+
+// statsCache keeps computed stats per user until one of the user's posts
+// changes. Only the last 365 days and the current year are cached, the
+// views clients load on every visit, so a user holds at most two entries.
+// Entries expire when the user's local day rolls over, since the current
+// streak and calendar depend on "today".
+type statsCache struct {
+	sync.Mutex
+	entries map[uuid.UUID]map[int]cachedStats
+	swept   time.Time
+}
+
+func newStatsCache() *statsCache {
+	return &statsCache{entries: make(map[uuid.UUID]map[int]cachedStats)}
+}
+
+func (c *statsCache) get(userID uuid.UUID, year int, now time.Time) (*dto.StatsResponse, bool) {
+	c.Lock()
+	defer c.Unlock()
+	cached, ok := c.entries[userID][year]
+	if !ok || !now.Before(cached.expires) {
+		return nil, false
+	}
+	return cached.stats, true
+}
+
+func (c *statsCache) put(userID uuid.UUID, year int, entry cachedStats, now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	if now.Sub(c.swept) >= statsSweepInterval {
+		c.sweep(now)
+	}
+	if c.entries[userID] == nil {
+		c.entries[userID] = make(map[int]cachedStats)
+	}
+	c.entries[userID][year] = entry
+}
+
+// sweep drops the entries of days that have passed, and users left without
+// any. The caller holds the lock.
+func (c *statsCache) sweep(now time.Time) {
+	for userID, years := range c.entries {
+		for year, cached := range years {
+			if !now.Before(cached.expires) {
+				delete(years, year)
+			}
+		}
+		if len(years) == 0 {
+			delete(c.entries, userID)
+		}
+	}
+	c.swept = now
+}
+
+// InvalidateStats drops any cached stats for the user.
+func (s *Service) InvalidateStats(userID uuid.UUID) {
+	s.stats.Lock()
+	delete(s.stats.entries, userID)
+	s.stats.Unlock()
+}
+
+// GetStats returns writing statistics for the user. A year of 0 means the
+// calendar covers the last 365 days; otherwise it covers that calendar year.
+func (s *Service) GetStats(user models.User, year int) (*dto.StatsResponse, error) {
+	loc := user.Location()
+	now := s.Clock.Now()
+	local := now.In(loc)
+	cacheable := year == 0 || year == local.Year()
+
+	if cacheable {
+		if stats, ok := s.stats.get(user.ID, year, now); ok {
+			return stats, nil
+		}
+	}
+
+	posts, err := s.Posts.FindPublishedByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.decryptPostBodies(posts); err != nil {
+		return nil, err
+	}
+
+	stats := computeStats(posts, loc, now, year)
+
+	if cacheable {
+		tomorrow := time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, loc)
+		s.stats.put(user.ID, year, cachedStats{expires: tomorrow, stats: stats}, now)
+	}
+	return stats, nil
+}
+
+func computeStats(posts []models.Post, loc *time.Location, now time.Time, year int) *dto.StatsResponse {
+	stats := &dto.StatsResponse{Timezone: loc.String()}
+	perDay := make(map[string]int)
+	counted := 0
+
+	for _, post := range posts {
+		local := post.CreatedAt.In(loc)
+		stats.TotalEntries++
+		stats.EntriesPerWeekday[local.Weekday()]++
+		stats.EntriesPerHour[local.Hour()]++
+		perDay[local.Format(dateLayout)]++
+
+		// A sealed time capsule's length would hint at what it says.
+		if !post.IsSealed(now) {
+			stats.TotalWords += len(strings.Fields(post.Body))
+			counted++
+		}
+	}
+
+	if counted > 0 {
+		stats.AverageWords = float64(stats.TotalWords) / float64(counted)
+	}
+
+	stats.CurrentStreak, stats.LongestStreak = streaks(perDay, now.In(loc))
+	stats.Calendar = calendar(perDay, now.In(loc), year)
+
+	return stats
+}
+
+// streaks counts consecutive local days with at least one entry. The current
+// streak stays alive until the end of the day after the last entry.
+func streaks(perDay map[string]int, today time.Time) (current, longest int) {
+	day := func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+
+	run := 0
+	var prev time.Time
+	for _, d := range sortedDays(perDay, today.Location()) {
+		if !prev.IsZero() && d.Equal(prev.AddDate(0, 0, 1)) {
+			run++
+		} else {
+			run = 1
+		}
+		if run > longest {
+			longest = run
+		}
+		prev = d
+	}
+
+	cursor := day(today)
+	if perDay[cursor.Format(dateLayout)] == 0 {
+		cursor = cursor.AddDate(0, 0, -1)
+	}
+	for perDay[cursor.Format(dateLayout)] > 0 {
+		current++
+		cursor = cursor.AddDate(0, 0, -1)
+	}
+
+	return current, longest
+}
+
+func sortedDays(perDay map[string]int, loc *time.Location) []time.Time {
+	days := make([]time.Time, 0, len(perDay))
+	for key := range perDay {
+		d, err := time.ParseInLocation(dateLayout, key, loc)
+		if err == nil {
+			days = append(days, d)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days
+}
+
+func calendar(perDay map[string]int, today time.Time, year int) []dto.StatsDay {
+	var start, end time.Time
+	if year == 0 {
+		end = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location())
+		start = end.AddDate(0, 0, -364)
+	} else {
+		start = time.Date(year, time.January, 1, 0, 0, 0, 0, today.Location())
+		end = time.Date(year, time.December, 31, 0, 0, 0, 0, today.Location())
+	}
+
+	days := make([]dto.StatsDay, 0, 366)
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		key := d.Format(dateLayout)
+		days = append(days, dto.StatsDay{Date: key, Count: perDay[key]})
+	}
+	return days
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cheeszy/journaling/app"
+	"github.com/cheeszy/journaling/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUsernameInvalid     = errors.New("username must be 3-30 characters of letters, digits and underscores, with at least one letter")
+	ErrUsernameReserved    = errors.New("username is reserved")
+	ErrUsernameTaken       = errors.New("username is already taken")
+	ErrUsernameUnavailable = errors.New("username was recently used by another account and isn't available yet")
+	ErrUsernameUnchanged   = errors.New("new username is the same as the current one")
+)
+
+// UsernameCooldownError is returned when the user changed their username too
+// recently.
+type UsernameCooldownError struct {
+	RetryAt time.Time
+}
+
+func (e *UsernameCooldownError) Error() string {
+	return fmt.Sprintf("username can't be changed again until %s", e.RetryAt.UTC().Format(time.RFC3339))
+}
+
+var (
+	usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+	usernameLetter  = regexp.MustCompile(`[A-Za-z]`)
+)
+
+var defaultReservedUsernames = []string{
+	"admin", "administrator", "api", "app", "help", "root", "security",
+	"settings", "staff", "support", "system", "www", "login", "logout",
+	"register", "account", "me", "null", "undefined",
+}
+
+// reservedUsernames returns the built-in reserved names plus any listed in
+// the RESERVED_USERNAMES setting, lower-cased.
+func (s *Service) reservedUsernames() map[string]bool {
+	names := make(map[string]bool)
+	for _, name := range defaultReservedUsernames {
+		names[name] = true
+	}
+	for _, name := range s.Config.ReservedUsernames {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+func (s *Service) usernameChangeCooldown() time.Duration {
+	return s.Config.UsernameChangeCooldown
+}
+
+func (s *Service) usernameRedirectGrace() time.Duration {
+	return s.Config.UsernameRedirectGrace
+}
+
+// ValidateUsername checks the character policy, the reserved list and whether
+// the name is held by another account, either currently or during the grace
+// period after that account renamed. userID may be uuid.Nil for new accounts.
+func (s *Service) ValidateUsername(username string, userID uuid.UUID) error {
+	if !usernamePattern.MatchString(username) || !usernameLetter.MatchString(username) {
+		return ErrUsernameInvalid
+	}
+	if s.reservedUsernames()[strings.ToLower(username)] {
+		return ErrUsernameReserved
+	}
+
+	if existing, err := s.Users.FindByUsername(username); err == nil && existing.ID != userID {
+		return ErrUsernameTaken
+	}
+	if held, err := s.UsernameHistory.FindReserved(username, s.Clock.Now()); err == nil && held.UserID != userID {
+		return ErrUsernameUnavailable
+	}
+
+	return nil
+}
+
+// ChangeUsername renames the user, subject to the username policy and the
+// change cooldown, and records the old name so it keeps redirecting for a
+// grace period.
+func (s *Service) ChangeUsername(userID uuid.UUID, newUsername string) error {
+	newUsername = strings.TrimSpace(newUsername)
+
+	user, err := s.Users.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.Username == newUsername {
+		return ErrUsernameUnchanged
+	}
+
+	now := s.Clock.Now()
+	if user.UsernameChangedAt != nil {
+		if retryAt := user.UsernameChangedAt.Add(s.usernameChangeCooldown()); now.Before(retryAt) {
+			return &UsernameCooldownError{RetryAt: retryAt}
+		}
+	}
+
+	if err := s.ValidateUsername(newUsername, user.ID); err != nil {
+		return err
+	}
+
+	err = s.Transaction(func(tx *app.App) error {
+		if err := tx.Users.UpdateUsername(user.ID, newUsername, now); err != nil {
+			return err
+		}
+		return tx.UsernameHistory.Create(&models.UsernameHistory{
+			UserID:        user.ID,
+			OldUsername:   user.Username,
+			NewUsername:   newUsername,
+			ReservedUntil: now.Add(s.usernameRedirectGrace()),
+		})
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrUsernameTaken
+	}
+	return err
+}
+
+// ResolveUsernameRedirect returns the account that used oldUsername, if that
+// name is still within its redirect grace period. Callers must only reveal
+// the account's current username to the account itself.
+func (s *Service) ResolveUsernameRedirect(oldUsername string) (*models.User, bool) {
+	held, err := s.UsernameHistory.FindReserved(oldUsername, s.Clock.Now())
+	if err != nil {
+		return nil, false
+	}
+	user, err := s.Users.FindByID(held.UserID)
+	if err != nil || strings.EqualFold(user.Username, oldUsername) {
+		return nil, false
+	}
+	return user, true
+}
@@ -3,14 +3,16 @@ package services
 import (
 	"errors"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/cheeszy/journaling/app"
 	"github.com/cheeszy/journaling/dto"
-	"github.com/cheeszy/journaling/initializers"
 	"github.com/cheeszy/journaling/models"
-	"github.com/cheeszy/journaling/repositories"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 func CurrentUser(c *gin.Context) {
@@ -39,11 +41,12 @@ func GetUserFromContext(c *gin.Context) (models.User, bool) {
 	return user.(models.User), true
 }
 
-func ResetPassword(input dto.ResetPasswordRequest) (*models.User, error) {
-	db := initializers.DB
-	user, err := repositories.FindUserByRecoveryKey(db, input.RecoveryKey)
+var ErrInvalidRecoveryKey = errors.New("invalid recovery key")
+
+func (s *Service) ResetPassword(input dto.ResetPasswordRequest) (*models.User, error) {
+	user, err := s.Users.FindByRecoveryKey(input.RecoveryKey)
 	if err != nil {
-		return nil, errors.New("invalid recovery key")
+		return nil, ErrInvalidRecoveryKey
 	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcrypt.DefaultCost)
@@ -52,19 +55,126 @@ func ResetPassword(input dto.ResetPasswordRequest) (*models.User, error) {
 	}
 	user.Password = string(hashedPassword)
 
-	if err := db.Save(&user).Error; err != nil {
+	if err := s.Users.Update(user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+const emailChangeTTL = 24 * time.Hour
+
+var (
+	ErrEmailUnchanged       = errors.New("new email is the same as the current one")
+	ErrEmailTaken           = errors.New("email is already in use")
+	ErrInvalidEmailChange   = errors.New("invalid or expired email change link")
+	ErrEmailChangeNotActive = errors.New("email change is no longer pending")
+)
+
+// ChangeEmail starts an email change. The address isn't updated here: a
+// confirmation link goes to the new address and a cancel link to the old
+// one, so a hijacked session alone can't take over the account.
+func (s *Service) ChangeEmail(userID uuid.UUID, newEmail string) (*models.EmailChange, error) {
+	newEmail = strings.TrimSpace(newEmail)
+
+	user, err := s.Users.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(user.Email, newEmail) {
+		return nil, ErrEmailUnchanged
+	}
+	if _, err := s.Users.FindByEmail(newEmail); err == nil {
+		return nil, ErrEmailTaken
+	}
+
+	confirmToken, err := GenerateToken(32)
+	if err != nil {
+		return nil, err
+	}
+	cancelToken, err := GenerateToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.Clock.Now()
+	change := models.EmailChange{
+		UserID:       user.ID,
+		OldEmail:     user.Email,
+		NewEmail:     newEmail,
+		ConfirmToken: confirmToken,
+		CancelToken:  cancelToken,
+		ExpiresAt:    now.Add(emailChangeTTL),
+	}
+
+	err = s.Transaction(func(tx *app.App) error {
+		if err := tx.EmailChanges.CancelPending(user.ID, now); err != nil {
+			return err
+		}
+		if err := tx.EmailChanges.Create(&change); err != nil {
+			return err
+		}
+		return s.QueueEmailChangeEmails(tx, &change)
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	return &user, nil
+	return &change, nil
+}
+
+// ConfirmEmailChange applies a pending change once the new address clicks
+// its link. Reaching the link proves ownership, so the account is verified
+// for the new address.
+func (s *Service) ConfirmEmailChange(token string) error {
+	change, err := s.EmailChanges.FindByConfirmToken(token)
+	if err != nil {
+		return ErrInvalidEmailChange
+	}
+	now := s.Clock.Now()
+	if !change.IsPending(now) {
+		return ErrEmailChangeNotActive
+	}
+
+	if existing, err := s.Users.FindByEmail(change.NewEmail); err == nil && existing.ID != change.UserID {
+		return ErrEmailTaken
+	}
+
+	return s.Transaction(func(tx *app.App) error {
+		if err := tx.Users.UpdateEmail(change.UserID, change.NewEmail); err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return ErrEmailTaken
+			}
+			return err
+		}
+		return tx.EmailChanges.MarkConfirmed(change.ID, now)
+	})
 }
 
-func ChangeUsername(userID uuid.UUID, newUsername string) error {
-	db := initializers.DB
-	return repositories.UpdateUsername(db, userID, newUsername)
+// CancelEmailChange aborts a pending change from the link sent to the old
+// address.
+func (s *Service) CancelEmailChange(token string) error {
+	change, err := s.EmailChanges.FindByCancelToken(token)
+	if err != nil {
+		return ErrInvalidEmailChange
+	}
+	now := s.Clock.Now()
+	if !change.IsPending(now) {
+		return ErrEmailChangeNotActive
+	}
+
+	return s.EmailChanges.MarkCancelled(change.ID, now)
 }
 
-func ChangeEmail(userID uuid.UUID, newEmail string) error {
-	db := initializers.DB
-	return repositories.UpdateEmail(db, userID, newEmail)
+func (s *Service) ChangeTimezone(userID uuid.UUID, timezone string) error {
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return errors.New("unknown timezone")
+	}
+
+	if err := s.Users.UpdateTimezone(userID, timezone); err != nil {
+		return err
+	}
+
+	s.InvalidateStats(userID)
+	return nil
 }
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"mime/multipart"
+	"strings"
+
+	"github.com/cheeszy/journaling/app"
+	"github.com/cheeszy/journaling/audio"
+	"github.com/cheeszy/journaling/dto"
+	"github.com/cheeszy/journaling/models"
+	"github.com/google/uuid"
+)
+
+func toAudioResponse(post *models.Post) *dto.AudioResponse {
+	if post.AudioAttachmentID == nil {
+		return nil
+	}
+	return &dto.AudioResponse{
+		URL:        "/api/posts/" + post.ID.String() + "/attachments/" + post.AudioAttachmentID.String(),
+		DurationMs: post.AudioDurationMs,
+	}
+}
+
+// CreateVoicePost creates a voice entry from an uploaded recording. The
+// format is sniffed from the file itself, and the recording is stored
+// encrypted like any other attachment.
+func (s *Service) CreateVoicePost(ctx context.Context, req dto.CreateVoicePostRequest, userID uuid.UUID, file *multipart.FileHeader) (*dto.PostResponse, error) {
+	if file.Size > attachmentMaxBytes {
+		return nil, ErrAttachmentTooLarge
+	}
+	status, _, err := s.resolvePostStatus(req.Status, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	info, err := audio.Probe(src, file.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		title = "Voice note"
+	}
+	post := models.Post{
+		ID:              uuid.New(),
+		Kind:            models.PostKindVoice,
+		Title:           title,
+		Transcript:      req.Transcript,
+		UserID:          userID,
+		Status:          status,
+		AudioDurationMs: info.Duration.Milliseconds(),
+	}
+	attachment := newAttachment(post.ID, userID, file)
+	attachment.ContentType = info.ContentType
+	attachment.DurationMs = post.AudioDurationMs
+	post.AudioAttachmentID = &attachment.ID
+
+	if err := s.uploadAttachment(ctx, &attachment, src); err != nil {
+		return nil, err
+	}
+
+	err = s.Transaction(func(tx *app.App) error {
+		if err := s.reserveUsage(tx, userID, 1, postBytes(&post)+attachment.Size, bodyBytes(&post)); err != nil {
+			return err
+		}
+		if err := tx.Posts.Create(&post); err != nil {
+			return err
+		}
+		return tx.Attachments.Create(&attachment)
+	})
+	if err != nil {
+		s.deleteBlobs(ctx, []models.Attachment{attachment})
+		return nil, err
+	}
+
+	s.InvalidateStats(userID)
+
+	res := s.toPostResponse(&post)
+	return &res, nil
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// MemoryStore keeps blobs in memory. It's meant for tests and local
+// development.
+type MemoryStore struct {
+	mu    sync.Mutex
+	blobs map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{blobs: make(map[string][]byte)}
+}
+
+func (s *MemoryStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) != size {
+		return fmt.Errorf("blob size mismatch: read %d of %d bytes", len(data), size)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[key] = data
+	return nil
+}
+
+func (s *MemoryStore) Open(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	s.mu.Lock()
+	data, ok := s.blobs[key]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	data = data[offset:]
+	if length >= 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blobs, key)
+	return nil
+}
+
+// Keys returns the keys of all stored blobs.
+func (s *MemoryStore) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.blobs))
+	for key := range s.blobs {
+		keys = append(keys, key)
+	}
+	return keys
+}
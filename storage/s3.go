@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+type S3Config struct {
+	// Endpoint is the service's base URL, such as
+	// https://s3.eu-west-1.amazonaws.com or http://localhost:9000 for MinIO.
+	// It defaults to the AWS endpoint for Region.
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// PathStyle addresses objects as endpoint/bucket/key instead of
+	// bucket.endpoint/key. Most S3-compatible servers need it.
+	PathStyle bool
+	Client    *http.Client
+}
+
+// S3Store keeps blobs as objects in an S3-compatible bucket. Requests are
+// signed with AWS Signature Version 4.
+type S3Store struct {
+	cfg      S3Config
+	endpoint *url.URL
+}
+
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	if cfg.Bucket == "" || cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("s3 bucket and credentials are required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Minute}
+	}
+
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", cfg.Endpoint)
+	}
+	return &S3Store{cfg: cfg, endpoint: endpoint}, nil
+}
+
+func (s *S3Store) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	segments := strings.Split(key, "/")
+	if s.cfg.PathStyle {
+		segments = append([]string{s.cfg.Bucket}, segments...)
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+	}
+
+	escaped := make([]string, len(segments))
+	for i, segment := range segments {
+		escaped[i] = uriEncode(segment)
+	}
+	base := strings.TrimSuffix(u.Path, "/")
+	u.Path = base + "/" + strings.Join(segments, "/")
+	u.RawPath = base + "/" + strings.Join(escaped, "/")
+	return &u
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	body := r
+	if size == 0 {
+		body = http.NoBody
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key).String(), body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := s.do(req, unsignedPayload)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3Store) Open(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if length == 0 {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if length > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	} else if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := s.do(req, emptyPayloadHash)
+	if errors.Is(err, errRangeNotSatisfiable) {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Servers that ignore Range send the whole object, which may end
+	// before offset.
+	if resp.StatusCode == http.StatusOK && offset > 0 {
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil && err != io.EOF {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+	if resp.StatusCode == http.StatusOK && length > 0 {
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.LimitReader(resp.Body, length), resp.Body}, nil
+	}
+	return resp.Body, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key).String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req, emptyPayloadHash)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+var (
+	emptyPayloadHash       = hex.EncodeToString(sha256Sum(nil))
+	errRangeNotSatisfiable = errors.New("range not satisfiable")
+)
+
+// do signs and sends the request and turns error responses into errors.
+func (s *S3Store) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	s.sign(req, payloadHash, time.Now())
+
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	case http.StatusRequestedRangeNotSatisfiable:
+		return nil, errRangeNotSatisfiable
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return nil, fmt.Errorf("s3 %s %s: %s: %s", req.Method, req.URL.Path, resp.Status, bytes.TrimSpace(detail))
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req.
+func (s *S3Store) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "range" || lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.cfg.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(sha256Sum([]byte(canonicalRequest))),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretAccessKey), date)
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// uriEncode percent-encodes everything except unreserved characters, as
+// Signature Version 4 requires.
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,21 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps opaque blobs by key. Keys are slash-separated paths.
+// Implementations must be safe for concurrent use.
+type BlobStore interface {
+	// Put stores size bytes read from r under key, replacing any existing blob.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Open returns length bytes of the blob starting at offset. A negative
+	// length reads to the end of the blob.
+	Open(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// Delete removes the blob. Deleting a missing blob isn't an error.
+	Delete(ctx context.Context, key string) error
+}
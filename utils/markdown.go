@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithRendererOptions(html.WithXHTML()),
+)
+
+// markdownPolicy is the user-generated content policy plus the disabled
+// checkboxes that task list items render to.
+var markdownPolicy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(left|center|right)$`)).OnElements("th", "td")
+	return p
+}()
+
+// RenderMarkdown renders CommonMark with the GitHub tables, task lists,
+// strikethrough and autolink extensions, and sanitizes the result so it's
+// safe to embed in a page. Raw HTML in the source is dropped. The output is
+// well-formed XHTML.
+func RenderMarkdown(src string) string {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(src), &buf); err != nil {
+		return ""
+	}
+	return markdownPolicy.Sanitize(buf.String())
+}
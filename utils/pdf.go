@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const pdfLineWidth = 72
+
+// RenderTextPDF lays out a title and lines of monospaced text on a single A4
+// page using the standard PDF fonts, so no font files are embedded. It's
+// meant for short documents like the recovery kit; long lines are wrapped
+// and anything past the end of the page is dropped.
+func RenderTextPDF(title string, lines []string) []byte {
+	var content bytes.Buffer
+	fmt.Fprintf(&content, "BT /F1 18 Tf 56 780 Td (%s) Tj ET\n", pdfEscape(title))
+	content.WriteString("BT /F2 11 Tf 56 744 Td 15 TL\n")
+	row := 0
+	for _, line := range lines {
+		for _, wrapped := range wrapLine(line, pdfLineWidth) {
+			if row >= 44 {
+				break
+			}
+			fmt.Fprintf(&content, "(%s) Tj T*\n", pdfEscape(wrapped))
+			row++
+		}
+	}
+	content.WriteString("ET\n")
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] " +
+			"/Resources << /Font << /F1 4 0 R /F2 5 0 R >> >> /Contents 6 0 R >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		fmt.Sprintf("<< /Title (%s) /Producer (journaling) >>", pdfEscape(title)),
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(objects)+1, len(objects), xref)
+
+	return out.Bytes()
+}
+
+// pdfEscape makes s safe inside a PDF string literal. Characters outside
+// printable ASCII are replaced since the standard fonts can't show them.
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+func wrapLine(line string, width int) []string {
+	runes := []rune(line)
+	if len(runes) <= width {
+		return []string{line}
+	}
+	var lines []string
+	for len(runes) > width {
+		lines = append(lines, string(runes[:width]))
+		runes = runes[width:]
+	}
+	return append(lines, string(runes))
+}
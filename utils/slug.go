@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Slugify turns a title into a lower-case, dash-separated string that's safe
+// to use in file names and URLs. It returns "untitled" if nothing is left.
+func Slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+		if b.Len() >= 60 {
+			break
+		}
+	}
+
+	slug := strings.Trim(b.String(), "-")
+	if slug == "" {
+		return "untitled"
+	}
+	return slug
+}